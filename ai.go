@@ -0,0 +1,528 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"slices"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+// ===AI===
+//
+// Entities with IAControlled run the state machine of a prefab, written in the
+// prefab file next to its components:
+//
+//	"invader_diver": {
+//		"components": {"IAControlled": {"Machine": "invader_diver"}},
+//		"machine": {
+//			"Initial": "formation",
+//			"States": {
+//				"formation": {"Enter": "rejoin", "Action": "hold", "Transitions": [
+//					{"If": [{"Is": "chance", "Value": 0.08}, {"Is": "head"}], "To": "dive"}
+//				]},
+//				"dive": {"Enter": "leave", "Action": "chase", "Speed": 140, "Transitions": [
+//					{"If": [{"Is": "after", "Value": 2.5}], "To": "formation"}
+//				]}
+//			}
+//		}
+//	}
+//
+// Every tick AISystem takes the first transition of the current state whose
+// conditions all hold, runs the Enter action of the state it goes to, then
+// the Action of the state it is in. A state with a Parent tries the
+// transitions of its parent first, and takes its Action and Speed when it has
+// none, so what a group of states share is written once. Prefabs inherit the
+// machine of their base. The Patterns and Minions of a state are for bosses,
+// see BossSystem.
+//
+// Conditions, each of which Not turns around:
+//
+//	after       Value seconds in the state
+//	chance      a Value chance a second
+//	head        a snake is alive
+//	sees_head   nothing solid between it and the nearest snake head
+//	near_head   the nearest head is within Value pixels
+//	candy       there is a candy
+//	home        it is back at its place in the formation
+//	hurt        it has lost health
+//	hurt_below  no more than Value of its health is left, of its weak points
+//	            for a boss
+//
+// Actions, the ones marked once are meant for Enter:
+//
+//	hold        stand still
+//	chase       move towards the nearest head at Speed
+//	flee        move away from the nearest head at Speed
+//	seek_candy  move towards the nearest candy at Speed
+//	return      move back towards its place in the formation at Speed
+//	leave       (once) leave its place in the formation
+//	rejoin      (once) take its place in the formation again, meant for when
+//	            it is home
+//	fire        (once) shoot at the nearest head
+//	fire_down   (once) shoot straight down
+//	boss_phase  (once) start the patterns and minions of the state over
+//	boss        march from side to side at Speed, fire the Patterns of the
+//	            state and summon its Minions
+
+type Machine struct {
+	Initial string
+	States  map[string]MachineState
+}
+
+type MachineState struct {
+	Parent      string
+	Enter       string
+	Action      string
+	Speed       float32
+	Patterns    []BulletPattern
+	Minions     []BossMinion
+	Transitions []Transition
+}
+
+type Transition struct {
+	If []Condition
+	To string
+}
+
+type Condition struct {
+	Is    string
+	Value float32
+	Not   bool
+}
+
+var AI_CONDITIONS = map[string]func(b *Blackboard, value float32) bool{
+	"after":  func(b *Blackboard, value float32) bool { return b.Time >= value },
+	"chance": func(b *Blackboard, value float32) bool { return b.World.rng.Float32() < value*b.dt },
+	"head": func(b *Blackboard, value float32) bool {
+		_, ok := b.Head()
+		return ok
+	},
+	"sees_head": func(b *Blackboard, value float32) bool { return b.SeesHead() },
+	"near_head": func(b *Blackboard, value float32) bool {
+		head, ok := b.Head()
+		return ok && GetVectorLength(b.toward(head)) <= value
+	},
+	"candy": func(b *Blackboard, value float32) bool {
+		_, ok := b.Candy()
+		return ok
+	},
+	"home": func(b *Blackboard, value float32) bool {
+		return b.Enemy == nil || !b.Enemy.Away || GetVectorLength(b.toward(b.Enemy.Slot)) <= max(b.Speed*b.dt, 1)
+	},
+	"hurt": func(b *Blackboard, value float32) bool {
+		health, ok := getComponent[Health](b.World, b.Entity, healthID)
+		return ok && health.Current < health.Max
+	},
+	"hurt_below": func(b *Blackboard, value float32) bool {
+		if b.Boss != nil {
+			return float32(b.Boss.Health) <= value*float32(b.Boss.MaxHealth)
+		}
+		health, ok := getComponent[Health](b.World, b.Entity, healthID)
+		return ok && float32(health.Current) <= value*float32(health.Max)
+	},
+}
+
+var AI_ACTIONS = map[string]func(b *Blackboard){
+	"hold": func(b *Blackboard) { b.move(rl.Vector2{}) },
+	"chase": func(b *Blackboard) {
+		if head, ok := b.Head(); ok {
+			b.move(b.toward(head))
+		}
+	},
+	"flee": func(b *Blackboard) {
+		if head, ok := b.Head(); ok {
+			b.move(rl.Vector2Negate(b.toward(head)))
+		}
+	},
+	"seek_candy": func(b *Blackboard) {
+		if candy, ok := b.Candy(); ok {
+			b.move(b.toward(candy))
+		}
+	},
+	"return": func(b *Blackboard) {
+		if b.Enemy != nil && b.Enemy.Away {
+			b.move(b.toward(b.Enemy.Slot))
+		}
+	},
+	"leave": func(b *Blackboard) {
+		if b.Enemy != nil && !b.Enemy.Away {
+			b.Enemy.Away, b.Enemy.Slot = true, *b.Position
+		}
+	},
+	"rejoin": func(b *Blackboard) {
+		b.move(rl.Vector2{})
+		if b.Enemy == nil || !b.Enemy.Away {
+			return
+		}
+		*b.Position = b.Enemy.Slot
+		if collider, ok := getComponent[Collides](b.World, b.Entity, collidesID); ok {
+			collider.X, collider.Y = b.Position.X, b.Position.Y
+		}
+		b.Enemy.Away = false
+	},
+	"fire": func(b *Blackboard) {
+		if head, ok := b.Head(); ok {
+			b.shoot(b.World.aim(b.Box, head))
+		}
+	},
+	"fire_down": func(b *Blackboard) { b.shoot(rl.Vector2{Y: 1}) },
+	"boss_phase": func(b *Blackboard) {
+		if b.Boss == nil {
+			return
+		}
+		b.Boss.enterPhase(b.State)
+		if b.Boss.Phase > 0 {
+			b.World.Emit(Event{Kind: EventBossPhase, Entity: b.Entity, Position: *b.Position, Wave: b.World.gameState.wave})
+		}
+	},
+	"boss": func(b *Blackboard) {
+		if b.Boss != nil {
+			b.attack()
+		}
+	},
+}
+
+// check makes sure m only goes to states it has and only uses conditions and
+// actions there are.
+func (m *Machine) check() error {
+	if _, ok := m.States[m.Initial]; !ok {
+		return fmt.Errorf("no initial state %q", m.Initial)
+	}
+	for name, state := range m.States {
+		if _, ok := m.States[state.Parent]; state.Parent != "" && !ok {
+			return fmt.Errorf("state %q: no parent state %q", name, state.Parent)
+		}
+		for _, action := range []string{state.Enter, state.Action} {
+			if _, ok := AI_ACTIONS[action]; action != "" && !ok {
+				return fmt.Errorf("state %q: unknown action %q", name, action)
+			}
+		}
+		for _, pattern := range state.Patterns {
+			if err := checkPattern(pattern); err != nil {
+				return fmt.Errorf("state %q: %w", name, err)
+			}
+		}
+		for _, t := range state.Transitions {
+			if _, ok := m.States[t.To]; !ok {
+				return fmt.Errorf("state %q: no state %q to go to", name, t.To)
+			}
+			for _, c := range t.If {
+				if _, ok := AI_CONDITIONS[c.Is]; !ok {
+					return fmt.Errorf("state %q: unknown condition %q", name, c.Is)
+				}
+			}
+		}
+	}
+	for name := range m.States {
+		seen := []string{name}
+		for parent := m.States[name].Parent; parent != ""; parent = m.States[parent].Parent {
+			if slices.Contains(seen, parent) {
+				return fmt.Errorf("state %q is its own parent through %v", name, seen)
+			}
+			seen = append(seen, parent)
+		}
+	}
+	return nil
+}
+
+// hurtMarks returns the health left below which m changes state.
+func (m *Machine) hurtMarks() []float32 {
+	var marks []float32
+	for _, state := range m.States {
+		for _, t := range state.Transitions {
+			for _, c := range t.If {
+				if c.Is == "hurt_below" && !c.Not {
+					marks = append(marks, c.Value)
+				}
+			}
+		}
+	}
+	return marks
+}
+
+// lineage returns state and its parents, the outermost first.
+func (m *Machine) lineage(state string) []MachineState {
+	var states []MachineState
+	for name := state; name != ""; name = m.States[name].Parent {
+		states = append([]MachineState{m.States[name]}, states...)
+	}
+	return states
+}
+
+// +++++++++++
+// Blackboard is what conditions and actions know of the entity running its
+// machine and of the world around it. What takes a query to find out is only
+// looked up when asked for, once a tick.
+type Blackboard struct {
+	World    *World
+	Entity   Entity
+	Position *Position
+	Box      AABB
+	Mover    *Movement
+	Enemy    *Enemy
+	Boss     *Boss
+	// State is the state the entity is in, Time how long it has been in it
+	// and Speed the Speed of that state.
+	State MachineState
+	Time  float32
+	Speed float32
+	dt    float32
+
+	head, candy       *Position
+	headDone, seeDone bool
+	candyDone, sees   bool
+	blockers          *[]AABB
+	later             *[]func()
+}
+
+func (b *Blackboard) Head() (Position, bool) {
+	if !b.headDone {
+		b.headDone = true
+		if head, ok := b.World.nearestHead(*b.Position); ok {
+			b.head = &head
+		}
+	}
+	if b.head == nil {
+		return Position{}, false
+	}
+	return *b.head, true
+}
+
+func (b *Blackboard) Candy() (Position, bool) {
+	if !b.candyDone {
+		b.candyDone = true
+		best := float32(-1)
+		for _, archetype := range b.World.Query(candyID, positionID) {
+			for _, candy := range archetype.Components[positionID].([]Position) {
+				if d := GetVectorLength(b.toward(candy)); best < 0 || d < best {
+					b.candy, best = &candy, d
+				}
+			}
+		}
+	}
+	if b.candy == nil {
+		return Position{}, false
+	}
+	return *b.candy, true
+}
+
+// SeesHead tells whether no wall nor bunker stands between the middle of the
+// entity and that of the nearest head.
+func (b *Blackboard) SeesHead() bool {
+	if b.seeDone {
+		return b.sees
+	}
+	b.seeDone = true
+	sight, ok := b.sight()
+	if !ok {
+		return false
+	}
+	if *b.blockers == nil {
+		*b.blockers = b.World.sightBlockers()
+	}
+	b.sees = !slices.ContainsFunc(*b.blockers, func(box AABB) bool {
+		_, hit := SegmentAABB(sight, box)
+		return hit
+	})
+	return b.sees
+}
+
+// sight is the line from the middle of the entity to that of the nearest head.
+func (b *Blackboard) sight() (Segment, bool) {
+	head, ok := b.Head()
+	if !ok {
+		return Segment{}, false
+	}
+	from := rl.Vector2{X: (b.Box.Min.X + b.Box.Max.X) / 2, Y: (b.Box.Min.Y + b.Box.Max.Y) / 2}
+	to := rl.Vector2{X: head.X + RECTSIZE/2, Y: head.Y + RECTSIZE/2}
+	return Segment{A: from, B: rl.Vector2Add(from, b.World.gameState.arena.Delta(from, to))}, true
+}
+
+// toward returns the shortest way from the entity to target.
+func (b *Blackboard) toward(target Position) rl.Vector2 {
+	return b.World.gameState.arena.Delta(rl.Vector2{X: b.Position.X, Y: b.Position.Y}, rl.Vector2{X: target.X, Y: target.Y})
+}
+
+// move sets the entity going along direction at the speed of its state, or
+// stops it. How it accelerates, brakes and falls is left to its prefab.
+func (b *Blackboard) move(direction rl.Vector2) {
+	if b.Mover == nil {
+		return
+	}
+	if direction == (rl.Vector2{}) || b.Speed == 0 {
+		b.Mover.Direction, b.Mover.Speed, b.Mover.Velocity = rl.Vector2{}, 0, rl.Vector2{}
+		return
+	}
+	b.Mover.Direction = rl.Vector2Normalize(direction)
+	b.Mover.Speed = b.Speed
+}
+
+// shoot fires an enemy shot along direction from the bottom middle of the
+// entity, once AISystem is done with every machine.
+func (b *Blackboard) shoot(direction rl.Vector2) {
+	w, owner := b.World, b.Entity
+	x, y := (b.Box.Min.X+b.Box.Max.X)/2-2, b.Box.Max.Y
+	*b.later = append(*b.later, func() {
+		if err := SpawnEnemyShot(w, owner, x, y, direction, ENEMY_SHOT_SPEED); err != nil {
+			log.Println("ai:", err)
+		}
+	})
+}
+
+// sightBlockers are the boxes nothing sees through: walls and bunker cells.
+func (w *World) sightBlockers() []AABB {
+	blockers := []AABB{}
+	for _, archetype := range w.Query(positionID, collidesID) {
+		if archetype.Mask&(playerControlledID|enemyID|projectileID|candyID) != 0 {
+			continue
+		}
+		position := archetype.Components[positionID].([]Position)
+		collider := archetype.Components[collidesID].([]Collides)
+		bunker, isBunker := archetype.Components[bunkerID].([]Bunker)
+		for idx := range archetype.Entities {
+			switch {
+			case isBunker:
+				bunker[idx].EachCell(position[idx], func(box AABB) { blockers = append(blockers, box) })
+			case !collider[idx].Trigger:
+				blockers = append(blockers, collider[idx].AABB(position[idx]))
+			}
+		}
+	}
+	return blockers
+}
+
+// +++++++++++
+// AISystem runs the machine of every IAControlled entity. It must run before
+// MovementSystem.
+type AISystem struct {
+	BaseSystem
+}
+
+func (s *AISystem) Update(dt float32) {
+	var later []func()
+	var blockers []AABB
+	for _, archetype := range s.World.Query(IAControlledID, positionID) {
+		ai := archetype.Components[IAControlledID].([]IAControlled)
+		position := archetype.Components[positionID].([]Position)
+		collider, collides := archetype.Components[collidesID].([]Collides)
+		mover, moves := archetype.Components[movementID].([]Movement)
+		enemy, isEnemy := archetype.Components[enemyID].([]Enemy)
+		boss, isBoss := archetype.Components[bossID].([]Boss)
+		for idx, entity := range archetype.Entities {
+			prefab, ok := s.World.prefabs[ai[idx].Machine]
+			if !ok || prefab.Machine == nil {
+				continue
+			}
+			b := &Blackboard{World: s.World, Entity: entity, Position: &position[idx], dt: dt, blockers: &blockers, later: &later}
+			b.Box = NewAABB(position[idx].X, position[idx].Y, 0, 0)
+			if collides {
+				b.Box = collider[idx].AABB(position[idx])
+			}
+			if moves {
+				b.Mover = &mover[idx]
+			}
+			if isEnemy {
+				b.Enemy = &enemy[idx]
+			}
+			if isBoss {
+				b.Boss = &boss[idx]
+			}
+			ai[idx].Run(prefab.Machine, b)
+		}
+	}
+	for _, f := range later {
+		f()
+	}
+}
+
+// Run moves c on by a tick of b along machine.
+func (c *IAControlled) Run(machine *Machine, b *Blackboard) {
+	if _, ok := machine.States[c.State]; !ok {
+		c.enter(machine, machine.Initial, b)
+	}
+	c.Time += b.dt
+
+	lineage := machine.lineage(c.State)
+	b.State, b.Time, b.Speed = machine.States[c.State], c.Time, effectiveSpeed(lineage)
+transitions:
+	for _, state := range lineage {
+		for _, t := range state.Transitions {
+			if !t.holds(b) {
+				continue
+			}
+			c.enter(machine, t.To, b)
+			lineage = machine.lineage(c.State)
+			break transitions
+		}
+	}
+
+	for i := len(lineage) - 1; i >= 0; i-- {
+		if action := lineage[i].Action; action != "" {
+			AI_ACTIONS[action](b)
+			break
+		}
+	}
+}
+
+func (c *IAControlled) enter(machine *Machine, state string, b *Blackboard) {
+	c.State, c.Time = state, 0
+	lineage := machine.lineage(state)
+	b.State, b.Time, b.Speed = machine.States[state], 0, effectiveSpeed(lineage)
+	if enter := machine.States[state].Enter; enter != "" {
+		AI_ACTIONS[enter](b)
+	}
+}
+
+// effectiveSpeed is the Speed of the innermost state of lineage that has one.
+func effectiveSpeed(lineage []MachineState) float32 {
+	for i := len(lineage) - 1; i >= 0; i-- {
+		if lineage[i].Speed != 0 {
+			return lineage[i].Speed
+		}
+	}
+	return 0
+}
+
+func (t Transition) holds(b *Blackboard) bool {
+	for _, c := range t.If {
+		if AI_CONDITIONS[c.Is](b, c.Value) == c.Not {
+			return false
+		}
+	}
+	return true
+}
+
+// +++++++++++
+// AIDebugSystem writes the state of every machine above its entity, with the
+// line to the nearest head it looks at, green when it sees it and red when
+// something is in the way.
+type AIDebugSystem struct {
+	BaseSystem
+}
+
+func (s *AIDebugSystem) Update(dt float32) {
+	const fontSize = 10
+	var blockers []AABB
+	for _, archetype := range s.World.Query(IAControlledID, positionID) {
+		ai := archetype.Components[IAControlledID].([]IAControlled)
+		position := archetype.Components[positionID].([]Position)
+		collider, collides := archetype.Components[collidesID].([]Collides)
+		for idx, entity := range archetype.Entities {
+			b := &Blackboard{World: s.World, Entity: entity, Position: &position[idx], blockers: &blockers}
+			b.Box = NewAABB(position[idx].X, position[idx].Y, 0, 0)
+			if collides {
+				b.Box = collider[idx].AABB(position[idx])
+			}
+			if sight, ok := b.sight(); ok {
+				color := rl.Red
+				if b.SeesHead() {
+					color = rl.Green
+				}
+				rl.DrawLineV(sight.A, sight.B, rl.Fade(color, 0.5))
+			}
+			text := fmt.Sprintf("%s %.1f", ai[idx].State, ai[idx].Time)
+			rl.DrawText(text, int32(position[idx].X), int32(b.Box.Min.Y)-fontSize-2, fontSize, rl.Black)
+		}
+	}
+}
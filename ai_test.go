@@ -0,0 +1,121 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+func TestMachineCheck(t *testing.T) {
+	to := func(state string) []Transition { return []Transition{{To: state}} }
+	tests := []struct {
+		name    string
+		machine Machine
+		want    string
+	}{
+		{"ok", Machine{Initial: "a", States: map[string]MachineState{
+			"a": {Action: "hold", Transitions: to("b")},
+			"b": {Parent: "a", Enter: "fire", Transitions: []Transition{{If: []Condition{{Is: "after", Value: 1}}, To: "a"}}},
+		}}, ""},
+		{"no initial", Machine{Initial: "x", States: map[string]MachineState{"a": {}}}, `no initial state "x"`},
+		{"no parent", Machine{Initial: "a", States: map[string]MachineState{"a": {Parent: "x"}}}, `no parent state "x"`},
+		{"unknown enter", Machine{Initial: "a", States: map[string]MachineState{"a": {Enter: "dance"}}}, `unknown action "dance"`},
+		{"unknown action", Machine{Initial: "a", States: map[string]MachineState{"a": {Action: "dance"}}}, `unknown action "dance"`},
+		{"bad pattern", Machine{Initial: "a", States: map[string]MachineState{"a": {Patterns: []BulletPattern{{Kind: "spread"}}}}}, "needs Every and Shots"},
+		{"no state to go to", Machine{Initial: "a", States: map[string]MachineState{"a": {Transitions: to("x")}}}, `no state "x" to go to`},
+		{"unknown condition", Machine{Initial: "a", States: map[string]MachineState{"a": {Transitions: []Transition{{If: []Condition{{Is: "bored"}}, To: "a"}}}}}, `unknown condition "bored"`},
+		{"own parent", Machine{Initial: "a", States: map[string]MachineState{"a": {Parent: "a"}}}, "its own parent"},
+		{"parent cycle", Machine{Initial: "a", States: map[string]MachineState{
+			"a": {Parent: "b"},
+			"b": {Parent: "c"},
+			"c": {Parent: "a"},
+		}}, "its own parent"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.machine.check()
+			if tt.want == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+// machineWorld has a snake head at 300,300 and returns a blackboard for an
+// entity at 100,300 with mover.
+func machineWorld(t *testing.T, mover *Movement) *Blackboard {
+	t.Helper()
+	w := spawnWorld(t)
+	if _, err := SpawnPlayer(w, 0, 300, 300); err != nil {
+		t.Fatal(err)
+	}
+	var blockers []AABB
+	var later []func()
+	return &Blackboard{World: w, Position: &Position{X: 100, Y: 300}, Mover: mover, dt: TICK, blockers: &blockers, later: &later}
+}
+
+func TestMachineRun(t *testing.T) {
+	after := func(seconds float32, state string) Transition {
+		return Transition{If: []Condition{{Is: "after", Value: seconds}}, To: state}
+	}
+	machine := &Machine{Initial: "start", States: map[string]MachineState{
+		"start": {Transitions: []Transition{after(1, "last"), after(0, "walk"), {To: "last"}}},
+		"base":  {Action: "chase", Speed: 50, Transitions: []Transition{after(0.5, "rest")}},
+		"walk":  {Parent: "base", Transitions: []Transition{after(0.5, "last")}},
+		"rest":  {Parent: "base", Action: "hold", Speed: 20},
+		"last":  {},
+	}}
+	if err := machine.check(); err != nil {
+		t.Fatal(err)
+	}
+	var mover Movement
+	b := machineWorld(t, &mover)
+	var c IAControlled
+
+	// The first transition that holds is taken.
+	c.Run(machine, b)
+	if c.State != "walk" || c.Time != 0 {
+		t.Fatalf("in %q after %v", c.State, c.Time)
+	}
+	// A state without Action and Speed takes its parent's.
+	if b.Speed != 50 || mover.Speed != 50 || mover.Direction != (rl.Vector2{X: 1}) {
+		t.Errorf("speed %v, mover %+v", b.Speed, mover)
+	}
+
+	// When both hold, the transition of the parent goes first.
+	ticks := 0
+	for c.State == "walk" && ticks < TICK_RATE {
+		c.Run(machine, b)
+		ticks++
+	}
+	if c.State != "rest" || ticks < TICK_RATE/2-1 || ticks > TICK_RATE/2+1 {
+		t.Fatalf("in %q after %d ticks", c.State, ticks)
+	}
+	if b.Speed != 20 || mover.Speed != 0 || mover.Direction != (rl.Vector2{}) {
+		t.Errorf("speed %v, mover %+v at rest", b.Speed, mover)
+	}
+}
+
+// Stopping leaves how the entity accelerates, brakes and falls alone.
+func TestBlackboardMoveKeepsMotion(t *testing.T) {
+	mover := Movement{Direction: rl.Vector2{X: 1}, Speed: 50, Velocity: rl.Vector2{X: 30}, Acceleration: 5, Drag: 2, MaxSpeed: 100, GravityScale: 1}
+	b := machineWorld(t, &mover)
+	b.Speed = 40
+	AI_ACTIONS["hold"](b)
+	want := Movement{Acceleration: 5, Drag: 2, MaxSpeed: 100, GravityScale: 1}
+	if mover != want {
+		t.Errorf("held %+v, want %+v", mover, want)
+	}
+	AI_ACTIONS["chase"](b)
+	want.Direction, want.Speed = rl.Vector2{X: 1}, 40
+	if mover != want {
+		t.Errorf("chasing %+v, want %+v", mover, want)
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"math"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+// ===ARENA===
+
+// Arena is the playfield of a level. In a wrapping arena whatever leaves one
+// edge comes back on the opposite one, so there are no borders to die on.
+type Arena struct {
+	Width  float32
+	Height float32
+	Wrap   bool
+}
+
+func (a Arena) WrapPoint(v rl.Vector2) rl.Vector2 {
+	if !a.Wrap {
+		return v
+	}
+	return rl.Vector2{X: wrapf(v.X, a.Width), Y: wrapf(v.Y, a.Height)}
+}
+
+// Delta is the shortest vector from one point to another, which in a wrapping
+// arena may go through the seam.
+func (a Arena) Delta(from, to rl.Vector2) rl.Vector2 {
+	d := rl.Vector2Subtract(to, from)
+	if !a.Wrap {
+		return d
+	}
+	if d.X > a.Width/2 {
+		d.X -= a.Width
+	} else if d.X < -a.Width/2 {
+		d.X += a.Width
+	}
+	if d.Y > a.Height/2 {
+		d.Y -= a.Height
+	} else if d.Y < -a.Height/2 {
+		d.Y += a.Height
+	}
+	return d
+}
+
+// Nearest returns the copy of to that is closest to from, so that two boxes
+// on either side of the seam can be tested as if they were side by side.
+func (a Arena) Nearest(from, to Position) Position {
+	d := a.Delta(rl.Vector2{X: from.X, Y: from.Y}, rl.Vector2{X: to.X, Y: to.Y})
+	return Position{X: from.X + d.X, Y: from.Y + d.Y}
+}
+
+// Images returns every place a box of the given size at x, y has to be drawn
+// at, more than one when it straddles a seam on any side.
+func (a Arena) Images(x, y, width, height float32) []rl.Vector2 {
+	if !a.Wrap {
+		return []rl.Vector2{{X: x, Y: y}}
+	}
+	xs := seamImages(x, width, a.Width)
+	ys := seamImages(y, height, a.Height)
+	images := make([]rl.Vector2, 0, len(xs)*len(ys))
+	for _, iy := range ys {
+		for _, ix := range xs {
+			images = append(images, rl.Vector2{X: ix, Y: iy})
+		}
+	}
+	return images
+}
+
+// seamImages returns where along one axis a span from v of the given size is
+// drawn in an arena that wraps at limit.
+func seamImages(v, size, limit float32) []float32 {
+	images := []float32{v}
+	if v+size > limit {
+		images = append(images, v-limit)
+	}
+	if v < 0 {
+		images = append(images, v+limit)
+	}
+	return images
+}
+
+func (a Arena) Contains(box AABB) bool {
+	return box.Max.X > 0 && box.Min.X < a.Width && box.Max.Y > 0 && box.Min.Y < a.Height
+}
+
+func wrapf(v, size float32) float32 {
+	v = float32(math.Mod(float64(v), float64(size)))
+	if v < 0 {
+		v += size
+	}
+	return v
+}
+
+// +++++++++++
+// ArenaSystem brings movers back inside a wrapping arena and drops
+// projectiles that left a walled one.
+type ArenaSystem struct {
+	BaseSystem
+}
+
+func (s *ArenaSystem) Update(dt float32) {
+	arena := s.World.gameState.arena
+	var lost []Entity
+
+	archetypes := s.World.Query(positionID, movementID)
+	for archIdx := range archetypes {
+		entities := archetypes[archIdx].Entities
+		position := archetypes[archIdx].Components[positionID].([]Position)
+		collider, itCollides := archetypes[archIdx].Components[collidesID].([]Collides)
+		player, isPlayer := archetypes[archIdx].Components[playerControlledID].([]PlayerControlled)
+		_, isProjectile := archetypes[archIdx].Components[projectileID].([]Projectile)
+		for idx := range entities {
+			if !arena.Wrap {
+				if isProjectile && itCollides && !arena.Contains(collider[idx].AABB(position[idx])) {
+					lost = append(lost, entities[idx])
+				}
+				continue
+			}
+
+			wrapped := arena.WrapPoint(rl.Vector2{X: position[idx].X, Y: position[idx].Y})
+			if itCollides {
+				collider[idx].X += wrapped.X - position[idx].X
+				collider[idx].Y += wrapped.Y - position[idx].Y
+			}
+			position[idx] = Position{X: wrapped.X, Y: wrapped.Y}
+			if isPlayer {
+				for i := range player[idx].Body {
+					player[idx].Body[i] = arena.WrapPoint(player[idx].Body[i])
+				}
+			}
+		}
+	}
+
+	for _, entity := range lost {
+		s.World.RemoveEntity(entity)
+	}
+}
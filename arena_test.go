@@ -0,0 +1,34 @@
+package main
+
+import (
+	"slices"
+	"testing"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+func TestArenaImages(t *testing.T) {
+	wrapping := Arena{Width: 100, Height: 80, Wrap: true}
+	tests := []struct {
+		name  string
+		arena Arena
+		x, y  float32
+		want  []rl.Vector2
+	}{
+		{"inside", wrapping, 10, 10, []rl.Vector2{{X: 10, Y: 10}}},
+		{"walled", Arena{Width: 100, Height: 80}, 95, 75, []rl.Vector2{{X: 95, Y: 75}}},
+		{"right", wrapping, 95, 10, []rl.Vector2{{X: 95, Y: 10}, {X: -5, Y: 10}}},
+		{"left", wrapping, -5, 10, []rl.Vector2{{X: -5, Y: 10}, {X: 95, Y: 10}}},
+		{"bottom", wrapping, 10, 75, []rl.Vector2{{X: 10, Y: 75}, {X: 10, Y: -5}}},
+		{"top", wrapping, 10, -5, []rl.Vector2{{X: 10, Y: -5}, {X: 10, Y: 75}}},
+		{"corner", wrapping, -5, 75, []rl.Vector2{{X: -5, Y: 75}, {X: 95, Y: 75}, {X: -5, Y: -5}, {X: 95, Y: -5}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.arena.Images(tt.x, tt.y, 10, 10)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Images(%v, %v) = %v, want %v", tt.x, tt.y, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/binary"
+	"math"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+// ===AUDIO===
+
+const AUDIO_SAMPLE_RATE = 22050
+
+// Sound is a file to play, or when there is none a beep of Tone hertz lasting
+// Length seconds.
+type Sound struct {
+	File   string
+	Tone   float32
+	Length float32
+}
+
+// Audio plays the sounds of events, loading each one the first time it comes.
+type Audio struct {
+	sounds map[Sound]rl.Sound
+}
+
+func NewAudio() *Audio {
+	rl.InitAudioDevice()
+	return &Audio{sounds: make(map[Sound]rl.Sound)}
+}
+
+func (a *Audio) Close() {
+	for _, sound := range a.sounds {
+		rl.UnloadSound(sound)
+	}
+	rl.CloseAudioDevice()
+}
+
+func (a *Audio) Play(events []Event) {
+	for _, e := range events {
+		if e.Sound == (Sound{}) {
+			continue
+		}
+		sound, ok := a.sounds[e.Sound]
+		if !ok {
+			sound = loadSound(e.Sound)
+			a.sounds[e.Sound] = sound
+		}
+		// Files that failed to load give empty sounds.
+		if sound.FrameCount > 0 {
+			rl.PlaySound(sound)
+		}
+	}
+}
+
+func loadSound(sound Sound) rl.Sound {
+	if sound.File != "" {
+		return rl.LoadSound(sound.File)
+	}
+	frames := int(sound.Length * AUDIO_SAMPLE_RATE)
+	if frames <= 0 {
+		return rl.Sound{}
+	}
+	data := make([]byte, 2*frames)
+	for i := range frames {
+		t := float64(i) / AUDIO_SAMPLE_RATE
+		// Fading out keeps the end from clicking.
+		fade := 1 - float64(i)/float64(frames)
+		sample := math.Sin(2*math.Pi*float64(sound.Tone)*t) * fade * 0.3
+		binary.LittleEndian.PutUint16(data[2*i:], uint16(int16(sample*math.MaxInt16)))
+	}
+	return rl.LoadSoundFromWave(rl.NewWave(uint32(frames), AUDIO_SAMPLE_RATE, 16, 1, data))
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// ===BATCH===
+//
+// RunBatch plays games without a window, as fast as the workers go, with bots
+// on every snake. Game i plays level i modulo the level count with seed
+// Seed+i, so a batch always plays the same games and any one of them can be
+// played again on its own. What to tune is what the levels and prefabs say,
+// load other ones to compare, or override the figures of BatchConfig.
+
+type BatchConfig struct {
+	Games    int
+	Workers  int
+	Seed     uint64
+	Mode     GameMode
+	MaxTicks uint64
+	// MaxCandies, when above 0, replaces the candy count of every level.
+	MaxCandies int
+	// CandyTypes, when set, replaces the candy types of every level.
+	CandyTypes []CandyType
+	// MarchSpeed and FireRate, when above 0, multiply those of every wave.
+	MarchSpeed float32
+	FireRate   float32
+}
+
+// GameStats is how one game of a batch went. Winner is -1 when nobody won.
+type GameStats struct {
+	Game    int
+	Seed    uint64
+	Level   string
+	Mode    GameMode
+	Ticks   uint64
+	Winner  int
+	Players []PlayerStats
+}
+
+type PlayerStats struct {
+	Player  int
+	Score   int
+	Candies int
+	Kills   int
+	// Survived is how many ticks the player lasted, all of them if alive.
+	Survived uint64
+	// Cause is what the player died of, "" when they were still alive.
+	Cause string
+}
+
+func RunBatch(levels []*Level, prefabs Prefabs, config BatchConfig) ([]GameStats, error) {
+	if len(levels) == 0 {
+		return nil, fmt.Errorf("no levels to play")
+	}
+	if config.Mode.Players() < 1 {
+		return nil, fmt.Errorf("%s has no players for bots", config.Mode)
+	}
+	games := make([]GameStats, config.Games)
+	errs := make([]error, config.Games)
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for range max(config.Workers, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				games[i], errs[i] = playBatchGame(levels[i%len(levels)], prefabs, config, i)
+			}
+		}()
+	}
+	for i := range config.Games {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			return nil, fmt.Errorf("game %d: %w", i, err)
+		}
+	}
+	return games, nil
+}
+
+func playBatchGame(level *Level, prefabs Prefabs, config BatchConfig, game int) (GameStats, error) {
+	w := NewWorld()
+	w.prefabs = prefabs
+	seed := config.Seed + uint64(game)
+	w.Seed(seed)
+	if err := level.Build(w, config.Mode); err != nil {
+		return GameStats{}, err
+	}
+	if config.MaxCandies > 0 {
+		w.gameState.maxCandies = config.MaxCandies
+	}
+	if len(config.CandyTypes) > 0 {
+		if err := checkCandyTypes(w, config.CandyTypes); err != nil {
+			return GameStats{}, err
+		}
+		w.gameState.candyTypes = config.CandyTypes
+	}
+	if w.gameState.waves != nil && (config.MarchSpeed > 0 || config.FireRate > 0) {
+		// The levels share their waves, every game scales a copy.
+		waves := *w.gameState.waves
+		waves.Waves = slices.Clone(waves.Waves)
+		for i := range waves.Waves {
+			if config.MarchSpeed > 0 {
+				waves.Waves[i].MarchSpeed *= config.MarchSpeed
+			}
+			if config.FireRate > 0 {
+				waves.Waves[i].FireRate *= config.FireRate
+			}
+		}
+		w.gameState.waves = &waves
+	}
+	for i := range w.gameState.players {
+		w.MakeBot(i)
+	}
+
+	stats := GameStats{Game: game, Seed: seed, Level: level.Name, Mode: config.Mode, Winner: -1}
+	survived := make([]uint64, len(w.gameState.players))
+	sim := NewSimulation(w)
+	for w.state == PLAY && (config.MaxTicks == 0 || w.tick < config.MaxTicks) {
+		sim.Step(nil)
+		for i, p := range w.gameState.players {
+			if p.Alive {
+				survived[i] = w.tick
+			}
+		}
+	}
+
+	stats.Ticks = w.tick
+	if winner, ok := w.Winner(); ok && w.state == DEAD {
+		stats.Winner = winner
+	}
+	for i, p := range w.gameState.players {
+		player := PlayerStats{Player: i, Score: p.Score, Candies: p.Candies, Kills: p.Kills, Survived: survived[i]}
+		if !p.Alive {
+			player.Cause = p.Cause
+		}
+		stats.Players = append(stats.Players, player)
+	}
+	return stats, nil
+}
+
+// +++++++++++
+
+// WriteBatchCSV writes a row for every player of every game.
+func WriteBatchCSV(w io.Writer, games []GameStats) error {
+	out := csv.NewWriter(w)
+	out.Write([]string{"game", "seed", "level", "mode", "ticks", "winner", "player", "score", "candies", "kills", "survived", "cause"})
+	for _, g := range games {
+		for _, p := range g.Players {
+			out.Write([]string{
+				strconv.Itoa(g.Game),
+				strconv.FormatUint(g.Seed, 10),
+				g.Level,
+				g.Mode.String(),
+				strconv.FormatUint(g.Ticks, 10),
+				strconv.Itoa(g.Winner + 1),
+				strconv.Itoa(p.Player + 1),
+				strconv.Itoa(p.Score),
+				strconv.Itoa(p.Candies),
+				strconv.Itoa(p.Kills),
+				strconv.FormatUint(p.Survived, 10),
+				p.Cause,
+			})
+		}
+	}
+	out.Flush()
+	return out.Error()
+}
+
+// BatchSummary averages the players of every game played on a level.
+type BatchSummary struct {
+	Level        string
+	Games        int
+	MeanTicks    float64
+	MeanSurvived float64
+	MeanScore    float64
+	MeanCandies  float64
+	MeanKills    float64
+	// Causes counts the deaths of each cause, "alive" for the survivors.
+	Causes map[string]int
+}
+
+func SummarizeBatch(games []GameStats) []BatchSummary {
+	byLevel := make(map[string]*BatchSummary)
+	players := make(map[string]int)
+	for _, g := range games {
+		s, ok := byLevel[g.Level]
+		if !ok {
+			s = &BatchSummary{Level: g.Level, Causes: make(map[string]int)}
+			byLevel[g.Level] = s
+		}
+		s.Games++
+		s.MeanTicks += float64(g.Ticks)
+		for _, p := range g.Players {
+			players[g.Level]++
+			s.MeanSurvived += float64(p.Survived)
+			s.MeanScore += float64(p.Score)
+			s.MeanCandies += float64(p.Candies)
+			s.MeanKills += float64(p.Kills)
+			cause := p.Cause
+			if cause == "" {
+				cause = "alive"
+			}
+			s.Causes[cause]++
+		}
+	}
+
+	var summaries []BatchSummary
+	for level, s := range byLevel {
+		n := float64(max(players[level], 1))
+		s.MeanTicks /= float64(s.Games)
+		s.MeanSurvived /= n
+		s.MeanScore /= n
+		s.MeanCandies /= n
+		s.MeanKills /= n
+		summaries = append(summaries, *s)
+	}
+	sort.Slice(summaries, func(i, j int) bool { return summaries[i].Level < summaries[j].Level })
+	return summaries
+}
+
+// WriteBatchJSON writes the config, the summary of every level and every game.
+func WriteBatchJSON(w io.Writer, config BatchConfig, games []GameStats) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(struct {
+		Config  BatchConfig
+		Summary []BatchSummary
+		Games   []GameStats
+	}{config, SummarizeBatch(games), games})
+}
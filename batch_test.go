@@ -0,0 +1,112 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func batchLevels(t *testing.T) ([]*Level, Prefabs) {
+	t.Helper()
+	prefabs, err := LoadPrefabs(PREFABS_PATH)
+	if err != nil {
+		t.Fatal(err)
+	}
+	paths, err := ListLevels(LEVELS_DIR)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var levels []*Level
+	for _, path := range paths {
+		level, err := LoadLevel(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		levels = append(levels, level)
+	}
+	return levels, prefabs
+}
+
+func TestRunBatchWorkers(t *testing.T) {
+	levels, prefabs := batchLevels(t)
+	config := BatchConfig{Games: 8, Seed: 3, Mode: VERSUS, MaxTicks: 20 * TICK_RATE}
+	var want []GameStats
+	for _, workers := range []int{1, 3, 8} {
+		config.Workers = workers
+		games, err := RunBatch(levels, prefabs, config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want == nil {
+			want = games
+			continue
+		}
+		if !reflect.DeepEqual(games, want) {
+			t.Errorf("%d workers played other games than 1", workers)
+		}
+	}
+}
+
+func TestRunBatchOverrides(t *testing.T) {
+	levels, prefabs := batchLevels(t)
+	var invaders []*Level
+	for _, level := range levels {
+		if level.Waves != nil {
+			invaders = append(invaders, level)
+		}
+	}
+	if len(invaders) == 0 {
+		t.Fatal("no level with waves")
+	}
+	march, fire := invaders[0].Waves.Waves[0].MarchSpeed, invaders[0].Waves.Waves[0].FireRate
+
+	config := BatchConfig{Games: 4, Workers: 4, Seed: 3, Mode: SOLO, MaxTicks: 20 * TICK_RATE}
+	plain, err := RunBatch(invaders, prefabs, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tune := range []func(*BatchConfig){
+		func(c *BatchConfig) { c.MarchSpeed, c.FireRate = 4, 20 },
+		func(c *BatchConfig) { c.CandyTypes = []CandyType{{Prefab: "candy_gold", Weight: 1}} },
+	} {
+		tuned := config
+		tune(&tuned)
+		games, err := RunBatch(invaders, prefabs, tuned)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if reflect.DeepEqual(games, plain) {
+			t.Errorf("%+v played the same games as no overrides", tuned)
+		}
+	}
+	if got := invaders[0].Waves.Waves[0]; got.MarchSpeed != march || got.FireRate != fire {
+		t.Errorf("the level's waves were scaled to %v and %v", got.MarchSpeed, got.FireRate)
+	}
+
+	config.CandyTypes = []CandyType{{Prefab: "player", Weight: 1}}
+	if _, err := RunBatch(invaders, prefabs, config); err == nil || !strings.Contains(err.Error(), `"player"`) {
+		t.Errorf("got error %v for a candy type that is no candy", err)
+	}
+}
+
+func TestSummarizeBatch(t *testing.T) {
+	games := []GameStats{
+		{Level: "b", Ticks: 100, Players: []PlayerStats{
+			{Score: 10, Candies: 1, Survived: 100},
+			{Score: 30, Candies: 3, Kills: 2, Survived: 50, Cause: "wall"},
+		}},
+		{Level: "a", Ticks: 60, Players: []PlayerStats{{Score: 5, Survived: 60, Cause: "self"}}},
+		{Level: "b", Ticks: 300, Players: []PlayerStats{
+			{Score: 20, Candies: 2, Kills: 1, Survived: 300},
+			{Score: 0, Survived: 10, Cause: "wall"},
+		}},
+	}
+	want := []BatchSummary{
+		{Level: "a", Games: 1, MeanTicks: 60, MeanSurvived: 60, MeanScore: 5, Causes: map[string]int{"self": 1}},
+		{Level: "b", Games: 2, MeanTicks: 200, MeanSurvived: 115, MeanScore: 15, MeanCandies: 1.5, MeanKills: 0.75,
+			Causes: map[string]int{"alive": 2, "wall": 2}},
+	}
+	if got := SummarizeBatch(games); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+// bossWorld is the invaders level with its first boss come in.
+func bossWorld(t *testing.T) (*World, *Simulation, Entity) {
+	t.Helper()
+	level, err := LoadLevel("levels/03_invaders.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := NewWorld()
+	if w.prefabs, err = LoadPrefabs(PREFABS_PATH); err != nil {
+		t.Fatal(err)
+	}
+	w.Seed(3)
+	if err := level.Build(w, SOLO); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.SpawnBoss(0); err != nil {
+		t.Fatal(err)
+	}
+	for _, archetype := range w.Query(bossID) {
+		return w, NewSimulation(w), archetype.Entities[0]
+	}
+	t.Fatal("no boss")
+	return nil, nil, 0
+}
+
+// hurtBoss leaves the weak points of boss with left of their health between
+// them, the first ones emptied first.
+func hurtBoss(w *World, boss Entity, left float32) {
+	b, _ := getComponent[Boss](w, boss, bossID)
+	damage := -int32(left * float32(b.MaxHealth))
+	for _, part := range b.Parts {
+		if health, ok := getComponent[Health](w, part, healthID); ok {
+			damage += health.Current
+		}
+	}
+	for _, part := range b.Parts {
+		if health, ok := getComponent[Health](w, part, healthID); ok {
+			hit := min(damage, health.Current)
+			health.Current -= hit
+			damage -= hit
+		}
+	}
+}
+
+func emitted(events []Event, kind EventKind) bool {
+	return slices.ContainsFunc(events, func(e Event) bool { return e.Kind == kind })
+}
+
+func TestBossPhases(t *testing.T) {
+	w, sim, boss := bossWorld(t)
+	phase := func(state string, index int) {
+		t.Helper()
+		ai, _ := getComponent[IAControlled](w, boss, IAControlledID)
+		b, _ := getComponent[Boss](w, boss, bossID)
+		if ai.State != state || b.Phase != index {
+			t.Fatalf("boss in %q, phase %d, want %q, phase %d", ai.State, b.Phase, state, index)
+		}
+	}
+
+	sim.Step([]InputFrame{0})
+	phase("calm", 0)
+	if mover, _ := getComponent[Movement](w, boss, movementID); mover.Speed != 40 {
+		t.Errorf("boss marches at %v, want 40", mover.Speed)
+	}
+	w.DrainEvents()
+
+	// A third down, but not below two thirds left, is still calm.
+	hurtBoss(w, boss, 0.7)
+	sim.Step([]InputFrame{0})
+	sim.Step([]InputFrame{0})
+	phase("calm", 0)
+
+	// The machine sees the health BossSystem counted the tick before.
+	hurtBoss(w, boss, 0.6)
+	sim.Step([]InputFrame{0})
+	sim.Step([]InputFrame{0})
+	phase("angry", 1)
+	if !emitted(w.DrainEvents(), EventBossPhase) {
+		t.Errorf("no phase event")
+	}
+	if mover, _ := getComponent[Movement](w, boss, movementID); mover.Speed != 60 {
+		t.Errorf("boss marches at %v, want 60", mover.Speed)
+	}
+
+	// The minion of the phase comes as soon as it is due.
+	b, _ := getComponent[Boss](w, boss, bossID)
+	b.Summons[0] = 0
+	sim.Step([]InputFrame{0})
+	if b, _ = getComponent[Boss](w, boss, bossID); len(b.Minions) != 1 {
+		t.Fatalf("%d minions, want 1", len(b.Minions))
+	}
+	minion := b.Minions[0].Entity
+
+	hurtBoss(w, boss, 0.2)
+	sim.Step([]InputFrame{0})
+	sim.Step([]InputFrame{0})
+	phase("furious", 2)
+
+	hurtBoss(w, boss, 0)
+	sim.Step([]InputFrame{0})
+	if !emitted(w.DrainEvents(), EventBossDefeated) {
+		t.Errorf("no defeat event")
+	}
+	if w.HasComponent(boss, bossID) || w.HasComponent(minion, enemyID) {
+		t.Errorf("boss or its minion still about")
+	}
+}
+
+func TestBossNeedsMachine(t *testing.T) {
+	w, _, _ := bossWorld(t)
+	d := w.gameState.waves.Bosses[0]
+	delete(w.prefabs[d.Prefab].Components, IAControlledID)
+	if err := checkBoss(w, d); err == nil {
+		t.Errorf("a boss without a machine passes")
+	}
+}
@@ -0,0 +1,421 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"slices"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+// ===BOSSES===
+//
+// Every BossEvery waves of a waves file the wave is a boss instead of a
+// formation, the next one of its Bosses:
+//
+//	"BossEvery": 5,
+//	"Bosses": [{
+//		"Name": "MOTHERSHIP", "Prefab": "boss_core", "Top": 60,
+//		"Parts": [
+//			{"Prefab": "boss_armour", "Offset": {"X": 0, "Y": 0}},
+//			{"Prefab": "boss_eye", "Offset": {"X": 68, "Y": 30}}
+//		]
+//	}]
+//
+// The core is drawn and moves, its parts follow it and are what gets hit.
+// Parts with Health are its weak points, the others armour that stops shots,
+// and the boss is beaten once no weak point is left. What it does is up to
+// the machine of the core, whose states are its phases. Each one comes with
+// its speed, its bullet patterns and the minions it summons, and the next
+// one starts once the weak points are hurt below some of their health:
+//
+//	"machine": {
+//		"Initial": "calm",
+//		"States": {
+//			"phase": {"Action": "boss"},
+//			"calm": {"Parent": "phase", "Enter": "boss_phase", "Speed": 40,
+//				"Patterns": [{"Kind": "spread", "Every": 2, "Shots": 5, "Angle": 60}],
+//				"Transitions": [{"If": [{"Is": "hurt_below", "Value": 0.5}], "To": "angry"}]},
+//			"angry": {"Parent": "phase", "Enter": "boss_phase", "Speed": 70,
+//				"Patterns": [{"Kind": "spiral", "Every": 0.3, "Shots": 4, "Angle": 17}],
+//				"Minions": [{"Prefab": "invader_diver", "Every": 6, "Max": 2}]}
+//		}
+//	}
+//
+// The patterns are:
+//
+//	spread  Shots shots fanned over Angle degrees, down
+//	spiral  Shots shots all round, turned Angle degrees more every time
+//	aimed   bursts of Shots shots at the nearest snake, Gap seconds apart
+//
+// each fired every Every seconds from the middle of the boss, at Speed, or
+// ENEMY_SHOT_SPEED without one. At most Max of a minion are about at once.
+
+type BossDef struct {
+	Name   string
+	Prefab string
+	Parts  []BossPartDef
+	// Top is how far down from the top of the arena the boss comes in.
+	Top float32
+}
+
+type BossPartDef struct {
+	Prefab string
+	Offset rl.Vector2
+}
+
+type BulletPattern struct {
+	Kind  string
+	Every float32
+	Shots int
+	Angle float32
+	Gap   float32
+	Speed float32
+}
+
+type BossMinion struct {
+	Prefab string
+	Every  float32
+	Max    int
+}
+
+// PatternState is where a boss is in firing a pattern: Timer to the next
+// volley, Spin for spirals and the shots of a burst left with BurstTimer to
+// the next one.
+type PatternState struct {
+	Timer      float32
+	Spin       float32
+	Burst      int
+	BurstTimer float32
+}
+
+// BossMinionEntity is a minion summoned as the Def-th minion of its phase.
+type BossMinionEntity struct {
+	Def    int
+	Entity Entity
+}
+
+var BULLET_PATTERNS = []string{"spread", "spiral", "aimed"}
+
+func (d BossDef) check() error {
+	if len(d.Parts) == 0 {
+		return fmt.Errorf("boss %q has no parts", d.Name)
+	}
+	return nil
+}
+
+// checkPattern makes sure p is a pattern there is and that it fires.
+func checkPattern(p BulletPattern) error {
+	if !slices.Contains(BULLET_PATTERNS, p.Kind) {
+		return fmt.Errorf("unknown pattern %q", p.Kind)
+	}
+	if p.Every <= 0 || p.Shots <= 0 {
+		return fmt.Errorf("%s pattern needs Every and Shots", p.Kind)
+	}
+	return nil
+}
+
+// checkBoss makes sure every prefab of d spawns, that its core has a machine
+// and that it can be beaten.
+func checkBoss(w *World, d BossDef) error {
+	prefabs := []string{d.Prefab}
+	weak := false
+	for _, part := range d.Parts {
+		prefabs = append(prefabs, part.Prefab)
+		if prefab, ok := w.prefabs[part.Prefab]; ok {
+			_, hasHealth := prefab.Components[healthID]
+			weak = weak || hasHealth
+		}
+	}
+	machine := w.bossMachine(d)
+	if machine == nil {
+		return fmt.Errorf("boss %q: %q runs no machine", d.Name, d.Prefab)
+	}
+	for _, state := range machine.States {
+		for _, minion := range state.Minions {
+			prefabs = append(prefabs, minion.Prefab)
+		}
+	}
+	for _, name := range prefabs {
+		if _, ok := w.prefabs[name]; !ok {
+			return fmt.Errorf("boss %q: unknown prefab %q", d.Name, name)
+		}
+	}
+	if !weak {
+		return fmt.Errorf("boss %q has no part with health", d.Name)
+	}
+	return nil
+}
+
+// bossMachine returns the machine the core of d runs, if any.
+func (w *World) bossMachine(d BossDef) *Machine {
+	ai, ok := w.PrefabComponent(d.Prefab, IAControlledID).(IAControlled)
+	if !ok {
+		return nil
+	}
+	if prefab, ok := w.prefabs[ai.Machine]; ok {
+		return prefab.Machine
+	}
+	return nil
+}
+
+// SpawnBoss brings in the def-th boss of the waves, centred at its Top.
+func (w *World) SpawnBoss(def int) error {
+	d := w.gameState.waves.Bosses[def]
+	var width float32
+	for _, part := range d.Parts {
+		collider, _ := w.PrefabComponent(part.Prefab, collidesID).(Collides)
+		width = max(width, part.Offset.X+collider.Width)
+	}
+	at := Position{X: (w.gameState.arena.Width - width) / 2, Y: d.Top}
+
+	boss := Boss{Def: def, Phase: -1, March: 1}
+	core, err := w.Spawn(d.Prefab, map[ComponentID]any{positionID: at})
+	if err != nil {
+		return err
+	}
+	for _, part := range d.Parts {
+		entity, err := w.Spawn(part.Prefab, map[ComponentID]any{
+			positionID: Position{X: at.X + part.Offset.X, Y: at.Y + part.Offset.Y},
+			bossPartID: BossPart{Boss: core, Offset: part.Offset},
+		})
+		if err != nil {
+			return err
+		}
+		boss.Parts = append(boss.Parts, entity)
+		if health, ok := w.PrefabComponent(part.Prefab, healthID).(Health); ok {
+			boss.MaxHealth += health.Max
+		}
+	}
+	boss.Health = boss.MaxHealth
+	w.AddComponent(core, map[ComponentID]any{bossID: boss})
+	return nil
+}
+
+// +++++++++++
+// BossSystem keeps the parts of every boss on its core, counts what is left of
+// its weak points and takes it away once beaten. Its machine does the rest.
+type BossSystem struct {
+	BaseSystem
+}
+
+func (s *BossSystem) Update(dt float32) {
+	var beaten []Entity
+	for _, archetype := range s.World.Query(bossID, positionID) {
+		boss := archetype.Components[bossID].([]Boss)
+		position := archetype.Components[positionID].([]Position)
+		for idx, entity := range archetype.Entities {
+			b := &boss[idx]
+			b.Parts = slices.DeleteFunc(b.Parts, func(part Entity) bool { return !s.World.HasComponent(part, bossPartID) })
+			b.Minions = slices.DeleteFunc(b.Minions, func(m BossMinionEntity) bool { return !s.World.HasComponent(m.Entity, enemyID) })
+
+			b.Health = 0
+			for _, part := range b.Parts {
+				s.follow(part, position[idx])
+				if health, ok := getComponent[Health](s.World, part, healthID); ok {
+					b.Health += max(health.Current, 0)
+				}
+			}
+			if b.Health <= 0 {
+				beaten = append(beaten, entity)
+			}
+		}
+	}
+	for _, entity := range beaten {
+		s.beat(entity)
+	}
+}
+
+// follow puts part where it goes on the core at core.
+func (s *BossSystem) follow(part Entity, core Position) {
+	position, _ := getComponent[Position](s.World, part, positionID)
+	bp, ok := getComponent[BossPart](s.World, part, bossPartID)
+	if !ok || position == nil {
+		return
+	}
+	*position = Position{X: core.X + bp.Offset.X, Y: core.Y + bp.Offset.Y}
+	if collider, ok := getComponent[Collides](s.World, part, collidesID); ok {
+		collider.X, collider.Y = position.X, position.Y
+	}
+}
+
+// bossArea is the box round the parts of b.
+func (w *World) bossArea(b *Boss) (AABB, bool) {
+	var area AABB
+	found := false
+	for _, part := range b.Parts {
+		position, ok := getComponent[Position](w, part, positionID)
+		if !ok {
+			continue
+		}
+		box := NewAABB(position.X, position.Y, 0, 0)
+		if collider, ok := getComponent[Collides](w, part, collidesID); ok {
+			box = collider.AABB(*position)
+		}
+		if !found {
+			area, found = box, true
+		}
+		area = area.Union(box)
+	}
+	return area, found
+}
+
+// enterPhase starts the patterns and summons of phase over.
+func (b *Boss) enterPhase(phase MachineState) {
+	b.Phase++
+	b.Patterns = make([]PatternState, len(phase.Patterns))
+	for i, pattern := range phase.Patterns {
+		b.Patterns[i].Timer = pattern.Every
+	}
+	b.Summons = make([]float32, len(phase.Minions))
+	for i, minion := range phase.Minions {
+		b.Summons[i] = minion.Every
+	}
+}
+
+// attack marches the boss of b from side to side at the speed of its state,
+// fires the patterns of the state and summons its minions.
+func (b *Blackboard) attack() {
+	boss := b.Boss
+	area, ok := b.World.bossArea(boss)
+	if !ok {
+		return
+	}
+	arena := b.World.gameState.arena
+	if (area.Min.X <= RECTSIZE && boss.March < 0) || (area.Max.X >= arena.Width-RECTSIZE && boss.March > 0) {
+		boss.March = -boss.March
+	}
+	b.move(rl.Vector2{X: boss.March})
+
+	// A state entered without boss_phase has nothing started to fire.
+	phase := b.State
+	if len(boss.Patterns) != len(phase.Patterns) || len(boss.Summons) != len(phase.Minions) {
+		return
+	}
+	center := area.Center()
+	for i, pattern := range phase.Patterns {
+		for _, direction := range b.World.firePattern(&boss.Patterns[i], pattern, center, b.dt) {
+			*b.later = append(*b.later, bossShot(b.World, b.Entity, center, direction, pattern.Speed))
+		}
+	}
+	for i, minion := range phase.Minions {
+		boss.Summons[i] -= b.dt
+		if boss.Summons[i] > 0 {
+			continue
+		}
+		boss.Summons[i] = minion.Every
+		about := 0
+		for _, m := range boss.Minions {
+			if m.Def == i {
+				about++
+			}
+		}
+		if about < minion.Max {
+			*b.later = append(*b.later, bossSummon(b.World, b.Entity, i, minion.Prefab, Position{X: center.X, Y: area.Max.Y}))
+		}
+	}
+}
+
+// firePattern runs pattern on by dt, returning the directions of the shots to
+// fire.
+func (w *World) firePattern(st *PatternState, pattern BulletPattern, from rl.Vector2, dt float32) []rl.Vector2 {
+	var shots []rl.Vector2
+	if pattern.Kind == "aimed" && st.Burst > 0 {
+		st.BurstTimer -= dt
+		if st.BurstTimer <= 0 {
+			st.Burst--
+			st.BurstTimer = pattern.Gap
+			if head, ok := w.nearestHead(Position{X: from.X, Y: from.Y}); ok {
+				shots = append(shots, w.aim(NewAABB(from.X, from.Y, 0, 0), head))
+			}
+		}
+	}
+
+	st.Timer -= dt
+	if st.Timer > 0 {
+		return shots
+	}
+	st.Timer = pattern.Every
+	switch pattern.Kind {
+	case "spread":
+		for i := range pattern.Shots {
+			angle := 90.0
+			if pattern.Shots > 1 {
+				angle += float64(pattern.Angle) * (float64(i)/float64(pattern.Shots-1) - 0.5)
+			}
+			shots = append(shots, angleVector(angle))
+		}
+	case "spiral":
+		for i := range pattern.Shots {
+			shots = append(shots, angleVector(float64(st.Spin)+360*float64(i)/float64(pattern.Shots)))
+		}
+		st.Spin = float32(math.Mod(float64(st.Spin+pattern.Angle), 360))
+	case "aimed":
+		st.Burst, st.BurstTimer = pattern.Shots, 0
+	}
+	return shots
+}
+
+// angleVector is the direction degrees clockwise from right, down the screen.
+func angleVector(degrees float64) rl.Vector2 {
+	rad := degrees * math.Pi / 180
+	return rl.Vector2{X: float32(math.Cos(rad)), Y: float32(math.Sin(rad))}
+}
+
+func bossShot(w *World, owner Entity, from, direction rl.Vector2, speed float32) func() {
+	return func() {
+		if speed == 0 {
+			speed = ENEMY_SHOT_SPEED
+		}
+		if err := SpawnEnemyShot(w, owner, from.X-2, from.Y, direction, speed); err != nil {
+			log.Println("boss:", err)
+		}
+	}
+}
+
+// bossSummon brings in the def-th minion of the phase of boss, centred on at
+// or beside it, wherever there is room. With no room it doesn't come.
+func bossSummon(w *World, boss Entity, def int, prefab string, at Position) func() {
+	return func() {
+		collider, _ := w.PrefabComponent(prefab, collidesID).(Collides)
+		x := at.X - collider.Width/2
+		spot, err := w.FindSpawn(SpawnRules{
+			Points:    []rl.Vector2{{X: x, Y: at.Y}, {X: x - collider.Width, Y: at.Y}, {X: x + collider.Width, Y: at.Y}},
+			Size:      rl.Vector2{X: collider.Width, Y: collider.Height},
+			SolidOnly: true,
+		})
+		if err != nil {
+			return
+		}
+		minion, err := w.Spawn(prefab, map[ComponentID]any{positionID: spot})
+		if err != nil {
+			log.Println("boss:", err)
+			return
+		}
+		if b, ok := getComponent[Boss](w, boss, bossID); ok {
+			b.Minions = append(b.Minions, BossMinionEntity{Def: def, Entity: minion})
+		}
+	}
+}
+
+// beat takes away a boss with no weak point left, with its armour and minions.
+func (s *BossSystem) beat(entity Entity) {
+	b, ok := getComponent[Boss](s.World, entity, bossID)
+	if !ok {
+		return
+	}
+	event := Event{Kind: EventBossDefeated, Entity: entity, Wave: s.World.gameState.wave}
+	if position, ok := getComponent[Position](s.World, entity, positionID); ok {
+		event.Position = *position
+	}
+	s.World.Emit(event)
+	gone := slices.Clone(b.Parts)
+	for _, m := range b.Minions {
+		gone = append(gone, m.Entity)
+	}
+	for _, e := range gone {
+		s.World.RemoveEntity(e)
+	}
+	s.World.RemoveEntity(entity)
+}
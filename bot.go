@@ -0,0 +1,397 @@
+package main
+
+import (
+	"log"
+	"math"
+	"slices"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+// ===BOTS===
+//
+// Bots plan on a grid of RECTSIZE cells laid over the arena. Everything solid,
+// every snake body and the lane ahead of every projectile blocks the cells it
+// covers, and a breadth first search looks for the closest cell touching a
+// candy. When there is none to reach the bot chases its own tail, which keeps
+// moving out of the way, and failing that heads where it has the most room.
+//
+// Snakes move smoothly, so a bot plans from the grid line ahead of its head
+// and only turns on the tick before the head gets there. That keeps it within
+// a step of the cells it planned on. Bodies cut corners as they are dragged
+// along though, so a bot also looks a step ahead every tick, and when a body
+// is about to cross its way it turns off at once, planning from the closest
+// cell.
+
+const (
+	BOT_PROJECTILE_LOOKAHEAD = 4
+	BOT_FIRE_RANGE           = 200
+)
+
+var directionInputs = []InputFrame{InputUp, InputRight, InputDown, InputLeft}
+
+// botGrid is the arena as cells, with the ones a snake can't enter blocked.
+type botGrid struct {
+	cols, rows int
+	wrap       bool
+	blocked    []bool
+}
+
+func newBotGrid(arena Arena) *botGrid {
+	cols, rows := int(arena.Width/RECTSIZE), int(arena.Height/RECTSIZE)
+	return &botGrid{cols: cols, rows: rows, wrap: arena.Wrap, blocked: make([]bool, cols*rows)}
+}
+
+func (g *botGrid) clone() *botGrid {
+	c := *g
+	c.blocked = slices.Clone(g.blocked)
+	return &c
+}
+
+// cell returns the index of cell x, y, wrapping it around if the arena does.
+func (g *botGrid) cell(x, y int) (int, bool) {
+	if g.cols == 0 || g.rows == 0 {
+		return 0, false
+	}
+	if g.wrap {
+		x, y = (x%g.cols+g.cols)%g.cols, (y%g.rows+g.rows)%g.rows
+	}
+	if x < 0 || y < 0 || x >= g.cols || y >= g.rows {
+		return 0, false
+	}
+	return y*g.cols + x, true
+}
+
+func (g *botGrid) cellAt(pos Position) (int, bool) {
+	return g.cell(int(math.Round(float64(pos.X/RECTSIZE))), int(math.Round(float64(pos.Y/RECTSIZE))))
+}
+
+// cells calls f with every cell box overlaps, touching ones left out.
+func (g *botGrid) cells(box AABB, f func(i int)) {
+	x0, y0 := int(math.Floor(float64(box.Min.X/RECTSIZE))), int(math.Floor(float64(box.Min.Y/RECTSIZE)))
+	x1, y1 := int(math.Ceil(float64(box.Max.X/RECTSIZE))), int(math.Ceil(float64(box.Max.Y/RECTSIZE)))
+	for y := y0; y < y1; y++ {
+		for x := x0; x < x1; x++ {
+			if i, ok := g.cell(x, y); ok {
+				f(i)
+			}
+		}
+	}
+}
+
+func (g *botGrid) block(box AABB) {
+	g.cells(box, func(i int) { g.blocked[i] = true })
+}
+
+func (g *botGrid) neighbour(i, dir int) (int, bool) {
+	d := DIRECTIONS[dir]
+	n, ok := g.cell(i%g.cols+int(d.X), i/g.cols+int(d.Y))
+	return n, ok && !g.blocked[n]
+}
+
+// search walks out from start, never leaving it by direction skip, and
+// returns the direction of the first step towards the closest goal cell.
+func (g *botGrid) search(start, skip int, goal func(i int) bool) (int, bool) {
+	// first holds, for every cell reached, the way out of start towards it.
+	first := make([]int, len(g.blocked))
+	for i := range first {
+		first[i] = -1
+	}
+	var queue []int
+	for dir := range DIRECTIONS {
+		if n, ok := g.neighbour(start, dir); ok && dir != skip && first[n] < 0 {
+			first[n] = dir
+			queue = append(queue, n)
+		}
+	}
+	for len(queue) > 0 {
+		i := queue[0]
+		queue = queue[1:]
+		if goal(i) {
+			return first[i], true
+		}
+		for dir := range DIRECTIONS {
+			if n, ok := g.neighbour(i, dir); ok && first[n] < 0 && n != start {
+				first[n] = first[i]
+				queue = append(queue, n)
+			}
+		}
+	}
+	return 0, false
+}
+
+// room counts the free cells reachable from start.
+func (g *botGrid) room(start int) int {
+	seen := map[int]bool{start: true}
+	queue := []int{start}
+	for len(queue) > 0 {
+		i := queue[0]
+		queue = queue[1:]
+		for dir := range DIRECTIONS {
+			if n, ok := g.neighbour(i, dir); ok && !seen[n] {
+				seen[n] = true
+				queue = append(queue, n)
+			}
+		}
+	}
+	return len(seen)
+}
+
+func directionIndex(d rl.Vector2) int {
+	for i, dir := range DIRECTIONS {
+		if dir == d {
+			return i
+		}
+	}
+	return -1
+}
+
+// gridLine returns the first grid line at or ahead of p going towards sign.
+func gridLine(p, sign float32) float32 {
+	if sign > 0 {
+		return float32(math.Ceil(float64(p/RECTSIZE))) * RECTSIZE
+	}
+	return float32(math.Floor(float64(p/RECTSIZE))) * RECTSIZE
+}
+
+// +++++++++++
+// BotSystem picks the input of every entity with a Bot. Snakes of a player get
+// it as that player's input, anything else that moves is steered directly.
+// It must run before MovementSystem.
+type BotSystem struct {
+	BaseSystem
+}
+
+// botObstacle is a head or a body segment a snake dies running into.
+type botObstacle struct {
+	owner   Entity
+	segment int
+	box     AABB
+}
+
+func (s *BotSystem) Update(dt float32) {
+	bots := s.World.Query(positionID, movementID, botID)
+	if len(bots) == 0 {
+		return
+	}
+	arena := s.World.gameState.arena
+	grid := newBotGrid(arena)
+	goals := make(map[int]bool)
+	var obstacles []botObstacle
+	var solids, enemies []AABB
+
+	for _, archetype := range s.World.Query(positionID, collidesID) {
+		position := archetype.Components[positionID].([]Position)
+		collider := archetype.Components[collidesID].([]Collides)
+		mover, moves := archetype.Components[movementID].([]Movement)
+		_, isHead := archetype.Components[playerControlledID].([]PlayerControlled)
+		bunker, isBunker := archetype.Components[bunkerID].([]Bunker)
+		for idx, entity := range archetype.Entities {
+			box := collider[idx].AABB(position[idx])
+			switch {
+			case isBunker:
+				bunker[idx].EachCell(position[idx], func(cell AABB) {
+					grid.block(cell)
+					solids = append(solids, cell)
+				})
+			case archetype.Mask&candyID != 0:
+				grid.cells(box, func(i int) { goals[i] = true })
+			case archetype.Mask&projectileID != 0 && moves:
+				for k := range BOT_PROJECTILE_LOOKAHEAD + 1 {
+					grid.block(box.Translate(rl.Vector2Scale(mover[idx].Direction, float32(k)*RECTSIZE)))
+				}
+			case isHead:
+				obstacles = append(obstacles, botObstacle{entity, 0, box})
+			case !collider[idx].Trigger:
+				grid.block(box)
+				solids = append(solids, box)
+				if archetype.Mask&enemyID != 0 {
+					enemies = append(enemies, box)
+				}
+			}
+		}
+	}
+	for _, archetype := range s.World.Query(playerControlledID) {
+		player := archetype.Components[playerControlledID].([]PlayerControlled)
+		for idx, entity := range archetype.Entities {
+			body := player[idx].Body
+			for i := 1; i < len(body); i++ {
+				box := NewAABB(body[i].X, body[i].Y, RECTSIZE, RECTSIZE)
+				grid.block(box)
+				obstacles = append(obstacles, botObstacle{entity, i, box})
+			}
+		}
+	}
+
+	for _, archetype := range bots {
+		position := archetype.Components[positionID].([]Position)
+		mover := archetype.Components[movementID].([]Movement)
+		bot := archetype.Components[botID].([]Bot)
+		player, isPlayer := archetype.Components[playerControlledID].([]PlayerControlled)
+		for idx, entity := range archetype.Entities {
+			var body []rl.Vector2
+			if isPlayer {
+				body = player[idx].Body
+			}
+			g := grid.clone()
+			var dangers []AABB
+			for _, o := range obstacles {
+				if o.owner != entity {
+					dangers = append(dangers, o.box)
+					if o.segment == 0 {
+						g.block(o.box)
+					}
+				} else if o.segment >= SELF_SAFE_SEGMENTS {
+					dangers = append(dangers, o.box)
+				}
+			}
+			input := s.steer(g, goals, solids, dangers, position[idx], mover[idx], body, dt)
+			if bot[idx].Fire && s.enemyAhead(position[idx], mover[idx].Direction, enemies) {
+				input |= InputFire
+			}
+
+			if !isPlayer {
+				mover[idx] = GetInput(mover[idx], input)
+				continue
+			}
+			s.setInput(player[idx].Index, input)
+		}
+	}
+}
+
+// setInput replaces the input of player for this tick, leaving the frames the
+// tick was started with untouched.
+func (s *BotSystem) setInput(player int, input InputFrame) {
+	if player < 0 {
+		return
+	}
+	inputs := make([]InputFrame, max(len(s.World.inputs), player+1))
+	copy(inputs, s.World.inputs)
+	inputs[player] = input
+	s.World.inputs = inputs
+}
+
+// steer returns the input that keeps the head at pos on its way. It plans
+// from the grid line ahead of the head and turns, when its plan says so, on
+// the last tick before the head crosses it. When the head is about to run
+// into one of dangers it plans from the closest cell and turns at once.
+func (s *BotSystem) steer(g *botGrid, goals map[int]bool, solids, dangers []AABB, pos Position, mover Movement, body []rl.Vector2, dt float32) InputFrame {
+	current := directionIndex(mover.Direction)
+	step := max(mover.Speed, GetVectorLength(mover.Velocity)) * dt
+	at := pos
+	danger := false
+	if current >= 0 {
+		ahead := NewAABB(pos.X, pos.Y, RECTSIZE, RECTSIZE).Translate(rl.Vector2Scale(mover.Direction, step))
+		danger = s.hits(ahead, dangers)
+		if !danger {
+			if mover.Direction.X != 0 {
+				at.X = gridLine(pos.X, mover.Direction.X)
+			} else {
+				at.Y = gridLine(pos.Y, mover.Direction.Y)
+			}
+			if left := abs(at.X-pos.X) + abs(at.Y-pos.Y); left > 0 && left >= step {
+				return directionInputs[current]
+			}
+		}
+	}
+
+	start, ok := g.cellAt(at)
+	if !ok {
+		return 0
+	}
+	g.blocked[start] = false
+	// The head is up to a step off the grid, so a way out of start is only
+	// open when the lane the head really sweeps along it is clear.
+	head := NewAABB(pos.X, pos.Y, RECTSIZE, RECTSIZE)
+	for d := range DIRECTIONS {
+		lane := head.Union(head.Translate(rl.Vector2Scale(DIRECTIONS[d], RECTSIZE+step)))
+		if n, ok := g.cell(start%g.cols+int(DIRECTIONS[d].X), start/g.cols+int(DIRECTIONS[d].Y)); ok && (s.hits(lane, solids) || s.hits(lane, dangers)) {
+			g.blocked[n] = true
+		}
+	}
+	if danger {
+		// Turning off into another body is no better than going on.
+		for d := range DIRECTIONS {
+			ahead := NewAABB(at.X, at.Y, RECTSIZE, RECTSIZE).Translate(rl.Vector2Scale(DIRECTIONS[d], step))
+			if n, ok := g.cell(start%g.cols+int(DIRECTIONS[d].X), start/g.cols+int(DIRECTIONS[d].Y)); ok && (d == current || s.hits(ahead, dangers)) {
+				g.blocked[n] = true
+			}
+		}
+	}
+	back := -1
+	if current >= 0 && len(body) > 1 {
+		back = (current + 2) % len(DIRECTIONS)
+	}
+
+	dir, found := g.search(start, back, func(i int) bool { return goals[i] })
+	if !found && len(body) > 1 {
+		// The tail moves on as the head does, keeping next to it is safe.
+		tail := NewAABB(body[len(body)-1].X, body[len(body)-1].Y, RECTSIZE, RECTSIZE)
+		tailCells := make(map[int]bool)
+		g.cells(tail, func(i int) { tailCells[i] = true })
+		dir, found = g.search(start, back, func(i int) bool {
+			for d := range DIRECTIONS {
+				if n, ok := g.cell(i%g.cols+int(DIRECTIONS[d].X), i/g.cols+int(DIRECTIONS[d].Y)); ok && tailCells[n] {
+					return true
+				}
+			}
+			return false
+		})
+	}
+	if !found {
+		most := 0
+		for d := range DIRECTIONS {
+			if n, ok := g.neighbour(start, d); ok && d != back {
+				if room := g.room(n); room > most {
+					dir, most, found = d, room, true
+				}
+			}
+		}
+	}
+	if !found {
+		if current < 0 {
+			return 0
+		}
+		return directionInputs[current]
+	}
+	return directionInputs[dir]
+}
+
+func (s *BotSystem) hits(box AABB, dangers []AABB) bool {
+	arena := s.World.gameState.arena
+	for _, danger := range dangers {
+		near := arena.Nearest(Position{X: box.Min.X, Y: box.Min.Y}, Position{X: danger.Min.X, Y: danger.Min.Y})
+		if _, hit := OverlapAABB(box, danger.Translate(rl.Vector2{X: near.X - danger.Min.X, Y: near.Y - danger.Min.Y})); hit {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *BotSystem) enemyAhead(pos Position, direction rl.Vector2, enemies []AABB) bool {
+	if direction == (rl.Vector2{}) {
+		return false
+	}
+	from := rl.Vector2{X: pos.X + RECTSIZE/2, Y: pos.Y + RECTSIZE/2}
+	ray := Segment{A: from, B: rl.Vector2Add(from, rl.Vector2Scale(direction, BOT_FIRE_RANGE))}
+	for _, enemy := range enemies {
+		if _, hit := SegmentAABB(ray, enemy); hit {
+			return true
+		}
+	}
+	return false
+}
+
+// MakeBot hands the snake of player over to a bot, and the ones it comes back
+// with.
+func (w *World) MakeBot(player int) {
+	if player >= 0 && player < len(w.gameState.players) {
+		w.gameState.players[player].Bot = true
+	}
+	entity, ok := w.PlayerEntity(player)
+	if !ok {
+		log.Printf("player %d has no snake to hand to a bot\n", player+1)
+		return
+	}
+	w.AddComponent(entity, map[ComponentID]any{botID: Bot{Fire: true}})
+}
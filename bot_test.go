@@ -0,0 +1,35 @@
+package main
+
+import "testing"
+
+func TestBotOnlySteers(t *testing.T) {
+	w := playedWorld(t, 0)
+	sim := NewSimulation(w)
+	bots := *NewSystem(w, &BotSystem{})
+	turns := 0
+	for tick := range 900 {
+		entity, ok := w.PlayerEntity(0)
+		if !ok || w.state != PLAY {
+			t.Fatalf("bot dead after %d ticks", tick)
+		}
+		before, _ := headAt(w, 0)
+		mover, _ := getComponent[Movement](w, entity, movementID)
+		direction := mover.Direction
+		bots.Update(TICK)
+		// The bot hands its input to the player, the snake itself is left as is.
+		if after, _ := headAt(w, 0); after != before {
+			t.Fatalf("tick %d: bot moved the head from %+v to %+v", tick, before, after)
+		}
+		collider, _ := getComponent[Collides](w, entity, collidesID)
+		if collider.X != before.X || collider.Y != before.Y {
+			t.Fatalf("tick %d: bot moved the collider to %v, %v", tick, collider.X, collider.Y)
+		}
+		sim.Step(nil)
+		if mover, ok := getComponent[Movement](w, entity, movementID); ok && mover.Direction != direction {
+			turns++
+		}
+	}
+	if turns < 10 {
+		t.Errorf("bot turned %d times in 900 ticks", turns)
+	}
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+// ===BUNKERS===
+//
+// Bunkers are made of small cells that shots chip away, whichever side they
+// come from. Their collider is a trigger covering the whole bunker, and
+// ContactSystem tests what crosses it against the cells left: a shot blows a
+// hole where it meets the first one, a snake head dies on them as on a wall
+// and an invader wipes out the ones it runs over. A bunker with no cell left
+// is gone.
+//
+// Levels draw the mask as rows of '#' for a cell and '.' for none, separated
+// by "/":
+//
+//	bunker: ..######../.########./##########/###....###/##......##
+
+const (
+	BUNKER_CELL = 4
+	// BUNKER_BLAST is how far from where a shot lands cells are blown away.
+	BUNKER_BLAST        = 5
+	DEFAULT_BUNKER_MASK = "..######../.########./##########/###....###/##......##"
+)
+
+// LevelBunker is a bunker of a level, with its top left corner at At.
+type LevelBunker struct {
+	At   rl.Vector2
+	Mask Bunker
+}
+
+// ParseBunkerMask reads a mask of cell pixels wide cells.
+func ParseBunkerMask(value string, cell float32) (Bunker, error) {
+	if cell <= 0 {
+		return Bunker{}, fmt.Errorf("bunker cell size %v is not positive", cell)
+	}
+	rows := strings.Split(value, "/")
+	b := Bunker{Cols: len(strings.TrimSpace(rows[0])), Rows: len(rows), Cell: cell}
+	for y, row := range rows {
+		row = strings.TrimSpace(row)
+		if len(row) != b.Cols {
+			return Bunker{}, fmt.Errorf("bunker row %d is %d cells wide, the first one %d", y+1, len(row), b.Cols)
+		}
+		for _, char := range row {
+			switch char {
+			case '#':
+				b.Cells = append(b.Cells, true)
+			case '.':
+				b.Cells = append(b.Cells, false)
+			default:
+				return Bunker{}, fmt.Errorf("bunker row %d: unknown cell %q", y+1, char)
+			}
+		}
+	}
+	if b.Empty() {
+		return Bunker{}, fmt.Errorf("bunker has no cells")
+	}
+	return b, nil
+}
+
+func (b Bunker) Size() rl.Vector2 {
+	return rl.Vector2{X: float32(b.Cols) * b.Cell, Y: float32(b.Rows) * b.Cell}
+}
+
+func (b Bunker) Empty() bool {
+	for _, cell := range b.Cells {
+		if cell {
+			return false
+		}
+	}
+	return true
+}
+
+// cellsIn calls f with every cell left that box overlaps, the bunker being at
+// pos.
+func (b Bunker) cellsIn(pos Position, box AABB, f func(i int)) {
+	x0 := max(int(math.Floor(float64((box.Min.X-pos.X)/b.Cell))), 0)
+	y0 := max(int(math.Floor(float64((box.Min.Y-pos.Y)/b.Cell))), 0)
+	x1 := min(int(math.Ceil(float64((box.Max.X-pos.X)/b.Cell))), b.Cols)
+	y1 := min(int(math.Ceil(float64((box.Max.Y-pos.Y)/b.Cell))), b.Rows)
+	for y := y0; y < y1; y++ {
+		for x := x0; x < x1; x++ {
+			if i := y*b.Cols + x; b.Cells[i] {
+				f(i)
+			}
+		}
+	}
+}
+
+// Hit returns the middle of the cells left of the bunker at pos that box
+// overlaps, if it overlaps any.
+func (b Bunker) Hit(pos Position, box AABB) (rl.Vector2, bool) {
+	var sum rl.Vector2
+	n := 0
+	b.cellsIn(pos, box, func(i int) {
+		sum = rl.Vector2Add(sum, b.center(pos, i))
+		n++
+	})
+	if n == 0 {
+		return rl.Vector2{}, false
+	}
+	return rl.Vector2Scale(sum, 1/float32(n)), true
+}
+
+func (b Bunker) center(pos Position, i int) rl.Vector2 {
+	return rl.Vector2{X: pos.X + (float32(i%b.Cols)+0.5)*b.Cell, Y: pos.Y + (float32(i/b.Cols)+0.5)*b.Cell}
+}
+
+// Carve blows away the cells within radius of point, returning how many.
+func (b *Bunker) Carve(pos Position, point rl.Vector2, radius float32) int {
+	carved := 0
+	area := NewAABB(point.X-radius, point.Y-radius, 2*radius, 2*radius)
+	b.cellsIn(pos, area, func(i int) {
+		if rl.Vector2Distance(b.center(pos, i), point) <= radius {
+			b.Cells[i] = false
+			carved++
+		}
+	})
+	return carved
+}
+
+// EachCell calls f with the box of every cell left of the bunker at pos.
+func (b Bunker) EachCell(pos Position, f func(box AABB)) {
+	for i, cell := range b.Cells {
+		if cell {
+			f(NewAABB(pos.X+float32(i%b.Cols)*b.Cell, pos.Y+float32(i/b.Cols)*b.Cell, b.Cell, b.Cell))
+		}
+	}
+}
+
+func SpawnBunker(w *World, x, y float32, mask Bunker) (Entity, error) {
+	size := mask.Size()
+	sprite, _ := w.PrefabComponent("bunker", spriteID).(Sprite)
+	sprite.Width, sprite.Height = size.X, size.Y
+	return w.Spawn("bunker", map[ComponentID]any{
+		positionID: Position{X: x, Y: y},
+		spriteID:   sprite,
+		collidesID: Collides{Width: size.X, Height: size.Y, Trigger: true},
+		bunkerID:   cloneComponent(bunkerID, mask),
+	})
+}
+
+// hitBunker is what ContactSystem does when entity crosses bunker.
+func (s *ContactSystem) hitBunker(entity, bunker Entity, dt float32) {
+	b, ok := getComponent[Bunker](s.World, bunker, bunkerID)
+	if !ok {
+		return
+	}
+	collider, ok := getComponent[Collides](s.World, entity, collidesID)
+	if !ok {
+		return
+	}
+	position, _ := getComponent[Position](s.World, entity, positionID)
+	at, _ := getComponent[Position](s.World, bunker, positionID)
+	pos := s.World.gameState.arena.Nearest(*position, *at)
+
+	switch {
+	case s.World.HasComponent(entity, projectileID):
+		projectile, _ := getComponent[Projectile](s.World, entity, projectileID)
+		// Shots move several cells a tick, the whole way since the last one is
+		// looked at for the first cell they met.
+		from := *position
+		if mover, ok := getComponent[Movement](s.World, entity, movementID); ok {
+			from.X -= mover.Velocity.X * dt
+			from.Y -= mover.Velocity.Y * dt
+		}
+		path := rl.Vector2{X: position.X - from.X, Y: position.Y - from.Y}
+		steps := int(math.Ceil(float64(GetVectorLength(path)/(b.Cell/2)))) + 1
+		for k := range steps + 1 {
+			t := float32(k) / float32(steps)
+			hit, ok := b.Hit(pos, collider.AABB(Position{X: from.X + path.X*t, Y: from.Y + path.Y*t}))
+			if !ok {
+				continue
+			}
+			b.Carve(pos, hit, BUNKER_BLAST)
+			if !projectile.Pierce {
+				s.World.RemoveEntity(entity)
+			}
+			break
+		}
+	case s.World.HasComponent(entity, playerControlledID):
+		if _, hit := b.Hit(pos, collider.AABB(*position)); hit {
+			s.World.KillPlayer(entity, DEATH_WALL)
+		}
+	case s.World.HasComponent(entity, enemyID):
+		b.cellsIn(pos, collider.AABB(*position), func(i int) { b.Cells[i] = false })
+	}
+	if b.Empty() {
+		s.World.RemoveEntity(bunker)
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"testing"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+func bunkerWorld(t *testing.T, mask string) (*World, Entity, *ContactSystem) {
+	t.Helper()
+	w := spawnWorld(t)
+	b, err := ParseBunkerMask(mask, BUNKER_CELL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bunker, err := SpawnBunker(w, 100, 100, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return w, bunker, *NewSystem(w, &ContactSystem{})
+}
+
+func cellAt(w *World, bunker Entity, x, y int) bool {
+	b, _ := getComponent[Bunker](w, bunker, bunkerID)
+	return b.Cells[y*b.Cols+x]
+}
+
+func TestParseBunkerMask(t *testing.T) {
+	b, err := ParseBunkerMask(DEFAULT_BUNKER_MASK, BUNKER_CELL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.Cols != 10 || b.Rows != 5 || b.Size() != (rl.Vector2{X: 40, Y: 20}) {
+		t.Errorf("%dx%d cells, %v pixels", b.Cols, b.Rows, b.Size())
+	}
+	for _, mask := range []string{"##/#", "#x", "../.."} {
+		if _, err := ParseBunkerMask(mask, BUNKER_CELL); err == nil {
+			t.Errorf("mask %q parsed", mask)
+		}
+	}
+	if _, err := ParseBunkerMask("#", 0); err == nil {
+		t.Error("mask with no cell size parsed")
+	}
+}
+
+// A shot crossing a whole bunker in one tick blows a hole in the first cells
+// on its way, not where it ends up.
+func TestBunkerFastShot(t *testing.T) {
+	w, bunker, contacts := bunkerWorld(t, "####/####/####/####/####")
+	shot, err := SpawnProjectile(w, 0, 104, 110, rl.Vector2{Y: 1}, 1800)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mover, _ := getComponent[Movement](w, shot, movementID)
+	mover.Velocity = rl.Vector2{Y: 30 / TICK}
+
+	contacts.hitBunker(shot, bunker, TICK)
+	if w.HasComponent(shot, projectileID) {
+		t.Error("the shot went on")
+	}
+	for _, cell := range [][2]int{{0, 0}, {1, 0}, {2, 0}, {1, 1}} {
+		if cellAt(w, bunker, cell[0], cell[1]) {
+			t.Errorf("cell %v is left", cell)
+		}
+	}
+	for _, cell := range [][2]int{{3, 0}, {0, 1}, {1, 2}, {1, 3}, {1, 4}} {
+		if !cellAt(w, bunker, cell[0], cell[1]) {
+			t.Errorf("cell %v is gone", cell)
+		}
+	}
+}
+
+func TestBunkerKillsSnake(t *testing.T) {
+	w, bunker, contacts := bunkerWorld(t, DEFAULT_BUNKER_MASK)
+	w.gameState.players = make([]PlayerStatus, 2)
+	w.gameState.players[0].Alive = true
+	w.gameState.players[1].Alive = true
+
+	// The top left corner of the mask has no cell.
+	missed, err := SpawnPlayer(w, 1, 84, 84)
+	if err != nil {
+		t.Fatal(err)
+	}
+	contacts.hitBunker(missed, bunker, TICK)
+	if !w.HasComponent(missed, playerControlledID) {
+		t.Fatal("the snake died off the cells")
+	}
+
+	head, err := SpawnPlayer(w, 0, 110, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	contacts.hitBunker(head, bunker, TICK)
+	if w.HasComponent(head, playerControlledID) {
+		t.Fatal("the snake went through the bunker")
+	}
+	if status := w.gameState.players[0]; status.Alive || status.Deaths != 1 || status.Cause != DEATH_WALL {
+		t.Errorf("status %+v", status)
+	}
+	if !w.HasComponent(bunker, bunkerID) {
+		t.Error("the snake broke the bunker")
+	}
+}
+
+func TestBunkerRemovedWhenEmpty(t *testing.T) {
+	w, bunker, contacts := bunkerWorld(t, "##/##")
+	invader, err := w.Spawn("invader", map[ComponentID]any{positionID: Position{X: 104, Y: 96}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	contacts.hitBunker(invader, bunker, TICK)
+	if !w.HasComponent(bunker, bunkerID) {
+		t.Fatal("the bunker went with cells left")
+	}
+	if cellAt(w, bunker, 1, 0) || !cellAt(w, bunker, 0, 1) {
+		t.Error("the invader wiped out the wrong cells")
+	}
+
+	position, _ := getComponent[Position](w, invader, positionID)
+	*position = Position{X: 96, Y: 96}
+	contacts.hitBunker(invader, bunker, TICK)
+	if w.HasComponent(bunker, bunkerID) {
+		t.Error("the empty bunker is still there")
+	}
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+// ===CANDIES===
+//
+// Every kind of candy is a prefab with a Candy component saying what eating
+// it does, and a level picks which kinds show up and how often:
+//
+//	candy_types: candy 10, candy_gold 2, candy_red 1
+//
+// Each candy spawned is one of those prefabs, drawn with a chance of its
+// weight over the sum of all weights. Levels that don't say only get "candy".
+
+// CandyType is a candy prefab and how often it spawns relative to the others.
+type CandyType struct {
+	Prefab string
+	Weight int
+}
+
+var DEFAULT_CANDY_TYPES = []CandyType{{Prefab: "candy", Weight: 1}}
+
+// ParseCandyTypes reads a comma separated list of "prefab weight" pairs, the
+// weight being 1 when left out.
+func ParseCandyTypes(value string) ([]CandyType, error) {
+	var types []CandyType
+	for _, item := range strings.Split(value, ",") {
+		fields := strings.Fields(item)
+		if len(fields) == 0 || len(fields) > 2 {
+			return nil, fmt.Errorf("expected \"prefab weight\", got %q", strings.TrimSpace(item))
+		}
+		t := CandyType{Prefab: fields[0], Weight: 1}
+		if len(fields) == 2 {
+			weight, err := strconv.Atoi(fields[1])
+			if err != nil || weight <= 0 {
+				return nil, fmt.Errorf("candy %q: weight %q is not a positive number", t.Prefab, fields[1])
+			}
+			t.Weight = weight
+		}
+		types = append(types, t)
+	}
+	return types, nil
+}
+
+// checkCandyTypes makes sure every type spawns a candy.
+func checkCandyTypes(w *World, types []CandyType) error {
+	for _, t := range types {
+		if _, ok := w.PrefabComponent(t.Prefab, candyID).(Candy); !ok {
+			return fmt.Errorf("candy type %q is no prefab with a candy component", t.Prefab)
+		}
+	}
+	return nil
+}
+
+func pickCandyType(w *World) string {
+	types := w.gameState.candyTypes
+	if len(types) == 0 {
+		types = DEFAULT_CANDY_TYPES
+	}
+	total := 0
+	for _, t := range types {
+		total += t.Weight
+	}
+	roll := w.rng.IntN(total)
+	for _, t := range types {
+		if roll < t.Weight {
+			return t.Prefab
+		}
+		roll -= t.Weight
+	}
+	return types[len(types)-1].Prefab
+}
+
+// SpawnCandy drops a candy of one of the level's types on a free one of its
+// spawn points, or in any free cell when there are none.
+func SpawnCandy(w *World) (Entity, error) {
+	at, err := w.FindSpawn(SpawnRules{HeadDistance: CANDY_HEAD_DISTANCE, Points: w.gameState.candySpawns})
+	if err != nil {
+		return 0, err
+	}
+	return w.Spawn(pickCandyType(w), map[ComponentID]any{positionID: at})
+}
+
+// EatCandy has the snake of entity eat candy. An enemy snake takes it away
+// without it doing anything for it.
+func (w *World) EatCandy(entity, candy Entity) {
+	player, ok := getComponent[PlayerControlled](w, entity, playerControlledID)
+	if enemy, isEnemy := getComponent[Enemy](w, entity, enemyID); !ok && (!isEnemy || enemy.Kind != EnemySnake) {
+		return
+	}
+	c, _ := getComponent[Candy](w, candy, candyID)
+	position, _ := getComponent[Position](w, candy, positionID)
+	effect, at := *c, *position
+
+	if ok {
+		for range effect.Grow {
+			player.GrowBody(player.Body)
+		}
+		if effect.Shrink > 0 {
+			player.Body = player.Body[:max(len(player.Body)-effect.Shrink, 1)]
+		}
+		w.AddScore(entity, effect.Score)
+		if status, ok := w.PlayerStatusOf(entity); ok {
+			status.Candies++
+			status.Lives += effect.Lives
+		}
+		for _, e := range effect.Effects {
+			w.AddEffect(entity, e)
+		}
+	}
+
+	w.Emit(Event{Kind: EventCandyEaten, Entity: entity, Position: at, Sound: effect.Sound})
+	w.gameState.currentCandies--
+	w.RemoveEntity(candy)
+}
+
+// +++++++++++
+// CandySystem keeps the level's count of candies out, takes away the ones
+// whose time is up and pulls them towards snakes with a magnet on.
+type CandySystem struct {
+	BaseSystem
+}
+
+func (s *CandySystem) Update(dt float32) {
+	var expired []Entity
+	for _, archetype := range s.World.Query(candyID) {
+		candy := archetype.Components[candyID].([]Candy)
+		for idx, entity := range archetype.Entities {
+			if candy[idx].Lifetime <= 0 {
+				continue
+			}
+			candy[idx].Lifetime -= dt
+			if candy[idx].Lifetime <= 0 {
+				expired = append(expired, entity)
+			}
+		}
+	}
+	for _, entity := range expired {
+		s.World.RemoveEntity(entity)
+		s.World.gameState.currentCandies--
+	}
+
+	s.magnets(dt)
+
+	// A full arena is tried again next tick.
+	if s.World.gameState.currentCandies < s.World.gameState.maxCandies {
+		if _, err := SpawnCandy(s.World); err == nil {
+			s.World.gameState.currentCandies += 1
+		} else if !errors.Is(err, ErrArenaFull) {
+			log.Println(err)
+		}
+	}
+}
+
+// magnets moves the candies within reach of a magnet towards its head.
+func (s *CandySystem) magnets(dt float32) {
+	type magnet struct {
+		head  Position
+		reach float32
+	}
+	var magnets []magnet
+	for _, archetype := range s.World.Query(statusEffectsID, positionID) {
+		effects := archetype.Components[statusEffectsID].([]StatusEffects)
+		position := archetype.Components[positionID].([]Position)
+		for idx := range archetype.Entities {
+			if effect, ok := effects[idx].Get(EffectMagnet); ok {
+				reach := effect.Strength
+				if reach <= 0 {
+					reach = MAGNET_REACH
+				}
+				magnets = append(magnets, magnet{position[idx], reach})
+			}
+		}
+	}
+	if len(magnets) == 0 {
+		return
+	}
+
+	arena := s.World.gameState.arena
+	for _, archetype := range s.World.Query(candyID, positionID, collidesID) {
+		position := archetype.Components[positionID].([]Position)
+		collider := archetype.Components[collidesID].([]Collides)
+		for idx := range archetype.Entities {
+			for _, m := range magnets {
+				d := arena.Delta(rl.Vector2{X: position[idx].X, Y: position[idx].Y}, rl.Vector2{X: m.head.X, Y: m.head.Y})
+				length := GetVectorLength(d)
+				if length > m.reach || length == 0 {
+					continue
+				}
+				step := rl.Vector2Scale(d, min(MAGNET_SPEED*dt, length)/length)
+				at := arena.WrapPoint(rl.Vector2{X: position[idx].X + step.X, Y: position[idx].Y + step.Y})
+				position[idx] = Position{X: at.X, Y: at.Y}
+				// Candies don't move on their own, there is nothing to sweep.
+				collider[idx].X, collider[idx].Y = at.X, at.Y
+				break
+			}
+		}
+	}
+}
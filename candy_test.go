@@ -0,0 +1,175 @@
+package main
+
+import (
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+// Every kind of candy must look and sound like no other, or players can't
+// tell what they ate.
+func TestCandiesDistinct(t *testing.T) {
+	prefabs, err := LoadPrefabs(PREFABS_PATH)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := slices.Sorted(func(yield func(string) bool) {
+		for name, prefab := range prefabs {
+			if _, ok := prefab.Components[candyID]; ok && !yield(name) {
+				return
+			}
+		}
+	})
+	colors := make(map[rl.Color]string)
+	tones := make(map[float32]string)
+	for _, name := range names {
+		components := prefabs[name].Components
+		color := components[spriteID].(Sprite).Color
+		if other, ok := colors[color]; ok {
+			t.Errorf("%s has the colour of %s", name, other)
+		}
+		colors[color] = name
+		tone := components[candyID].(Candy).Sound.Tone
+		if other, ok := tones[tone]; ok {
+			t.Errorf("%s has the tone of %s", name, other)
+		}
+		tones[tone] = name
+	}
+}
+
+func candyWorld(t *testing.T) *World {
+	t.Helper()
+	w := NewWorld()
+	var err error
+	if w.prefabs, err = LoadPrefabs(PREFABS_PATH); err != nil {
+		t.Fatal(err)
+	}
+	w.Seed(1)
+	return w
+}
+
+func TestPickCandyType(t *testing.T) {
+	w := candyWorld(t)
+	if got := pickCandyType(w); got != "candy" {
+		t.Errorf("a level without types picks %q", got)
+	}
+
+	w.Seed(1)
+	w.gameState.candyTypes = []CandyType{{Prefab: "candy", Weight: 1}, {Prefab: "candy_gold", Weight: 3}}
+	counts := make(map[string]int)
+	var picks []string
+	for range 4000 {
+		pick := pickCandyType(w)
+		counts[pick]++
+		picks = append(picks, pick)
+	}
+	if gold := float64(counts["candy_gold"]) / 4000; gold < 0.72 || gold > 0.78 || len(counts) != 2 {
+		t.Errorf("picked %v, want about three gold for each plain", counts)
+	}
+
+	// The same seed picks the same candies.
+	w.Seed(1)
+	for i, want := range picks {
+		if got := pickCandyType(w); got != want {
+			t.Fatalf("pick %d is %q, was %q", i, got, want)
+		}
+	}
+}
+
+func TestCandyLifetime(t *testing.T) {
+	w := candyWorld(t)
+	lasting, err := w.Spawn("candy", map[ComponentID]any{positionID: Position{X: 20, Y: 20}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	gold, err := w.Spawn("candy_gold", map[ComponentID]any{positionID: Position{X: 60, Y: 20}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.gameState.currentCandies = 2
+	lifetime := w.PrefabComponent("candy_gold", candyID).(Candy).Lifetime
+
+	candies := *NewSystem(w, &CandySystem{})
+	for second := 1; second < int(lifetime); second++ {
+		candies.Update(1)
+		if !w.HasComponent(gold, candyID) {
+			t.Fatalf("gold candy gone after %d of its %v seconds", second, lifetime)
+		}
+	}
+	candies.Update(1)
+	if w.HasComponent(gold, candyID) || w.gameState.currentCandies != 1 {
+		t.Errorf("gold candy still there after %v seconds, %d candies counted", lifetime, w.gameState.currentCandies)
+	}
+	if !w.HasComponent(lasting, candyID) {
+		t.Errorf("a candy without a lifetime expired")
+	}
+}
+
+func TestEatCandyShrinks(t *testing.T) {
+	w := candyWorld(t)
+	snake, err := w.Spawn("player", map[ComponentID]any{positionID: Position{X: 100, Y: 100}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	player, _ := getComponent[PlayerControlled](w, snake, playerControlledID)
+	player.Body = []rl.Vector2{{X: 100, Y: 100}, {X: 80, Y: 100}, {X: 60, Y: 100}}
+	shrink := w.PrefabComponent("candy_red", candyID).(Candy).Shrink
+	if shrink < len(player.Body) {
+		t.Fatalf("candy_red shrinks by %d, too little to reach the floor", shrink)
+	}
+
+	// A snake never shrinks below its head, however often it eats.
+	for range 2 {
+		candy, err := w.Spawn("candy_red", map[ComponentID]any{positionID: Position{X: 100, Y: 100}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.gameState.currentCandies = 1
+		w.EatCandy(snake, candy)
+		player, _ = getComponent[PlayerControlled](w, snake, playerControlledID)
+		if len(player.Body) != 1 {
+			t.Errorf("body of %d segments, want 1", len(player.Body))
+		}
+		if w.HasComponent(candy, candyID) || w.gameState.currentCandies != 0 {
+			t.Errorf("eaten candy left, %d candies counted", w.gameState.currentCandies)
+		}
+	}
+}
+
+func TestParseCandyTypes(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    []CandyType
+		wantErr string
+	}{
+		{"candy", []CandyType{{"candy", 1}}, ""},
+		{"candy 3, candy_gold 1", []CandyType{{"candy", 3}, {"candy_gold", 1}}, ""},
+		{"  candy   2 ,candy_red", []CandyType{{"candy", 2}, {"candy_red", 1}}, ""},
+		{"", nil, `expected "prefab weight", got ""`},
+		{"candy,,candy_red", nil, `expected "prefab weight", got ""`},
+		{"candy 1 2", nil, `got "candy 1 2"`},
+		{"candy 0", nil, `weight "0" is not a positive number`},
+		{"candy -2", nil, `weight "-2" is not a positive number`},
+		{"candy lots", nil, `weight "lots" is not a positive number`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := ParseCandyTypes(tt.value)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want one with %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
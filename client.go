@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/gob"
+	"fmt"
+	"net"
+)
+
+// ===CLIENT===
+
+// Client plays on a Server. World is what the player sees: the last state the
+// server sent, with the inputs it hasn't used yet already played on top.
+type Client struct {
+	Player int
+	World  *World
+
+	server   *World
+	sim      *Simulation
+	conn     net.Conn
+	encoder  *gob.Encoder
+	messages chan ServerMessage
+	err      error
+	seq      uint64
+	pending  []ClientMessage
+}
+
+func DialClient(addr string, prefabs Prefabs) (*Client, error) {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return NewClient(conn, prefabs)
+}
+
+// NewClient waits for the server on the other side of conn to welcome it.
+func NewClient(conn net.Conn, prefabs Prefabs) (*Client, error) {
+	decoder := gob.NewDecoder(conn)
+	var welcome ServerMessage
+	if err := decoder.Decode(&welcome); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if welcome.Welcome == nil {
+		conn.Close()
+		return nil, fmt.Errorf("server did not welcome us")
+	}
+
+	c := &Client{
+		Player:   welcome.Welcome.Player,
+		World:    NewWorld(),
+		server:   NewWorld(),
+		conn:     conn,
+		encoder:  gob.NewEncoder(conn),
+		messages: make(chan ServerMessage, SERVER_OUT_BUFFER),
+	}
+	c.World.prefabs, c.server.prefabs = prefabs, prefabs
+	c.sim = NewPredictionSimulation(c.World)
+	go c.read(decoder)
+	return c, nil
+}
+
+func (c *Client) read(decoder *gob.Decoder) {
+	for {
+		var msg ServerMessage
+		if err := decoder.Decode(&msg); err != nil {
+			c.err = err
+			close(c.messages)
+			return
+		}
+		c.messages <- msg
+	}
+}
+
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// Update sends the input of this tick, applies whatever the server sent and
+// predicts the tick.
+func (c *Client) Update(input InputFrame) error {
+	c.seq++
+	msg := ClientMessage{Seq: c.seq, Input: input}
+	if err := c.encoder.Encode(msg); err != nil {
+		return err
+	}
+	c.pending = append(c.pending, msg)
+
+	reconcile := false
+	for done := false; !done; {
+		select {
+		case m, ok := <-c.messages:
+			if !ok {
+				return c.err
+			}
+			if m.Delta == nil {
+				continue
+			}
+			if err := c.apply(m.Delta); err != nil {
+				return err
+			}
+			reconcile = true
+		default:
+			done = true
+		}
+	}
+
+	if !reconcile {
+		c.predict(input)
+		return nil
+	}
+	c.World.Restore(c.server.Snapshot())
+	for _, p := range c.pending {
+		c.predict(p.Input)
+	}
+	return nil
+}
+
+func (c *Client) predict(input InputFrame) {
+	inputs := make([]InputFrame, c.Player+1)
+	inputs[c.Player] = input
+	c.sim.Step(inputs)
+}
+
+// apply brings the server world up to d and forgets the inputs it used.
+func (c *Client) apply(d *StateDelta) error {
+	w := c.server
+	w.tick, w.state = d.Tick, d.State
+	if d.GameState != nil {
+		w.gameState.load(*d.GameState)
+	}
+	for _, entity := range d.Removed {
+		w.RemoveEntity(entity)
+	}
+	for _, e := range d.Entities {
+		components := w.Components(e.Entity)
+		if components == nil {
+			components = make(map[ComponentID]any)
+		}
+		for id := range components {
+			if e.Mask&id == 0 {
+				delete(components, id)
+			}
+		}
+		for _, cd := range e.Components {
+			component, err := decodeComponent(cd.ID, cd.Data)
+			if err != nil {
+				return fmt.Errorf("entity %d: %w", e.Entity, err)
+			}
+			components[cd.ID] = component
+		}
+		w.RemoveEntity(e.Entity)
+		w.insertEntity(e.Entity, components)
+		w.nextEntityID = max(w.nextEntityID, e.Entity+1)
+	}
+
+	i := 0
+	for i < len(c.pending) && c.pending[i].Seq <= d.Ack {
+		i++
+	}
+	c.pending = c.pending[i:]
+	return nil
+}
@@ -1,7 +1,10 @@
 package main
 
 import (
-	"log"
+	"fmt"
+	"math/rand/v2"
+	"reflect"
+	"sort"
 
 	rl "github.com/gen2brain/raylib-go/raylib"
 )
@@ -22,6 +25,12 @@ const (
 	collidesID
 	enemyID
 	candyID
+	projectileID
+	botID
+	statusEffectsID
+	bunkerID
+	bossID
+	bossPartID
 )
 
 const (
@@ -31,10 +40,24 @@ const (
 	DEAD
 )
 
+func (s State) String() string {
+	switch s {
+	case PAUSE:
+		return "PAUSE"
+	case PLAY:
+		return "PLAY"
+	case MENU:
+		return "MENU"
+	case DEAD:
+		return "DEAD"
+	default:
+		return fmt.Sprintf("State(%d)", uint32(s))
+	}
+}
+
 const (
-	GRAVITY        = 980
-	JUMPFORCE      = 500
-	MOVEMENT_SPEED = 2
+	GRAVITY   = 980
+	JUMPFORCE = 500
 )
 
 var DIRECTIONS = []rl.Vector2{
@@ -80,8 +103,13 @@ func (c *Sprite) Draw(x, y float32) {
 
 // +++++++++++
 type Movement struct {
-	Direction rl.Vector2
-	Speed     float32
+	Direction    rl.Vector2
+	Speed        float32
+	Velocity     rl.Vector2
+	Acceleration float32
+	Drag         float32
+	MaxSpeed     float32
+	GravityScale float32
 }
 
 func (c *Movement) Type() ComponentID {
@@ -137,27 +165,45 @@ type Animation struct {
 	Duration_left   float32
 }
 
+// Step moves the animation on by dt, a frame every Speed seconds.
+func (c *Animation) Step(dt float32) {
+	c.Duration_left -= dt
+	if c.Duration_left > 0 {
+		return
+	}
+	c.Duration_left = c.Speed
+	c.Current++
+
+	if c.Current > c.Last {
+		switch c.Type {
+		case REPEATING:
+			c.Current = c.First
+		case ONESHOT:
+			c.Current = c.Last
+		}
+	}
+}
+
+// Draw draws the current frame, as big as Sprite when it has a size. Without
+// a texture frames are the rectangle of Sprite, lighter every other frame.
 func (c *Animation) Draw(x, y float32) {
-	if c.Duration_left <= 0 {
-		c.Duration_left = c.Speed
-		c.Current++
-
-		if c.Current > c.Last {
-			switch c.Type {
-			case REPEATING:
-				c.Current = c.First
-				break
-			case ONESHOT:
-				c.Current = c.Last
-				break
-			}
+	if c.Sprite.Texture.ID == 0 {
+		color := c.Sprite.Color
+		if (c.Current-c.First)%2 == 1 {
+			color = rl.ColorBrightness(color, 0.3)
 		}
+		rl.DrawRectangle(int32(x), int32(y), int32(c.Sprite.Width), int32(c.Sprite.Height), color)
+		return
 	}
 
+	size := rl.Vector2{X: 128, Y: 128}
+	if c.Sprite.Width > 0 && c.Sprite.Height > 0 {
+		size = rl.Vector2{X: c.Sprite.Width, Y: c.Sprite.Height}
+	}
 	rl.DrawTexturePro(
 		c.Sprite.Texture,
 		c.AnimationFrame(c.NumFramesPerRow, c.SizeTile, c.XPad, c.YPad, c.XOffset, c.YOffset),
-		rl.Rectangle{x, y, 128.0, 128.0},
+		rl.Rectangle{x, y, size.X, size.Y},
 		rl.Vector2{0.0, 0.0}, 0.0, rl.White)
 
 }
@@ -175,13 +221,22 @@ func (c *Animation) AnimationFrame(numFramesPerRow, sizeTile, xPad, yPad, xOffse
 
 // +++++++++++
 type PlayerControlled struct {
-	Body []rl.Vector2
+	// Index picks the player, and so the input, steering this snake.
+	Index    int
+	Cooldown float32
+	Body     []rl.Vector2
 }
 
 func (c *PlayerControlled) Type() ComponentID { return playerControlledID }
 
 // +++++++++++
-type IAControlled struct{}
+// IAControlled runs the machine of the prefab Machine, see AISystem. It has
+// been in State for Time seconds.
+type IAControlled struct {
+	Machine string
+	State   string
+	Time    float32
+}
 
 func (c *IAControlled) Type() ComponentID { return IAControlledID }
 
@@ -191,20 +246,117 @@ type Collides struct {
 	Y      float32
 	Width  float32
 	Height float32
+	// Triggers report contacts but never push or get pushed.
+	Trigger bool
 }
 
 func (c *Collides) Type() ComponentID { return collidesID }
 
 // +++++++++++
-type Enemy struct{}
+// Enemy is an enemy of kind Kind, see EnemySystem, worth Score.
+type Enemy struct {
+	Kind  EnemyKind
+	Score int
+	// Formation marks the invaders of the wave WaveSystem marches.
+	Formation bool
+	// Away is set while a diver is out of its place, Slot.
+	Away bool
+	Slot Position
+}
 
 func (c *Enemy) Type() ComponentID { return enemyID }
 
 // +++++++++++
-type Candy struct{}
+// Candy is what eating it does to a snake.
+type Candy struct {
+	Score  int
+	Grow   int
+	Shrink int
+	Lives  int
+	// Effects are put on the snake, see AddEffect.
+	Effects []StatusEffect
+	// Lifetime counts down to the candy going away, it stays when 0.
+	Lifetime float32
+	Sound    Sound
+}
 
 func (c *Candy) Type() ComponentID { return candyID }
 
+// +++++++++++
+type Projectile struct {
+	Owner  Entity
+	Damage int32
+	// Pierce keeps the projectile going through whatever it destroys.
+	Pierce bool
+	// Enemy shots go through invaders and kill the snakes they hit.
+	Enemy bool
+}
+
+func (c *Projectile) Type() ComponentID { return projectileID }
+
+// +++++++++++
+// Bot drives its entity in place of a player, see BotSystem.
+type Bot struct {
+	// Fire shoots at enemies right ahead.
+	Fire bool
+}
+
+func (c *Bot) Type() ComponentID { return botID }
+
+// +++++++++++
+// StatusEffects are the timed effects on an entity, see StatusEffectSystem.
+type StatusEffects struct {
+	Effects []StatusEffect
+	// BaseSpeed is the speed of the entity before speed or slow came on.
+	BaseSpeed float32
+}
+
+func (c *StatusEffects) Type() ComponentID { return statusEffectsID }
+
+// +++++++++++
+// Bunker is a block of Cols by Rows cells of Cell pixels that gets chipped
+// away, Cells telling row by row which ones are left. See bunker.go.
+type Bunker struct {
+	Cols  int
+	Rows  int
+	Cell  float32
+	Cells []bool
+}
+
+func (c *Bunker) Type() ComponentID { return bunkerID }
+
+// +++++++++++
+// Boss is the core of a boss, the Def-th boss of the waves. Phase counts the
+// phases its machine went into, from 0, -1 before its first tick. Its Parts follow it around and its weak
+// points, the parts with Health, have Health of MaxHealth left between them.
+// See BossSystem.
+type Boss struct {
+	Def       int
+	Phase     int
+	Health    int32
+	MaxHealth int32
+	Parts     []Entity
+	// March is the side it goes, 1 or -1.
+	March float32
+	// Patterns are the bullet patterns of the phase being fired, Summons the
+	// time before each minion of the phase comes and Minions the ones that
+	// came and are still about.
+	Patterns []PatternState
+	Summons  []float32
+	Minions  []BossMinionEntity
+}
+
+func (c *Boss) Type() ComponentID { return bossID }
+
+// +++++++++++
+// BossPart is a piece of Boss, kept Offset from its core.
+type BossPart struct {
+	Boss   Entity
+	Offset rl.Vector2
+}
+
+func (c *BossPart) Type() ComponentID { return bossPartID }
+
 /*
 // +++++++++++
 type inputReaction uint8
@@ -293,6 +445,24 @@ func (a *Archetype) AddEntity(entity Entity, components map[ComponentID]any) (id
 		case candyID:
 			candy := a.Components[k].([]Candy)
 			a.Components[k] = append(candy, v.(Candy))
+		case projectileID:
+			projectiles := a.Components[k].([]Projectile)
+			a.Components[k] = append(projectiles, v.(Projectile))
+		case botID:
+			bots := a.Components[k].([]Bot)
+			a.Components[k] = append(bots, v.(Bot))
+		case statusEffectsID:
+			statusEffectss := a.Components[k].([]StatusEffects)
+			a.Components[k] = append(statusEffectss, v.(StatusEffects))
+		case bunkerID:
+			bunkers := a.Components[k].([]Bunker)
+			a.Components[k] = append(bunkers, v.(Bunker))
+		case bossID:
+			bosss := a.Components[k].([]Boss)
+			a.Components[k] = append(bosss, v.(Boss))
+		case bossPartID:
+			bossParts := a.Components[k].([]BossPart)
+			a.Components[k] = append(bossParts, v.(BossPart))
 		default:
 			continue
 		}
@@ -330,6 +500,10 @@ func (a *Archetype) RemoveEntity(entity Entity) {
 				components := v.([]Movement)
 				components[idx] = components[lastIdx]
 				a.Components[k] = components[:lastIdx]
+			case animationID:
+				components := v.([]Animation)
+				components[idx] = components[lastIdx]
+				a.Components[k] = components[:lastIdx]
 			case collidesID:
 				components := v.([]Collides)
 				components[idx] = components[lastIdx]
@@ -358,6 +532,30 @@ func (a *Archetype) RemoveEntity(entity Entity) {
 				components := v.([]Candy)
 				components[idx] = components[lastIdx]
 				a.Components[k] = components[:lastIdx]
+			case projectileID:
+				components := v.([]Projectile)
+				components[idx] = components[lastIdx]
+				a.Components[k] = components[:lastIdx]
+			case botID:
+				components := v.([]Bot)
+				components[idx] = components[lastIdx]
+				a.Components[k] = components[:lastIdx]
+			case statusEffectsID:
+				components := v.([]StatusEffects)
+				components[idx] = components[lastIdx]
+				a.Components[k] = components[:lastIdx]
+			case bunkerID:
+				components := v.([]Bunker)
+				components[idx] = components[lastIdx]
+				a.Components[k] = components[:lastIdx]
+			case bossID:
+				components := v.([]Boss)
+				components[idx] = components[lastIdx]
+				a.Components[k] = components[:lastIdx]
+			case bossPartID:
+				components := v.([]BossPart)
+				components[idx] = components[lastIdx]
+				a.Components[k] = components[:lastIdx]
 			default:
 				continue
 			}
@@ -400,6 +598,24 @@ func (a *Archetype) RemoveEntity(entity Entity) {
 			case candyID:
 				components := v.([]Candy)
 				a.Components[k] = components[:lastIdx]
+			case projectileID:
+				components := v.([]Projectile)
+				a.Components[k] = components[:lastIdx]
+			case botID:
+				components := v.([]Bot)
+				a.Components[k] = components[:lastIdx]
+			case statusEffectsID:
+				components := v.([]StatusEffects)
+				a.Components[k] = components[:lastIdx]
+			case bunkerID:
+				components := v.([]Bunker)
+				a.Components[k] = components[:lastIdx]
+			case bossID:
+				components := v.([]Boss)
+				a.Components[k] = components[:lastIdx]
+			case bossPartID:
+				components := v.([]BossPart)
+				a.Components[k] = components[:lastIdx]
 			default:
 				continue
 			}
@@ -409,35 +625,96 @@ func (a *Archetype) RemoveEntity(entity Entity) {
 	delete(a.EntityToIndex, entity)
 }
 
+// ===CONTACTS===
+type Contact struct {
+	Entity  Entity
+	Other   Entity
+	Trigger bool
+}
+
+// addContact records c unless Entity already touched Other this tick, which
+// happens when a trigger crossed during the sweep still overlaps afterwards.
+func (w *World) addContact(c Contact) {
+	for _, old := range w.contacts {
+		if old.Entity == c.Entity && old.Other == c.Other {
+			return
+		}
+	}
+	w.contacts = append(w.contacts, c)
+}
+
 // ===GAME STATE===
 type GameState struct {
 	maxCandies     int
 	currentCandies int
+	arena          Arena
+	candySpawns    []rl.Vector2
+	candyTypes     []CandyType
+	playerSpawns   []rl.Vector2
+	mode           GameMode
+	players        []PlayerStatus
+
+	// The waves of the level, nil without any, and how far into them the
+	// game is. wave counts from 1, intermission is the time left before the
+	// next one and march the side the formation goes, 1 or -1.
+	waves        *WaveSet
+	wave         int
+	waveSize     int
+	intermission float32
+	march        float32
 }
 
 // ===WORLD===
 type World struct {
 	nextEntityID Entity
+	tick         uint64
 	state        State
 	gameState    GameState
+	inputs       []InputFrame
 	entityMask   map[Entity]ComponentID
 	archetypes   map[ComponentID]*Archetype
+	contacts     []Contact
+	events       []Event
+	prefabs      Prefabs
+	// Every random roll of the game goes through rng so that it can be saved.
+	pcg *rand.PCG
+	rng *rand.Rand
 }
 
 func NewWorld() *World {
+	pcg := rand.NewPCG(0, 0)
 	return &World{
 		nextEntityID: 0,
 		state:        PAUSE,
-		gameState:    GameState{0, 0},
+		gameState:    GameState{arena: Arena{Width: SCREENWIDTH, Height: SCREENHEIGHT}},
 		entityMask:   make(map[Entity]ComponentID),
 		archetypes:   make(map[ComponentID]*Archetype),
+		pcg:          pcg,
+		rng:          rand.New(pcg),
 	}
 }
 
+// Reset drops every entity and the game state, leaving an empty world with
+// the same prefabs and random generator.
+func (w *World) Reset() {
+	prefabs, pcg, rng := w.prefabs, w.pcg, w.rng
+	*w = *NewWorld()
+	w.prefabs, w.pcg, w.rng = prefabs, pcg, rng
+}
+
+func (w *World) Seed(seed uint64) {
+	w.pcg.Seed(seed, seed^0x9E3779B97F4A7C15)
+}
+
 func (w *World) CreateEntity(components map[ComponentID]any) (entity Entity) {
 	entity = w.nextEntityID
 	w.nextEntityID++
+	w.insertEntity(entity, components)
+	return
+}
 
+// insertEntity files entity under the archetype of its components.
+func (w *World) insertEntity(entity Entity, components map[ComponentID]any) {
 	var mask ComponentID
 	var compList []ComponentID
 	for k := range components {
@@ -455,10 +732,10 @@ func (w *World) CreateEntity(components map[ComponentID]any) (entity Entity) {
 
 	w.entityMask[entity] = mask
 	archetype.AddEntity(entity, components)
-	return
 }
 
-// ...
+// AddComponent adds components to entity, replacing the ones it already has.
+// The entity keeps its ID while it moves to its new archetype.
 func (w *World) AddComponent(entity Entity, components map[ComponentID]any) {
 	mask, ok := w.entityMask[entity]
 	if !ok {
@@ -470,6 +747,9 @@ func (w *World) AddComponent(entity Entity, components map[ComponentID]any) {
 	idx := oldArchetype.EntityToIndex[entity]
 
 	for k, v := range oldArchetype.Components {
+		if _, replaced := components[k]; replaced {
+			continue
+		}
 		// HACK: Add components here as needed.
 		switch k {
 		case positionID:
@@ -487,6 +767,9 @@ func (w *World) AddComponent(entity Entity, components map[ComponentID]any) {
 		case aliveID:
 			component := v.([]Alive)[idx]
 			components[k] = component
+		case animationID:
+			component := v.([]Animation)[idx]
+			components[k] = component
 		case playerControlledID:
 			component := v.([]PlayerControlled)[idx]
 			components[k] = component
@@ -499,13 +782,33 @@ func (w *World) AddComponent(entity Entity, components map[ComponentID]any) {
 		case enemyID:
 			component := v.([]Enemy)[idx]
 			components[k] = component
+		case candyID:
+			component := v.([]Candy)[idx]
+			components[k] = component
+		case projectileID:
+			component := v.([]Projectile)[idx]
+			components[k] = component
+		case botID:
+			component := v.([]Bot)[idx]
+			components[k] = component
+		case statusEffectsID:
+			component := v.([]StatusEffects)[idx]
+			components[k] = component
+		case bunkerID:
+			component := v.([]Bunker)[idx]
+			components[k] = component
+		case bossID:
+			component := v.([]Boss)[idx]
+			components[k] = component
+		case bossPartID:
+			component := v.([]BossPart)[idx]
+			components[k] = component
 		default:
 			continue
 		}
 	}
-	w.CreateEntity(components)
 	oldArchetype.RemoveEntity(entity)
-	w.nextEntityID--
+	w.insertEntity(entity, components)
 }
 
 func (w *World) RemoveComponent(entity Entity, component ComponentID) {
@@ -557,16 +860,30 @@ func (w *World) RemoveComponent(entity Entity, component ComponentID) {
 		case candyID:
 			component := v.([]Candy)[idx]
 			components[k] = component
+		case projectileID:
+			component := v.([]Projectile)[idx]
+			components[k] = component
+		case botID:
+			component := v.([]Bot)[idx]
+			components[k] = component
+		case statusEffectsID:
+			component := v.([]StatusEffects)[idx]
+			components[k] = component
+		case bunkerID:
+			component := v.([]Bunker)[idx]
+			components[k] = component
+		case bossID:
+			component := v.([]Boss)[idx]
+			components[k] = component
+		case bossPartID:
+			component := v.([]BossPart)[idx]
+			components[k] = component
 		default:
 			continue
 		}
 	}
 	oldArchetype.RemoveEntity(entity)
-
-	mask = mask ^ component
-	w.entityMask[entity] = mask
-	w.nextEntityID--
-	w.CreateEntity(components)
+	w.insertEntity(entity, components)
 }
 
 func (w *World) RemoveEntity(entity Entity) {
@@ -579,8 +896,6 @@ func (w *World) RemoveEntity(entity Entity) {
 	entityArchetype.RemoveEntity(entity)
 
 	delete(w.entityMask, entity)
-	w.nextEntityID--
-
 }
 
 func (w *World) HasComponent(entity Entity, component ComponentID) bool {
@@ -589,7 +904,7 @@ func (w *World) HasComponent(entity Entity, component ComponentID) bool {
 		return false
 	}
 
-	return hasComponent(mask, component)
+	return hasComponent(component, mask)
 }
 
 func (w *World) HasComponents(entity Entity, components ...ComponentID) bool {
@@ -603,9 +918,39 @@ func (w *World) HasComponents(entity Entity, components ...ComponentID) bool {
 		componentsMask |= components[i]
 	}
 
-	return hasComponent(mask, componentsMask)
+	return hasComponent(componentsMask, mask)
 }
 
+func getComponent[T any](w *World, entity Entity, component ComponentID) (*T, bool) {
+	mask, ok := w.entityMask[entity]
+	if !ok || mask&component == 0 {
+		return nil, false
+	}
+	archetype := w.archetypes[mask]
+	components, ok := archetype.Components[component].([]T)
+	if !ok {
+		return nil, false
+	}
+	return &components[archetype.EntityToIndex[entity]], true
+}
+
+// Components returns a copy of every component of entity, by ID.
+func (w *World) Components(entity Entity) map[ComponentID]any {
+	mask, ok := w.entityMask[entity]
+	if !ok {
+		return nil
+	}
+	archetype := w.archetypes[mask]
+	idx := archetype.EntityToIndex[entity]
+	components := make(map[ComponentID]any, len(archetype.Components))
+	for id, column := range archetype.Components {
+		components[id] = cloneComponent(id, reflect.ValueOf(column).Index(idx).Interface())
+	}
+	return components
+}
+
+// Query returns the archetypes holding all of components, always in the same
+// order so that systems run the same way every time.
 func (w *World) Query(components ...ComponentID) []*Archetype {
 	var result []*Archetype
 	mask := GetMaskFromComponents(components...)
@@ -615,6 +960,7 @@ func (w *World) Query(components ...ComponentID) []*Archetype {
 			result = append(result, v)
 		}
 	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Mask < result[j].Mask })
 
 	return result
 }
@@ -651,41 +997,55 @@ func (s *MovementSystem) Update(dt float32) {
 	for archIdx := range archetypes {
 		entities := archetypes[archIdx].Entities
 		mover := archetypes[archIdx].Components[movementID].([]Movement)
+		player := archetypes[archIdx].Components[playerControlledID].([]PlayerControlled)
 		for idx := range entities {
-			mover[idx] = GetInput(mover[idx], dt)
+			next := GetInput(mover[idx], s.World.Input(player[idx].Index))
+			// A snake with a body can't turn back into its own neck.
+			if len(player[idx].Body) > 1 && next.Direction == rl.Vector2Negate(mover[idx].Direction) {
+				continue
+			}
+			mover[idx] = next
 		}
 	}
 
-	/*
-		archetypes = s.World.Query(positionID, movementID, IAControlledID)
-			for archIdx := range archetypes {
-				entities := archetypes[archIdx].Entities
-					mover := archetypes[archIdx].Components[movementID].([]Movement)
-
-					for _ := range entities {
-						// TODO: Define AI Behavior
-						 mover[idx].VelocityY = GRAVITY
-					}
-			}
-	*/
-
 	archetypes = s.World.Query(positionID, movementID)
 	for archIdx := range archetypes {
 		entities := archetypes[archIdx].Entities
 		position := archetypes[archIdx].Components[positionID].([]Position)
 		mover := archetypes[archIdx].Components[movementID].([]Movement)
-		collider, itCollides := archetypes[archIdx].Components[collidesID].([]Collides)
+		// Colliders keep last frame's position, CollisionSystem sweeps from it.
 		for idx := range entities {
-			position[idx].X += mover[idx].Direction.X * dt * PLAYER_MOVEMENT_SPEED
-			position[idx].Y += mover[idx].Direction.Y * dt * PLAYER_MOVEMENT_SPEED
-			if itCollides {
-				collider[idx].X = position[idx].X
-				collider[idx].Y = position[idx].Y
-			}
+			delta := mover[idx].Step(dt)
+			position[idx].X += delta.X
+			position[idx].Y += delta.Y
+		}
+	}
+
+	archetypes = s.World.Query(positionID, playerControlledID)
+	for archIdx := range archetypes {
+		entities := archetypes[archIdx].Entities
+		position := archetypes[archIdx].Components[positionID].([]Position)
+		player := archetypes[archIdx].Components[playerControlledID].([]PlayerControlled)
+		for idx := range entities {
+			player[idx].Follow(rl.Vector2{X: position[idx].X, Y: position[idx].Y}, s.World.gameState.arena)
 		}
 	}
+}
+
+// +++++++++++
+// AnimationSystem moves every animation on. Frames are part of the world, so
+// every peer and replay shows the same ones.
+type AnimationSystem struct {
+	BaseSystem
+}
 
-	// TODO: DEFINE BODY MOVEMENT BEHAVIOR
+func (s *AnimationSystem) Update(dt float32) {
+	for _, archetype := range s.World.Query(animationID) {
+		animation := archetype.Components[animationID].([]Animation)
+		for idx := range animation {
+			animation[idx].Step(dt)
+		}
+	}
 }
 
 // +++++++++++
@@ -694,9 +1054,14 @@ type DrawSystem struct {
 }
 
 func (s *DrawSystem) Update(dt float32) {
+	arena := s.World.gameState.arena
+
 	// Sprite
 	archetypes := s.World.Query(positionID, spriteID)
 	for archIdx := range archetypes {
+		if archetypes[archIdx].Mask&bunkerID != 0 {
+			continue
+		}
 		entities := archetypes[archIdx].Entities
 		position := archetypes[archIdx].Components[positionID].([]Position)
 		sprite := archetypes[archIdx].Components[spriteID].([]Sprite)
@@ -706,7 +1071,30 @@ func (s *DrawSystem) Update(dt float32) {
 			if itCollides {
 				rl.DrawRectangleRec(convertToRectangle(collider[idx]), rl.Green)
 			}
-			sprite[idx].Draw(position[idx].X, position[idx].Y)
+			for _, img := range arena.Images(position[idx].X, position[idx].Y, sprite[idx].Width, sprite[idx].Height) {
+				sprite[idx].Draw(img.X, img.Y)
+			}
+		}
+	}
+
+	// Bunkers, only the cells left of them
+	archetypes = s.World.Query(positionID, bunkerID)
+	for archIdx := range archetypes {
+		entities := archetypes[archIdx].Entities
+		position := archetypes[archIdx].Components[positionID].([]Position)
+		bunker := archetypes[archIdx].Components[bunkerID].([]Bunker)
+		sprite, hasSprite := archetypes[archIdx].Components[spriteID].([]Sprite)
+		for idx := range entities {
+			color := rl.Green
+			if hasSprite {
+				color = sprite[idx].Color
+			}
+			bunker[idx].EachCell(position[idx], func(box AABB) {
+				size := box.Size()
+				for _, img := range arena.Images(box.Min.X, box.Min.Y, size.X, size.Y) {
+					rl.DrawRectangleRec(rl.Rectangle{X: img.X, Y: img.Y, Width: size.X, Height: size.Y}, color)
+				}
+			})
 		}
 	}
 
@@ -722,61 +1110,29 @@ func (s *DrawSystem) Update(dt float32) {
 			if itCollides {
 				rl.DrawRectangleRec(convertToRectangle(collider[idx]), rl.Red)
 			}
-			animation[idx].Duration_left -= dt
-			animation[idx].Draw(position[idx].X, position[idx].Y)
+			for _, img := range arena.Images(position[idx].X, position[idx].Y, animation[idx].Sprite.Width, animation[idx].Sprite.Height) {
+				animation[idx].Draw(img.X, img.Y)
+			}
 		}
 	}
 
+	// Draw Body, the head is drawn by its sprite
 	archetypes = s.World.Query(playerControlledID)
-	// Draw Body
 	for archIdx := range archetypes {
 		entities := archetypes[archIdx].Entities
 		player := archetypes[archIdx].Components[playerControlledID].([]PlayerControlled)
-		movement := archetypes[archIdx].Components[movementID].([]Movement)
+		sprite, hasSprite := archetypes[archIdx].Components[spriteID].([]Sprite)
 		for idx := range entities {
+			color := rl.DarkGreen
+			if hasSprite {
+				color = rl.Fade(sprite[idx].Color, 0.7)
+			}
 			p := player[idx].Body
-			for i := range p {
-				if i == 0 {
-
-					rect := rl.Rectangle{p[i].X - movement[idx].Direction.X, p[i].Y - movement[idx].Direction.Y, RECTSIZE, RECTSIZE}
-					rl.DrawRectangleRec(rect, rl.Lime)
-					if len(p) == 1 {
-						continue
-					}
-					// rect = rl.Rectangle{p[idx].X, p[idx].Y, RECTSIZE, RECTSIZE}
-					// rl.DrawRectangleRec(rect, PLAYERCOLOR)
-					// continue
+			for i := len(p) - 1; i > 0; i-- {
+				for _, img := range arena.Images(p[i].X, p[i].Y, RECTSIZE, RECTSIZE) {
+					rl.DrawRectangleRec(rl.Rectangle{X: img.X, Y: img.Y, Width: RECTSIZE, Height: RECTSIZE}, color)
 				}
-				var dx float32
-				var dy float32
-				if p[idx].X == p[idx].X {
-					dx = 0
-					if p[idx].Y < p[idx].Y {
-						dy = 1
-					} else {
-						dy = -1
-					}
-				} else if p[idx].X > p[idx].X {
-					dx = -1
-					dy = 0
-				} else {
-					dx = 1
-					dy = 0
-				}
-				// p[idx].X + (dx * p.Frame), p[idx].Y + (dy * p.Frame),
-				// 	RECTSIZE, RECTSIZE,
-				// }
-
-				rect := rl.Rectangle{X: p[idx].X + dx, Y: p[idx].Y + dy, Width: RECTSIZE, Height: RECTSIZE}
-
-				// if i != len(p)-1 {
-				// 	rect = rl.Rectangle{
-				// 		p[idx].X, p[idx].Y,
-				// 		RECTSIZE, RECTSIZE,
-				// 	}
-				rl.DrawRectangleRec(rect, VICOLOR)
 			}
-
 		}
 	}
 }
@@ -786,71 +1142,212 @@ type CollisionSystem struct {
 	BaseSystem
 }
 
+const MAX_SWEEP_STEPS = 3
+
 func (s *CollisionSystem) Update(dt float32) {
-	log.Println("CollisionSystem called")
+	s.World.contacts = s.World.contacts[:0]
+	arena := s.World.gameState.arena
 	archetypes := s.World.Query(positionID, collidesID)
+
+	// Swept pass
+	for i := range archetypes {
+		if _, isMoving := archetypes[i].Components[movementID].([]Movement); !isMoving {
+			continue
+		}
+		position := archetypes[i].Components[positionID].([]Position)
+		collider := archetypes[i].Components[collidesID].([]Collides)
+		for idx := range archetypes[i].Entities {
+			delta := rl.Vector2{X: position[idx].X - collider[idx].X, Y: position[idx].Y - collider[idx].Y}
+			if delta.X == 0 && delta.Y == 0 {
+				continue
+			}
+			s.sweep(archetypes, i, idx, delta)
+		}
+	}
+
+	// Discrete pass
 	for i := range archetypes {
 		entitiesA := archetypes[i].Entities
 		positionA := archetypes[i].Components[positionID].([]Position)
 		colliderA := archetypes[i].Components[collidesID].([]Collides)
-		player, isPlayerA := archetypes[i].Components[playerControlledID].([]PlayerControlled)
 		_, isMovingA := archetypes[i].Components[movementID].([]Movement)
 		for j := range archetypes {
 			entitiesB := archetypes[j].Entities
 			positionB := archetypes[j].Components[positionID].([]Position)
 			colliderB := archetypes[j].Components[collidesID].([]Collides)
-			_, isCandyB := archetypes[j].Components[candyID].([]Candy)
+			_, isMovingB := archetypes[j].Components[movementID].([]Movement)
 
 			for idxA := range entitiesA {
 				for idxB := range entitiesB {
 					if archetypes[i] == archetypes[j] && idxA == idxB {
 						continue
 					}
-					var deleteCandy = func(entity Entity) {
-						if isCandyB && isPlayerA {
-							player[idxA].GrowBody(player[idxA].Body)
-							log.Printf("GROW BODY:%d\n", len(player[idxA].Body))
-							s.World.gameState.currentCandies--
-							archetypes[j].RemoveEntity(entity)
-						}
+					posB := arena.Nearest(positionA[idxA], positionB[idxB])
+					m, ok := OverlapAABB(colliderA[idxA].AABB(positionA[idxA]), colliderB[idxB].AABB(posB))
+					if !ok {
+						continue
 					}
-					switch CheckRectCollision(positionA[idxA], colliderA[idxA], positionB[idxB], colliderB[idxB]) {
-					case noC:
+					trigger := colliderA[idxA].Trigger || colliderB[idxB].Trigger
+					s.World.addContact(Contact{Entity: entitiesA[idxA], Other: entitiesB[idxB], Trigger: trigger})
+					if trigger || !isMovingA {
 						continue
-					case topC:
-						if isMovingA {
-							log.Println("Bottom")
-							positionA[idxA].Y = positionB[idxB].Y - colliderA[idxA].Height
-							colliderA[idxA].Y = positionB[idxB].Y - colliderA[idxA].Height
-						}
-						deleteCandy(entitiesB[idxB])
-					case bottomC:
-						if isMovingA {
-							positionA[idxA].Y = positionB[idxB].Y + colliderB[idxB].Height
-							colliderA[idxA].Y = positionB[idxB].Y + colliderB[idxB].Height
-						}
-						deleteCandy(entitiesB[idxB])
-					case leftC:
-						if isMovingA {
-							log.Println("Left")
-							positionA[idxA].X = positionB[idxB].X - colliderA[idxA].Width
-							colliderA[idxA].X = positionB[idxB].X - colliderA[idxA].Width
-						}
-						deleteCandy(entitiesB[idxB])
-					case rightC:
-						if isMovingA {
-							log.Println("Right")
-							positionA[idxA].X = positionB[idxB].X + colliderB[idxB].Width
-							colliderA[idxA].X = positionB[idxB].X + colliderB[idxB].Width
-						}
-						deleteCandy(entitiesB[idxB])
-					case overlapC:
-						log.Printf("Full overlap point = %v\n", positionA)
-					default:
 					}
 
+					// Two solid movers split the correction, each one takes its half.
+					depth := m.Depth
+					if isMovingB && !colliderB[idxB].Trigger {
+						depth /= 2
+					}
+					positionA[idxA].X -= m.Normal.X * depth
+					positionA[idxA].Y -= m.Normal.Y * depth
+				}
+			}
+		}
+	}
+
+	for i := range archetypes {
+		position := archetypes[i].Components[positionID].([]Position)
+		collider := archetypes[i].Components[collidesID].([]Collides)
+		for idx := range archetypes[i].Entities {
+			collider[idx].X = position[idx].X
+			collider[idx].Y = position[idx].Y
+		}
+	}
+}
+
+// sweep moves the collider of entity idx in archetypes[i] along delta,
+// stopping at the first solid it meets and sliding along it with whatever
+// movement is left. Triggers crossed on the way are reported as contacts.
+func (s *CollisionSystem) sweep(archetypes []*Archetype, i, idx int, delta rl.Vector2) {
+	type crossing struct {
+		toi   float32
+		other Entity
+	}
+
+	arena := s.World.gameState.arena
+	entity := archetypes[i].Entities[idx]
+	position := archetypes[i].Components[positionID].([]Position)
+	collider := archetypes[i].Components[collidesID].([]Collides)
+	for range MAX_SWEEP_STEPS {
+		start := Position{X: collider[idx].X, Y: collider[idx].Y}
+		toi := float32(1)
+		var normal rl.Vector2
+		var blocker Entity
+		var crossed []crossing
+		blocked := false
+		for j := range archetypes {
+			entitiesB := archetypes[j].Entities
+			positionB := archetypes[j].Components[positionID].([]Position)
+			colliderB := archetypes[j].Components[collidesID].([]Collides)
+			for idxB := range entitiesB {
+				if i == j && idx == idxB {
+					continue
+				}
+				posB := arena.Nearest(start, positionB[idxB])
+				hit, ok := SweepAABB(collider[idx].Bounds(), delta, colliderB[idxB].AABB(posB))
+				if !ok {
+					continue
 				}
+				if collider[idx].Trigger || colliderB[idxB].Trigger {
+					crossed = append(crossed, crossing{hit.T, entitiesB[idxB]})
+					continue
+				}
+				if hit.T < toi {
+					toi, normal, blocker, blocked = hit.T, hit.Normal, entitiesB[idxB], true
+				}
+			}
+		}
+
+		for _, c := range crossed {
+			if c.toi <= toi {
+				s.World.addContact(Contact{Entity: entity, Other: c.other, Trigger: true})
+			}
+		}
+		collider[idx].X += delta.X * toi
+		collider[idx].Y += delta.Y * toi
+		if !blocked {
+			break
+		}
+		s.World.addContact(Contact{Entity: entity, Other: blocker})
+
+		delta.X *= 1 - toi
+		delta.Y *= 1 - toi
+		if normal.X != 0 {
+			delta.X = 0
+		} else {
+			delta.Y = 0
+		}
+	}
+	position[idx].X = collider[idx].X
+	position[idx].Y = collider[idx].Y
+}
+
+// +++++++++++
+// ContactSystem reacts to the contacts gathered by CollisionSystem, so it
+// must run right after it.
+type ContactSystem struct {
+	BaseSystem
+}
+
+func (s *ContactSystem) Update(dt float32) {
+	for _, c := range s.World.contacts {
+		if s.World.HasComponent(c.Other, bunkerID) {
+			s.hitBunker(c.Entity, c.Other, dt)
+			continue
+		}
+		if projectile, ok := getComponent[Projectile](s.World, c.Entity, projectileID); ok {
+			s.hitByProjectile(c, *projectile)
+			continue
+		}
+		if !c.Trigger {
+			if s.World.HasComponent(c.Entity, playerControlledID) {
+				cause := DEATH_WALL
+				if s.World.HasComponent(c.Other, enemyID) {
+					cause = DEATH_INVADER
+				} else if s.World.HasComponent(c.Other, playerControlledID) {
+					cause = DEATH_HEAD_ON
+				}
+				s.World.KillPlayer(c.Entity, cause)
+			}
+			continue
+		}
+		if s.World.HasComponent(c.Other, candyID) {
+			s.World.EatCandy(c.Entity, c.Other)
+		}
+	}
+}
+
+func (s *ContactSystem) hitByProjectile(c Contact, projectile Projectile) {
+	if c.Other == projectile.Owner || s.World.HasComponent(c.Other, projectileID) {
+		return
+	}
+	if other, ok := getComponent[Collides](s.World, c.Other, collidesID); !ok || other.Trigger {
+		return
+	}
+	if projectile.Enemy {
+		if s.World.HasComponent(c.Other, enemyID) {
+			return
+		}
+		if s.World.HasComponent(c.Other, playerControlledID) {
+			s.World.KillPlayer(c.Other, DEATH_SHOT)
+			s.World.RemoveEntity(c.Entity)
+			return
+		}
+	}
+	if health, ok := getComponent[Health](s.World, c.Other, healthID); ok {
+		health.Current -= projectile.Damage
+		if health.Current <= 0 && !s.World.HasComponent(c.Other, playerControlledID) {
+			if enemy, ok := getComponent[Enemy](s.World, c.Other, enemyID); ok {
+				s.World.AddScore(projectile.Owner, s.World.EnemyScore(*enemy))
+				if status, ok := s.World.PlayerStatusOf(projectile.Owner); ok {
+					status.Kills++
+				}
+			}
+			s.World.RemoveEntity(c.Other)
+			if projectile.Pierce {
+				return
 			}
 		}
 	}
+	s.World.RemoveEntity(c.Entity)
 }
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"log"
+	"slices"
+)
+
+// ===STATUS EFFECTS===
+//
+// Power-ups put timed effects on whoever picks them up, kept in its
+// StatusEffects component. StatusEffectSystem runs their time down and other
+// systems ask Effect whether one is on:
+//
+//	speed       moves Strength times as fast
+//	slow        moves Strength times as fast, for slow motion
+//	invincible  can't die
+//	piercing    shots go on through whatever they destroy
+//	magnet      pulls candies within Strength pixels to the head
+//	ghost       goes through its own body
+//
+// Getting an effect that is already on follows the rule of its kind, see
+// EFFECT_RULES, and the newer Strength always wins. Speed and slow undo each
+// other. Every effect that ends, runs out or is undone, emits an event. Once
+// the last speed or slow ends the entity gets back the speed it had before,
+// and once the last effect ends it loses its StatusEffects.
+
+type EffectKind string
+
+const (
+	EffectSpeed      EffectKind = "speed"
+	EffectSlow       EffectKind = "slow"
+	EffectInvincible EffectKind = "invincible"
+	EffectPiercing   EffectKind = "piercing"
+	EffectMagnet     EffectKind = "magnet"
+	EffectGhost      EffectKind = "ghost"
+)
+
+const (
+	MAGNET_REACH = 5 * RECTSIZE
+	MAGNET_SPEED = 180
+)
+
+type StatusEffect struct {
+	Kind EffectKind
+	// Time is how many seconds the effect has left.
+	Time     float32
+	Strength float32
+}
+
+type stackRule int
+
+const (
+	// stackRefresh starts the time over, when the new one is longer.
+	stackRefresh stackRule = iota
+	// stackExtend adds the new time to what is left, up to MaxTime.
+	stackExtend
+)
+
+type effectRule struct {
+	Stack   stackRule
+	MaxTime float32
+	Cancels []EffectKind
+}
+
+var EFFECT_RULES = map[EffectKind]effectRule{
+	EffectSpeed:      {Stack: stackExtend, MaxTime: 15, Cancels: []EffectKind{EffectSlow}},
+	EffectSlow:       {Stack: stackRefresh, Cancels: []EffectKind{EffectSpeed}},
+	EffectInvincible: {Stack: stackRefresh},
+	EffectPiercing:   {Stack: stackExtend, MaxTime: 20},
+	EffectMagnet:     {Stack: stackExtend, MaxTime: 20},
+	EffectGhost:      {Stack: stackRefresh},
+}
+
+// AddEffect puts effect on entity. It moves the entity to another archetype
+// the first time, so it must not be called while iterating over a query.
+func (w *World) AddEffect(entity Entity, effect StatusEffect) {
+	rule, ok := EFFECT_RULES[effect.Kind]
+	if !ok {
+		log.Printf("unknown status effect %q\n", effect.Kind)
+		return
+	}
+	effects, ok := getComponent[StatusEffects](w, entity, statusEffectsID)
+	if !ok {
+		var status StatusEffects
+		if mover, ok := getComponent[Movement](w, entity, movementID); ok {
+			status.BaseSpeed = mover.Speed
+		}
+		status.Effects = []StatusEffect{effect}
+		w.AddComponent(entity, map[ComponentID]any{statusEffectsID: status})
+		return
+	}
+	// The speed to go back to is the one from before any speed or slow.
+	if changesSpeed(effect.Kind) && !effects.changesSpeed() {
+		if mover, ok := getComponent[Movement](w, entity, movementID); ok {
+			effects.BaseSpeed = mover.Speed
+		}
+	}
+
+	effects.Effects = slices.DeleteFunc(effects.Effects, func(e StatusEffect) bool {
+		if slices.Contains(rule.Cancels, e.Kind) {
+			w.endEffect(entity, e)
+			return true
+		}
+		return false
+	})
+	for i := range effects.Effects {
+		current := &effects.Effects[i]
+		if current.Kind != effect.Kind {
+			continue
+		}
+		switch rule.Stack {
+		case stackExtend:
+			current.Time = min(current.Time+effect.Time, max(rule.MaxTime, effect.Time))
+		default:
+			current.Time = max(current.Time, effect.Time)
+		}
+		current.Strength = effect.Strength
+		return
+	}
+	effects.Effects = append(effects.Effects, effect)
+}
+
+// Effect returns the effect of kind on entity, if there is one.
+func (w *World) Effect(entity Entity, kind EffectKind) (StatusEffect, bool) {
+	effects, ok := getComponent[StatusEffects](w, entity, statusEffectsID)
+	if !ok {
+		return StatusEffect{}, false
+	}
+	return effects.Get(kind)
+}
+
+func (s StatusEffects) Get(kind EffectKind) (StatusEffect, bool) {
+	for _, e := range s.Effects {
+		if e.Kind == kind {
+			return e, true
+		}
+	}
+	return StatusEffect{}, false
+}
+
+func changesSpeed(kind EffectKind) bool {
+	return kind == EffectSpeed || kind == EffectSlow
+}
+
+func (s StatusEffects) changesSpeed() bool {
+	return slices.ContainsFunc(s.Effects, func(e StatusEffect) bool { return changesSpeed(e.Kind) })
+}
+
+func (w *World) endEffect(entity Entity, effect StatusEffect) {
+	event := Event{Kind: EventEffectEnded, Entity: entity, Effect: effect.Kind}
+	if position, ok := getComponent[Position](w, entity, positionID); ok {
+		event.Position = *position
+	}
+	w.Emit(event)
+}
+
+// +++++++++++
+// StatusEffectSystem runs down the time of every effect, ending the ones that
+// run out, and sets the speed of everything moving with speed or slow on or
+// just ended. It must run before MovementSystem.
+type StatusEffectSystem struct {
+	BaseSystem
+}
+
+func (s *StatusEffectSystem) Update(dt float32) {
+	type ended struct {
+		entity Entity
+		effect StatusEffect
+	}
+	var done []ended
+	var cleared []Entity
+	for _, archetype := range s.World.Query(statusEffectsID) {
+		effects := archetype.Components[statusEffectsID].([]StatusEffects)
+		mover, moves := archetype.Components[movementID].([]Movement)
+		for idx, entity := range archetype.Entities {
+			status := &effects[idx]
+			scaled := false
+			status.Effects = slices.DeleteFunc(status.Effects, func(e StatusEffect) bool {
+				if e.Time <= dt {
+					done = append(done, ended{entity, e})
+					scaled = scaled || changesSpeed(e.Kind)
+					return true
+				}
+				return false
+			})
+			speed := status.BaseSpeed
+			for i := range status.Effects {
+				status.Effects[i].Time -= dt
+				if changesSpeed(status.Effects[i].Kind) {
+					speed *= status.Effects[i].Strength
+					scaled = true
+				}
+			}
+			if moves && scaled {
+				mover[idx].Speed = speed
+			}
+			if len(status.Effects) == 0 {
+				cleared = append(cleared, entity)
+			}
+		}
+	}
+	for _, entity := range cleared {
+		s.World.RemoveComponent(entity, statusEffectsID)
+	}
+	for _, d := range done {
+		s.World.endEffect(d.entity, d.effect)
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func effectWorld(t *testing.T) (*World, Entity, *StatusEffectSystem) {
+	t.Helper()
+	w := NewWorld()
+	entity := w.CreateEntity(map[ComponentID]any{
+		positionID: Position{X: 10, Y: 20},
+		movementID: Movement{Speed: 100, Drag: 0.5, MaxSpeed: 300},
+	})
+	return w, entity, *NewSystem(w, &StatusEffectSystem{})
+}
+
+func endedEffects(events []Event) []EffectKind {
+	var kinds []EffectKind
+	for _, e := range events {
+		if e.Kind == EventEffectEnded {
+			kinds = append(kinds, e.Effect)
+		}
+	}
+	return kinds
+}
+
+func TestEffectStacking(t *testing.T) {
+	tests := []struct {
+		name  string
+		first StatusEffect
+		then  StatusEffect
+		want  StatusEffect
+	}{
+		{"extend adds time", StatusEffect{EffectPiercing, 5, 1}, StatusEffect{EffectPiercing, 4, 1}, StatusEffect{EffectPiercing, 9, 1}},
+		{"extend stops at MaxTime", StatusEffect{EffectSpeed, 10, 1.5}, StatusEffect{EffectSpeed, 10, 1.5}, StatusEffect{EffectSpeed, 15, 1.5}},
+		{"extend keeps a longer new time", StatusEffect{EffectSpeed, 10, 1.5}, StatusEffect{EffectSpeed, 20, 1.5}, StatusEffect{EffectSpeed, 20, 1.5}},
+		{"refresh keeps the longer", StatusEffect{EffectInvincible, 5, 1}, StatusEffect{EffectInvincible, 3, 1}, StatusEffect{EffectInvincible, 5, 1}},
+		{"refresh starts over", StatusEffect{EffectGhost, 2, 1}, StatusEffect{EffectGhost, 6, 1}, StatusEffect{EffectGhost, 6, 1}},
+		{"newer strength wins", StatusEffect{EffectSlow, 5, 0.5}, StatusEffect{EffectSlow, 1, 0.8}, StatusEffect{EffectSlow, 5, 0.8}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, entity, _ := effectWorld(t)
+			w.AddEffect(entity, tt.first)
+			w.AddEffect(entity, tt.then)
+			effects, _ := getComponent[StatusEffects](w, entity, statusEffectsID)
+			if len(effects.Effects) != 1 || effects.Effects[0] != tt.want {
+				t.Errorf("effects %v, want [%v]", effects.Effects, tt.want)
+			}
+		})
+	}
+}
+
+func TestEffectCancels(t *testing.T) {
+	w, entity, _ := effectWorld(t)
+	w.AddEffect(entity, StatusEffect{EffectSlow, 5, 0.5})
+	w.AddEffect(entity, StatusEffect{EffectMagnet, 5, 1})
+	w.AddEffect(entity, StatusEffect{EffectSpeed, 5, 1.5})
+	if _, ok := w.Effect(entity, EffectSlow); ok {
+		t.Error("speed did not undo slow")
+	}
+	if _, ok := w.Effect(entity, EffectMagnet); !ok {
+		t.Error("speed undid magnet")
+	}
+	if got := endedEffects(w.DrainEvents()); !slices.Equal(got, []EffectKind{EffectSlow}) {
+		t.Errorf("ended %v, want [slow]", got)
+	}
+}
+
+func TestEffectExpiry(t *testing.T) {
+	w, entity, system := effectWorld(t)
+	w.AddEffect(entity, StatusEffect{EffectSlow, 0.5, 0.5})
+	w.AddEffect(entity, StatusEffect{EffectGhost, 1, 1})
+
+	system.Update(0.25)
+	mover, _ := getComponent[Movement](w, entity, movementID)
+	if mover.Speed != 50 {
+		t.Errorf("slowed speed %v, want 50", mover.Speed)
+	}
+	system.Update(0.25)
+	events := w.DrainEvents()
+	if got := endedEffects(events); !slices.Equal(got, []EffectKind{EffectSlow}) {
+		t.Fatalf("ended %v, want [slow]", got)
+	}
+	if events[0].Position != (Position{X: 10, Y: 20}) {
+		t.Errorf("event at %v", events[0].Position)
+	}
+	if mover.Speed != 100 {
+		t.Errorf("speed %v after slow, want 100", mover.Speed)
+	}
+
+	// With no speed or slow on, the speed is left to others.
+	mover.Speed = 120
+	system.Update(0.25)
+	if mover.Speed != 120 {
+		t.Errorf("speed %v was overwritten", mover.Speed)
+	}
+	system.Update(0.25)
+	if got := endedEffects(w.DrainEvents()); !slices.Equal(got, []EffectKind{EffectGhost}) {
+		t.Errorf("ended %v, want [ghost]", got)
+	}
+	if w.HasComponent(entity, statusEffectsID) {
+		t.Error("StatusEffects left after the last effect")
+	}
+	mover, _ = getComponent[Movement](w, entity, movementID)
+	if mover.Speed != 120 || mover.Drag != 0.5 || mover.MaxSpeed != 300 {
+		t.Errorf("movement %+v", *mover)
+	}
+
+	// The next slow starts from the speed the entity has then.
+	w.AddEffect(entity, StatusEffect{EffectGhost, 1, 1})
+	mover, _ = getComponent[Movement](w, entity, movementID)
+	mover.Speed = 80
+	w.AddEffect(entity, StatusEffect{EffectSlow, 1, 0.5})
+	system.Update(0.1)
+	if mover.Speed != 40 {
+		t.Errorf("slowed speed %v, want 40", mover.Speed)
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+// ===ENEMIES===
+//
+// Every enemy is of a kind, set in its prefab with what killing it is worth:
+//
+//	marcher  keeps its place in the formation
+//	diver    now and then breaks off to swoop at the nearest snake, then
+//	         flies back to its place
+//	shooter  fires at the nearest snake every few seconds
+//	tank     takes as many shots as its Health
+//	ufo      crosses the top of the arena, worth one of UFO_SCORES
+//	snake    goes for the candies, taking them from the snakes, and runs from
+//	         snake heads that come near
+//	boss     a part of a boss, see BossSystem
+//
+// Whatever their kind, invaders of a formation march and fire with it, see
+// WaveSystem. Divers and shooters do the rest with the machine of their
+// prefab, see AISystem, and so do enemy snakes.
+
+type EnemyKind string
+
+const (
+	EnemyMarcher EnemyKind = "marcher"
+	EnemyDiver   EnemyKind = "diver"
+	EnemyShooter EnemyKind = "shooter"
+	EnemyTank    EnemyKind = "tank"
+	EnemyUFO     EnemyKind = "ufo"
+	EnemySnake   EnemyKind = "snake"
+	EnemyBoss    EnemyKind = "boss"
+)
+
+// UFO_SCORES are what a UFO may turn out to be worth.
+var UFO_SCORES = []int{50, 100, 150, 300}
+
+// EnemyScore is what killing enemy is worth.
+func (w *World) EnemyScore(enemy Enemy) int {
+	if enemy.Kind == EnemyUFO {
+		return UFO_SCORES[w.rng.IntN(len(UFO_SCORES))]
+	}
+	return enemy.Score
+}
+
+// nearestHead returns the snake head closest to from, if any snake is alive.
+func (w *World) nearestHead(from Position) (Position, bool) {
+	var nearest Position
+	best := float32(-1)
+	for _, archetype := range w.Query(playerControlledID, positionID) {
+		for _, head := range archetype.Components[positionID].([]Position) {
+			d := GetVectorLength(w.gameState.arena.Delta(rl.Vector2{X: from.X, Y: from.Y}, rl.Vector2{X: head.X, Y: head.Y}))
+			if best < 0 || d < best {
+				nearest, best = head, d
+			}
+		}
+	}
+	return nearest, best >= 0
+}
+
+// aim returns the direction from the centre of box to the centre of the head
+// at target.
+func (w *World) aim(box AABB, target Position) rl.Vector2 {
+	from := rl.Vector2{X: (box.Min.X + box.Max.X) / 2, Y: (box.Min.Y + box.Max.Y) / 2}
+	to := rl.Vector2{X: target.X + RECTSIZE/2, Y: target.Y + RECTSIZE/2}
+	return rl.Vector2Normalize(w.gameState.arena.Delta(from, to))
+}
+
+// SpawnEnemyShot fires a shot of owner, an enemy, from x, y along direction.
+func SpawnEnemyShot(w *World, owner Entity, x, y float32, direction rl.Vector2, speed float32) error {
+	shot, err := SpawnProjectile(w, owner, x, y, direction, speed)
+	if err != nil {
+		return err
+	}
+	if projectile, ok := getComponent[Projectile](w, shot, projectileID); ok {
+		projectile.Enemy = true
+	}
+	return nil
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"slices"
+	"testing"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+func TestEnemyScore(t *testing.T) {
+	w := spawnWorld(t)
+	if got := w.EnemyScore(Enemy{Kind: EnemyTank, Score: 200}); got != 200 {
+		t.Errorf("tank worth %d", got)
+	}
+	seen := make(map[int]bool)
+	for range 200 {
+		score := w.EnemyScore(Enemy{Kind: EnemyUFO, Score: 5})
+		if !slices.Contains(UFO_SCORES, score) {
+			t.Fatalf("UFO worth %d", score)
+		}
+		seen[score] = true
+	}
+	if len(seen) != len(UFO_SCORES) {
+		t.Errorf("UFOs were worth only %v", seen)
+	}
+}
+
+func TestNearestHead(t *testing.T) {
+	w := spawnWorld(t)
+	if _, ok := w.nearestHead(Position{}); ok {
+		t.Error("a head with no snake")
+	}
+	for i, x := range []float32{100, 560} {
+		if _, err := SpawnPlayer(w, i, x, 300); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if head, _ := w.nearestHead(Position{X: 20, Y: 300}); head.X != 100 {
+		t.Errorf("nearest head at %v", head.X)
+	}
+	w.gameState.arena.Wrap = true
+	if head, _ := w.nearestHead(Position{X: 20, Y: 300}); head.X != 560 {
+		t.Errorf("nearest head across the edge at %v", head.X)
+	}
+	box := NewAABB(0, 290, 20, 40)
+	if got := w.aim(box, Position{X: 560, Y: 300}); got != (rl.Vector2{X: -1}) {
+		t.Errorf("aimed %v across the edge", got)
+	}
+}
+
+func TestEnemyShots(t *testing.T) {
+	w := spawnWorld(t)
+	w.gameState.players = make([]PlayerStatus, 1)
+	w.gameState.players[0].Alive = true
+	head, _ := SpawnPlayer(w, 0, 300, 400)
+	tank, _ := w.Spawn("invader_tank", map[ComponentID]any{positionID: Position{X: 300, Y: 100}})
+	invader, _ := w.Spawn("invader", map[ComponentID]any{positionID: Position{X: 200, Y: 100}})
+	contacts := *NewSystem(w, &ContactSystem{})
+	hit := func(owner, target Entity) {
+		t.Helper()
+		shot, err := SpawnProjectile(w, owner, 0, 0, rl.Vector2{Y: 1}, 100)
+		if err != nil {
+			t.Fatal(err)
+		}
+		projectile, _ := getComponent[Projectile](w, shot, projectileID)
+		projectile.Enemy = owner != head
+		contacts.hitByProjectile(Contact{Entity: shot, Other: target, Trigger: true}, *projectile)
+	}
+
+	for i := range 3 {
+		if !w.HasComponent(tank, enemyID) {
+			t.Fatalf("the tank went after %d shots", i)
+		}
+		hit(head, tank)
+	}
+	if w.HasComponent(tank, enemyID) {
+		t.Error("the tank took more than its health")
+	}
+	if status := w.gameState.players[0]; status.Score != 200 || status.Kills != 1 {
+		t.Errorf("status %+v after the tank", status)
+	}
+
+	hit(tank, invader)
+	if !w.HasComponent(invader, enemyID) {
+		t.Error("an enemy shot killed an invader")
+	}
+	hit(invader, head)
+	if status := w.gameState.players[0]; w.HasComponent(head, playerControlledID) || status.Cause != DEATH_SHOT {
+		t.Errorf("the shot snake is %+v", status)
+	}
+}
+
+// A diver that dives flies back to its place, however long that takes, and
+// never jumps there.
+func TestDiverFliesBack(t *testing.T) {
+	w := spawnWorld(t)
+	if _, err := SpawnPlayer(w, 0, 300, 560); err != nil {
+		t.Fatal(err)
+	}
+	enemy, _ := w.PrefabComponent("invader_diver", enemyID).(Enemy)
+	enemy.Formation = true
+	diver, err := w.Spawn("invader_diver", map[ComponentID]any{positionID: Position{X: 300, Y: 60}, enemyID: enemy})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ai := *NewSystem(w, &AISystem{})
+	movement := *NewSystem(w, &MovementSystem{})
+	tick := func() {
+		ai.Update(TICK)
+		movement.Update(TICK)
+	}
+	state := func() (string, Enemy, Position) {
+		c, _ := getComponent[IAControlled](w, diver, IAControlledID)
+		e, _ := getComponent[Enemy](w, diver, enemyID)
+		p, _ := getComponent[Position](w, diver, positionID)
+		return c.State, *e, *p
+	}
+
+	dived := false
+	for range 10 * TICK_RATE {
+		tick()
+		if s, _, _ := state(); s == "dive" {
+			dived = true
+			break
+		}
+	}
+	if !dived {
+		t.Fatal("the diver never dived")
+	}
+
+	// Far from its place it takes longer than the dive to get back.
+	_, e, _ := state()
+	slot := e.Slot
+	p, _ := getComponent[Position](w, diver, positionID)
+	*p = Position{X: 20, Y: 560}
+	c, _ := getComponent[IAControlled](w, diver, IAControlledID)
+	c.State, c.Time = "return", 0
+
+	ticks := 0
+	for {
+		_, _, before := state()
+		tick()
+		ticks++
+		s, e, after := state()
+		if d := rl.Vector2Distance(rl.Vector2{X: before.X, Y: before.Y}, rl.Vector2{X: after.X, Y: after.Y}); d > 200*TICK+0.01 {
+			t.Fatalf("the diver jumped %v pixels in state %s", d, s)
+		}
+		if s == "formation" {
+			if e.Away || after != slot {
+				t.Errorf("back at %+v away %v, slot %+v", after, e.Away, slot)
+			}
+			break
+		}
+		if ticks > 10*TICK_RATE {
+			t.Fatalf("the diver is still %s at %+v", s, after)
+		}
+	}
+	if ticks <= 5*TICK_RATE/2 {
+		t.Errorf("back after %d ticks", ticks)
+	}
+}
+
+// An enemy snake goes for the candies and takes them, and runs from the snakes
+// that come near.
+func TestEnemySnake(t *testing.T) {
+	w := spawnWorld(t)
+	candy, _ := w.Spawn("candy", map[ComponentID]any{positionID: Position{X: 100, Y: 300}})
+	snake, err := w.Spawn("enemy_snake", map[ComponentID]any{positionID: Position{X: 300, Y: 300}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ai := *NewSystem(w, &AISystem{})
+	state := func() (string, Movement) {
+		c, _ := getComponent[IAControlled](w, snake, IAControlledID)
+		mover, _ := getComponent[Movement](w, snake, movementID)
+		return c.State, *mover
+	}
+
+	ai.Update(TICK)
+	if s, mover := state(); s != "hungry" || mover.Direction != (rl.Vector2{X: -1}) || mover.Speed != 80 {
+		t.Errorf("%s moving %+v", s, mover)
+	}
+	head, _ := SpawnPlayer(w, 0, 220, 300)
+	ai.Update(TICK)
+	if s, mover := state(); s != "flee" || mover.Direction != (rl.Vector2{X: 1}) || mover.Speed != 120 {
+		t.Errorf("%s moving %+v", s, mover)
+	}
+	w.RemoveEntity(head)
+
+	invader, _ := w.Spawn("invader", map[ComponentID]any{positionID: Position{X: 100, Y: 300}})
+	w.EatCandy(invader, candy)
+	if !w.HasComponent(candy, candyID) {
+		t.Fatal("an invader ate the candy")
+	}
+	w.EatCandy(snake, candy)
+	if w.HasComponent(candy, candyID) || !emitted(w.DrainEvents(), EventCandyEaten) {
+		t.Fatal("the enemy snake left the candy")
+	}
+	for range TICK_RATE + 2 {
+		ai.Update(TICK)
+	}
+	if s, mover := state(); s != "wait" || mover.Speed != 0 {
+		t.Errorf("%s moving %+v with no candy", s, mover)
+	}
+
+	level, err := LoadLevel("levels/04_fortress.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w = spawnWorld(t)
+	if err := level.Build(w, SOLO); err != nil {
+		t.Fatal(err)
+	}
+	snakes := 0
+	for _, archetype := range w.Query(enemyID) {
+		for _, enemy := range archetype.Components[enemyID].([]Enemy) {
+			if enemy.Kind == EnemySnake {
+				snakes++
+			}
+		}
+	}
+	if snakes != 1 {
+		t.Errorf("%d enemy snakes in the fortress", snakes)
+	}
+}
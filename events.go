@@ -0,0 +1,47 @@
+package main
+
+// ===EVENTS===
+//
+// Systems note what happened during a tick as events, for whoever draws or
+// plays the world to pick up with DrainEvents. Nothing in the simulation
+// reads them. A world nobody drains keeps only the last MAX_EVENTS.
+
+const MAX_EVENTS = 256
+
+type EventKind int
+
+const (
+	EventCandyEaten EventKind = iota
+	EventEffectEnded
+	EventWaveStarted
+	EventWaveCleared
+	EventBossPhase
+	EventBossDefeated
+)
+
+type Event struct {
+	Tick     uint64
+	Kind     EventKind
+	Entity   Entity
+	Position Position
+	Sound    Sound
+	// Effect is the status effect that ended.
+	Effect EffectKind
+	// Wave is the wave that started or was cleared, or the boss is in.
+	Wave int
+}
+
+func (w *World) Emit(e Event) {
+	e.Tick = w.tick
+	if len(w.events) >= MAX_EVENTS {
+		w.events = append(w.events[:0], w.events[1:]...)
+	}
+	w.events = append(w.events, e)
+}
+
+// DrainEvents returns the events emitted since the last call.
+func (w *World) DrainEvents() []Event {
+	events := w.events
+	w.events = nil
+	return events
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"math"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+// ===PRIMITIVES===
+type AABB struct {
+	Min rl.Vector2
+	Max rl.Vector2
+}
+
+type Circle struct {
+	Center rl.Vector2
+	Radius float32
+}
+
+type Segment struct {
+	A rl.Vector2
+	B rl.Vector2
+}
+
+func NewAABB(x, y, width, height float32) AABB {
+	return AABB{Min: rl.Vector2{X: x, Y: y}, Max: rl.Vector2{X: x + width, Y: y + height}}
+}
+
+// AABB returns the box of c placed at pos.
+func (c Collides) AABB(pos Position) AABB {
+	return NewAABB(pos.X, pos.Y, c.Width, c.Height)
+}
+
+// Bounds returns the box of c where it was last resolved.
+func (c Collides) Bounds() AABB {
+	return NewAABB(c.X, c.Y, c.Width, c.Height)
+}
+
+func (b AABB) Center() rl.Vector2 {
+	return rl.Vector2{X: (b.Min.X + b.Max.X) / 2, Y: (b.Min.Y + b.Max.Y) / 2}
+}
+
+func (b AABB) Size() rl.Vector2 {
+	return rl.Vector2{X: b.Max.X - b.Min.X, Y: b.Max.Y - b.Min.Y}
+}
+
+func (b AABB) Translate(v rl.Vector2) AABB {
+	return AABB{Min: rl.Vector2Add(b.Min, v), Max: rl.Vector2Add(b.Max, v)}
+}
+
+// Union is the smallest box holding both b and o.
+func (b AABB) Union(o AABB) AABB {
+	return AABB{
+		Min: rl.Vector2{X: min(b.Min.X, o.Min.X), Y: min(b.Min.Y, o.Min.Y)},
+		Max: rl.Vector2{X: max(b.Max.X, o.Max.X), Y: max(b.Max.Y, o.Max.Y)},
+	}
+}
+
+// ===MANIFOLDS===
+
+// Manifold describes how two shapes overlap. Normal is a unit vector pointing
+// from the first shape towards the second, so moving the first one by
+// -Normal*Depth separates them.
+type Manifold struct {
+	Normal rl.Vector2
+	Depth  float32
+}
+
+func OverlapAABB(a, b AABB) (Manifold, bool) {
+	overlapX := min(a.Max.X, b.Max.X) - max(a.Min.X, b.Min.X)
+	overlapY := min(a.Max.Y, b.Max.Y) - max(a.Min.Y, b.Min.Y)
+	if overlapX <= 0 || overlapY <= 0 {
+		return Manifold{}, false
+	}
+
+	d := rl.Vector2Subtract(b.Center(), a.Center())
+	if overlapX < overlapY {
+		return Manifold{Normal: rl.Vector2{X: signOr(d.X, 1)}, Depth: overlapX}, true
+	}
+	return Manifold{Normal: rl.Vector2{Y: signOr(d.Y, 1)}, Depth: overlapY}, true
+}
+
+func OverlapCircles(a, b Circle) (Manifold, bool) {
+	d := rl.Vector2Subtract(b.Center, a.Center)
+	dist := GetVectorLength(d)
+	radius := a.Radius + b.Radius
+	if dist >= radius {
+		return Manifold{}, false
+	}
+	if dist == 0 {
+		return Manifold{Normal: rl.Vector2{X: 1}, Depth: radius}, true
+	}
+	return Manifold{Normal: rl.Vector2Scale(d, 1/dist), Depth: radius - dist}, true
+}
+
+func OverlapAABBCircle(a AABB, c Circle) (Manifold, bool) {
+	closest := rl.Vector2{X: Clamp(c.Center.X, a.Min.X, a.Max.X), Y: Clamp(c.Center.Y, a.Min.Y, a.Max.Y)}
+	d := rl.Vector2Subtract(c.Center, closest)
+	dist := GetVectorLength(d)
+
+	if d.X != 0 || d.Y != 0 {
+		if dist >= c.Radius {
+			return Manifold{}, false
+		}
+		return Manifold{Normal: rl.Vector2Scale(d, 1/dist), Depth: c.Radius - dist}, true
+	}
+
+	// The centre is inside the box, push out through the nearest face.
+	toLeft, toRight := c.Center.X-a.Min.X, a.Max.X-c.Center.X
+	toTop, toBottom := c.Center.Y-a.Min.Y, a.Max.Y-c.Center.Y
+	nearest := min(min(toLeft, toRight), min(toTop, toBottom))
+	switch nearest {
+	case toLeft:
+		return Manifold{Normal: rl.Vector2{X: -1}, Depth: toLeft + c.Radius}, true
+	case toRight:
+		return Manifold{Normal: rl.Vector2{X: 1}, Depth: toRight + c.Radius}, true
+	case toTop:
+		return Manifold{Normal: rl.Vector2{Y: -1}, Depth: toTop + c.Radius}, true
+	default:
+		return Manifold{Normal: rl.Vector2{Y: 1}, Depth: toBottom + c.Radius}, true
+	}
+}
+
+func OverlapCircleAABB(c Circle, a AABB) (Manifold, bool) {
+	m, ok := OverlapAABBCircle(a, c)
+	m.Normal = rl.Vector2Negate(m.Normal)
+	return m, ok
+}
+
+// ===SEGMENTS===
+
+// RayHit is where a segment first enters a shape. T is the fraction of the
+// segment travelled and Normal the face that was crossed. A segment that
+// starts inside the shape hits at T 0 with no Normal.
+type RayHit struct {
+	T      float32
+	Normal rl.Vector2
+}
+
+func SegmentAABB(s Segment, b AABB) (RayHit, bool) {
+	d := rl.Vector2Subtract(s.B, s.A)
+	xEntry, xExit, ok := slab(s.A.X, d.X, b.Min.X, b.Max.X)
+	if !ok {
+		return RayHit{}, false
+	}
+	yEntry, yExit, ok := slab(s.A.Y, d.Y, b.Min.Y, b.Max.Y)
+	if !ok {
+		return RayHit{}, false
+	}
+
+	entry := max(xEntry, yEntry)
+	exit := min(xExit, yExit)
+	if entry >= exit || exit < 0 || entry > 1 {
+		return RayHit{}, false
+	}
+	if entry < 0 {
+		return RayHit{}, true
+	}
+	if xEntry > yEntry {
+		return RayHit{T: entry, Normal: rl.Vector2{X: -sign(d.X)}}, true
+	}
+	return RayHit{T: entry, Normal: rl.Vector2{Y: -sign(d.Y)}}, true
+}
+
+func SegmentCircle(s Segment, c Circle) (RayHit, bool) {
+	d := rl.Vector2Subtract(s.B, s.A)
+	f := rl.Vector2Subtract(s.A, c.Center)
+	a := rl.Vector2DotProduct(d, d)
+	b := 2 * rl.Vector2DotProduct(f, d)
+	cc := rl.Vector2DotProduct(f, f) - c.Radius*c.Radius
+	if cc < 0 {
+		return RayHit{}, true
+	}
+	discriminant := b*b - 4*a*cc
+	if a == 0 || discriminant < 0 {
+		return RayHit{}, false
+	}
+
+	t := (-b - float32(math.Sqrt(float64(discriminant)))) / (2 * a)
+	if t < 0 || t > 1 {
+		return RayHit{}, false
+	}
+	point := rl.Vector2Add(s.A, rl.Vector2Scale(d, t))
+	normal := rl.Vector2Normalize(rl.Vector2Subtract(point, c.Center))
+	return RayHit{T: t, Normal: normal}, true
+}
+
+// SweepAABB moves a by delta against a static b. Boxes that already overlap
+// are not reported, OverlapAABB resolves those.
+func SweepAABB(a AABB, delta rl.Vector2, b AABB) (RayHit, bool) {
+	size := a.Size()
+	expanded := AABB{Min: rl.Vector2Subtract(b.Min, size), Max: b.Max}
+	hit, ok := SegmentAABB(Segment{A: a.Min, B: rl.Vector2Add(a.Min, delta)}, expanded)
+	if !ok || (hit.Normal.X == 0 && hit.Normal.Y == 0) {
+		return RayHit{}, false
+	}
+	return hit, true
+}
+
+func slab(origin, d, lo, hi float32) (entry, exit float32, ok bool) {
+	if d == 0 {
+		if origin <= lo || origin >= hi {
+			return 0, 0, false
+		}
+		return float32(math.Inf(-1)), float32(math.Inf(1)), true
+	}
+	entry, exit = (lo-origin)/d, (hi-origin)/d
+	if entry > exit {
+		entry, exit = exit, entry
+	}
+	return entry, exit, true
+}
+
+func signOr(a, fallback float32) float32 {
+	if a == 0 {
+		return fallback
+	}
+	return sign(a)
+}
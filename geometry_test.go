@@ -0,0 +1,190 @@
+package main
+
+import (
+	"math"
+	"testing"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+const epsilon = 1e-4
+
+func near(a, b float32) bool {
+	return math.Abs(float64(a-b)) < epsilon
+}
+
+func nearVector(a, b rl.Vector2) bool {
+	return near(a.X, b.X) && near(a.Y, b.Y)
+}
+
+func checkManifold(t *testing.T, got Manifold, ok bool, want Manifold, wantOK bool) {
+	t.Helper()
+	if ok != wantOK {
+		t.Fatalf("overlap = %v, want %v", ok, wantOK)
+	}
+	if ok && (!nearVector(got.Normal, want.Normal) || !near(got.Depth, want.Depth)) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func checkHit(t *testing.T, got RayHit, ok bool, want RayHit, wantOK bool) {
+	t.Helper()
+	if ok != wantOK {
+		t.Fatalf("hit = %v, want %v", ok, wantOK)
+	}
+	if ok && (!near(got.T, want.T) || !nearVector(got.Normal, want.Normal)) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestOverlapAABB(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b AABB
+		want Manifold
+		ok   bool
+	}{
+		{"apart", NewAABB(0, 0, 10, 10), NewAABB(20, 0, 10, 10), Manifold{}, false},
+		{"touching", NewAABB(0, 0, 10, 10), NewAABB(10, 0, 10, 10), Manifold{}, false},
+		{"right", NewAABB(0, 0, 10, 10), NewAABB(8, 2, 10, 10), Manifold{Normal: rl.Vector2{X: 1}, Depth: 2}, true},
+		{"left", NewAABB(0, 0, 10, 10), NewAABB(-8, 0, 10, 10), Manifold{Normal: rl.Vector2{X: -1}, Depth: 2}, true},
+		{"below", NewAABB(0, 0, 10, 10), NewAABB(1, 7, 10, 10), Manifold{Normal: rl.Vector2{Y: 1}, Depth: 3}, true},
+		{"above", NewAABB(0, 0, 10, 10), NewAABB(1, -7, 10, 10), Manifold{Normal: rl.Vector2{Y: -1}, Depth: 3}, true},
+		{"contained", NewAABB(0, 0, 20, 20), NewAABB(8, 8, 4, 4), Manifold{Normal: rl.Vector2{Y: 1}, Depth: 4}, true},
+		{"contained off centre", NewAABB(0, 0, 20, 20), NewAABB(2, 6, 4, 8), Manifold{Normal: rl.Vector2{X: -1}, Depth: 4}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := OverlapAABB(tt.a, tt.b)
+			checkManifold(t, got, ok, tt.want, tt.ok)
+		})
+	}
+}
+
+func TestOverlapCircles(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b Circle
+		want Manifold
+		ok   bool
+	}{
+		{"apart", Circle{rl.Vector2{}, 1}, Circle{rl.Vector2{X: 3}, 1}, Manifold{}, false},
+		{"touching", Circle{rl.Vector2{}, 1}, Circle{rl.Vector2{X: 2}, 1}, Manifold{}, false},
+		{"overlapping", Circle{rl.Vector2{}, 2}, Circle{rl.Vector2{X: 3}, 2}, Manifold{Normal: rl.Vector2{X: 1}, Depth: 1}, true},
+		{"diagonal", Circle{rl.Vector2{}, 3}, Circle{rl.Vector2{X: 3, Y: 4}, 3}, Manifold{Normal: rl.Vector2{X: 0.6, Y: 0.8}, Depth: 1}, true},
+		{"concentric", Circle{rl.Vector2{X: 5, Y: 5}, 2}, Circle{rl.Vector2{X: 5, Y: 5}, 1}, Manifold{Normal: rl.Vector2{X: 1}, Depth: 3}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := OverlapCircles(tt.a, tt.b)
+			checkManifold(t, got, ok, tt.want, tt.ok)
+		})
+	}
+}
+
+func TestOverlapAABBCircle(t *testing.T) {
+	box := NewAABB(0, 0, 10, 10)
+	tests := []struct {
+		name string
+		c    Circle
+		want Manifold
+		ok   bool
+	}{
+		{"apart", Circle{rl.Vector2{X: 15, Y: 5}, 2}, Manifold{}, false},
+		{"touching", Circle{rl.Vector2{X: 12, Y: 5}, 2}, Manifold{}, false},
+		{"side", Circle{rl.Vector2{X: 11, Y: 5}, 2}, Manifold{Normal: rl.Vector2{X: 1}, Depth: 1}, true},
+		{"corner", Circle{rl.Vector2{X: 13, Y: 14}, 6}, Manifold{Normal: rl.Vector2{X: 0.6, Y: 0.8}, Depth: 1}, true},
+		{"centre inside near left", Circle{rl.Vector2{X: 1, Y: 5}, 2}, Manifold{Normal: rl.Vector2{X: -1}, Depth: 3}, true},
+		{"centre inside near bottom", Circle{rl.Vector2{X: 5, Y: 9}, 1}, Manifold{Normal: rl.Vector2{Y: 1}, Depth: 2}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := OverlapAABBCircle(box, tt.c)
+			checkManifold(t, got, ok, tt.want, tt.ok)
+
+			// The other way round the normal flips.
+			got, ok = OverlapCircleAABB(tt.c, box)
+			tt.want.Normal = rl.Vector2Negate(tt.want.Normal)
+			checkManifold(t, got, ok, tt.want, tt.ok)
+		})
+	}
+}
+
+func TestSegmentAABB(t *testing.T) {
+	box := NewAABB(0, 0, 10, 10)
+	tests := []struct {
+		name string
+		s    Segment
+		want RayHit
+		ok   bool
+	}{
+		{"miss", Segment{rl.Vector2{X: -10, Y: 20}, rl.Vector2{X: 20, Y: 20}}, RayHit{}, false},
+		{"from the left", Segment{rl.Vector2{X: -10, Y: 5}, rl.Vector2{X: 10, Y: 5}}, RayHit{T: 0.5, Normal: rl.Vector2{X: -1}}, true},
+		{"from above", Segment{rl.Vector2{X: 5, Y: -10}, rl.Vector2{X: 5, Y: 10}}, RayHit{T: 0.5, Normal: rl.Vector2{Y: -1}}, true},
+		{"from the right", Segment{rl.Vector2{X: 30, Y: 5}, rl.Vector2{X: 0, Y: 5}}, RayHit{T: 2.0 / 3, Normal: rl.Vector2{X: 1}}, true},
+		{"too short", Segment{rl.Vector2{X: -10, Y: 5}, rl.Vector2{X: -5, Y: 5}}, RayHit{}, false},
+		{"along an edge", Segment{rl.Vector2{X: -10, Y: 0}, rl.Vector2{X: 20, Y: 0}}, RayHit{}, false},
+		{"starts inside", Segment{rl.Vector2{X: 5, Y: 5}, rl.Vector2{X: 20, Y: 5}}, RayHit{}, true},
+		{"zero length outside", Segment{rl.Vector2{X: -5, Y: 5}, rl.Vector2{X: -5, Y: 5}}, RayHit{}, false},
+		{"zero length inside", Segment{rl.Vector2{X: 5, Y: 5}, rl.Vector2{X: 5, Y: 5}}, RayHit{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := SegmentAABB(tt.s, box)
+			checkHit(t, got, ok, tt.want, tt.ok)
+		})
+	}
+}
+
+func TestSegmentCircle(t *testing.T) {
+	circle := Circle{rl.Vector2{}, 5}
+	tests := []struct {
+		name string
+		s    Segment
+		want RayHit
+		ok   bool
+	}{
+		{"miss", Segment{rl.Vector2{X: -10, Y: 10}, rl.Vector2{X: 10, Y: 10}}, RayHit{}, false},
+		{"through", Segment{rl.Vector2{X: -10}, rl.Vector2{X: 10}}, RayHit{T: 0.25, Normal: rl.Vector2{X: -1}}, true},
+		{"tangent", Segment{rl.Vector2{X: -10, Y: 5}, rl.Vector2{X: 10, Y: 5}}, RayHit{T: 0.5, Normal: rl.Vector2{Y: 1}}, true},
+		{"too short", Segment{rl.Vector2{X: -10}, rl.Vector2{X: -6}}, RayHit{}, false},
+		{"starts inside", Segment{rl.Vector2{X: 1}, rl.Vector2{X: 10}}, RayHit{}, true},
+		{"zero length outside", Segment{rl.Vector2{X: 8}, rl.Vector2{X: 8}}, RayHit{}, false},
+		{"zero length inside", Segment{rl.Vector2{X: 1}, rl.Vector2{X: 1}}, RayHit{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := SegmentCircle(tt.s, circle)
+			checkHit(t, got, ok, tt.want, tt.ok)
+		})
+	}
+}
+
+func TestSweepAABB(t *testing.T) {
+	a := NewAABB(0, 0, 10, 10)
+	tests := []struct {
+		name  string
+		delta rl.Vector2
+		b     AABB
+		want  RayHit
+		ok    bool
+	}{
+		{"hit", rl.Vector2{X: 20}, NewAABB(15, 0, 10, 10), RayHit{T: 0.25, Normal: rl.Vector2{X: -1}}, true},
+		{"hit from below", rl.Vector2{Y: -40}, NewAABB(2, -30, 4, 10), RayHit{T: 0.5, Normal: rl.Vector2{Y: 1}}, true},
+		{"miss", rl.Vector2{X: 20}, NewAABB(15, 20, 10, 10), RayHit{}, false},
+		{"falls short", rl.Vector2{X: 4}, NewAABB(15, 0, 10, 10), RayHit{}, false},
+		{"tunnels through", rl.Vector2{X: 100}, NewAABB(40, 0, 2, 10), RayHit{T: 0.3, Normal: rl.Vector2{X: -1}}, true},
+		{"touching, moving in", rl.Vector2{X: 5}, NewAABB(10, 0, 10, 10), RayHit{T: 0, Normal: rl.Vector2{X: -1}}, true},
+		{"touching, moving away", rl.Vector2{X: -5}, NewAABB(10, 0, 10, 10), RayHit{}, false},
+		{"sliding along", rl.Vector2{X: 20}, NewAABB(15, 10, 10, 10), RayHit{}, false},
+		{"zero delta", rl.Vector2{}, NewAABB(15, 0, 10, 10), RayHit{}, false},
+		{"zero delta overlapping", rl.Vector2{}, NewAABB(5, 5, 10, 10), RayHit{}, false},
+		{"already overlapping", rl.Vector2{X: 20}, NewAABB(5, 5, 10, 10), RayHit{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := SweepAABB(a, tt.delta, tt.b)
+			checkHit(t, got, ok, tt.want, tt.ok)
+		})
+	}
+}
@@ -0,0 +1,446 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net"
+	"os"
+	"strings"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+// ===GYM===
+//
+// Env wraps a headless World into the reset/step loop reinforcement learning
+// trainers expect. The agent plays player 1, bots play everyone else the mode
+// has. Nothing is drawn with raylib, pixel observations are filled in here.
+//
+// ServeGym speaks JSON lines, one request and one response per line:
+//
+//	{"Cmd": "spec"}                        the action count and observation shape
+//	{"Cmd": "configure", "Config": {...}}  replaces the EnvConfig, answers a spec
+//	{"Cmd": "reset", "Seed": 1}            starts an episode
+//	{"Cmd": "step", "Action": 2}           plays one tick with GYM_ACTIONS[Action]
+//
+// Observation data is base64, as encoding/json does with bytes. A failed
+// request gets an Error back and leaves the environment as it was.
+
+const (
+	GYM_OBS_GRID   = "grid"
+	GYM_OBS_PIXELS = "pixels"
+	// Lines bigger than this are no request.
+	GYM_MAX_LINE = 1 << 20
+)
+
+var GYM_ACTIONS = []InputFrame{0, InputUp, InputRight, InputDown, InputLeft, InputFire}
+
+// What a cell of a grid observation holds, the highest value found there winning.
+const (
+	GYM_EMPTY byte = iota
+	GYM_WALL
+	GYM_CANDY
+	GYM_ENEMY
+	GYM_PROJECTILE
+	GYM_OTHER_BODY
+	GYM_OTHER_HEAD
+	GYM_BODY
+	GYM_HEAD
+)
+
+// Rewards shapes what a step is worth to the agent.
+type Rewards struct {
+	Point    float32 // for every point scored
+	Death    float32
+	Step     float32 // for every step survived
+	Approach float32 // for every cell closer to the nearest candy
+}
+
+type EnvConfig struct {
+	Mode        GameMode
+	Observation string
+	PixelScale  int // arena pixels per observation pixel side
+	MaxSteps    int
+	Rewards     Rewards
+}
+
+var DEFAULT_ENV_CONFIG = EnvConfig{
+	Mode:        SOLO,
+	Observation: GYM_OBS_GRID,
+	PixelScale:  4,
+	MaxSteps:    5000,
+	Rewards:     Rewards{Point: 0.1, Death: -1, Step: -0.001, Approach: 0.01},
+}
+
+// Observation is Height rows of Width cells of Channels bytes each.
+type Observation struct {
+	Width    int
+	Height   int
+	Channels int
+	Data     []byte
+}
+
+type Env struct {
+	Config EnvConfig
+
+	world    *World
+	sim      *Simulation
+	level    *Level
+	steps    int
+	score    int
+	distance float32
+	done     bool
+}
+
+// NewEnv checks that level builds with config before handing out an Env.
+func NewEnv(level *Level, prefabs Prefabs, config EnvConfig) (*Env, error) {
+	w := NewWorld()
+	w.prefabs = prefabs
+	e := &Env{world: w, sim: NewSimulation(w), level: level}
+	if err := e.Configure(config); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// Configure applies config from the next Reset on.
+func (e *Env) Configure(config EnvConfig) error {
+	if config.Observation != GYM_OBS_GRID && config.Observation != GYM_OBS_PIXELS {
+		return fmt.Errorf("unknown observation %q", config.Observation)
+	}
+	if config.PixelScale < 1 {
+		return fmt.Errorf("pixel scale %d is below 1", config.PixelScale)
+	}
+	if config.Mode.Players() < 1 {
+		return fmt.Errorf("%s has no player for the agent", config.Mode)
+	}
+	if err := e.level.Build(e.world, config.Mode); err != nil {
+		return err
+	}
+	e.Config = config
+	e.done = true
+	return nil
+}
+
+func (e *Env) Reset(seed uint64) Observation {
+	e.world.Seed(seed)
+	if err := e.level.Build(e.world, e.Config.Mode); err != nil {
+		// Configure built it already, this can't happen.
+		log.Println(err)
+	}
+	for i := 1; i < len(e.world.gameState.players); i++ {
+		e.world.MakeBot(i)
+	}
+	e.steps, e.score, e.done = 0, 0, false
+	e.distance = 0
+	if distance, ok := e.candyDistance(); ok {
+		e.distance = distance
+	}
+	return e.Observe()
+}
+
+// Step plays one tick with action as the input of the agent. Once done, it
+// returns the last observation until the next Reset.
+func (e *Env) Step(action InputFrame) (Observation, float32, bool) {
+	if e.done {
+		return e.Observe(), 0, true
+	}
+	w := e.world
+	inputs := make([]InputFrame, len(w.gameState.players))
+	inputs[0] = action
+	e.sim.Step(inputs)
+	e.steps++
+
+	rewards := e.Config.Rewards
+	reward := rewards.Step
+	agent := w.gameState.players[0]
+	scored := agent.Score - e.score
+	e.score = agent.Score
+	reward += float32(scored) * rewards.Point
+
+	distance, ok := e.candyDistance()
+	// A candy eaten makes the nearest one another, there is no getting closer to it.
+	if ok && scored == 0 && e.distance > 0 {
+		reward += (e.distance - distance) / RECTSIZE * rewards.Approach
+	}
+	if !ok {
+		distance = 0
+	}
+	e.distance = distance
+
+	if !agent.Alive {
+		reward += rewards.Death
+	}
+	e.done = !agent.Alive || w.state != PLAY || (e.Config.MaxSteps > 0 && e.steps >= e.Config.MaxSteps)
+	return e.Observe(), reward, e.done
+}
+
+func (e *Env) Score() int   { return e.score }
+func (e *Env) Tick() uint64 { return e.world.tick }
+
+// candyDistance is how far the head of the agent is from the nearest candy.
+func (e *Env) candyDistance() (float32, bool) {
+	w := e.world
+	entity, ok := w.PlayerEntity(0)
+	if !ok {
+		return 0, false
+	}
+	head, _ := getComponent[Position](w, entity, positionID)
+	from := rl.Vector2{X: head.X, Y: head.Y}
+	nearest := float32(math.Inf(1))
+	for _, archetype := range w.Query(positionID, candyID) {
+		for _, p := range archetype.Components[positionID].([]Position) {
+			nearest = min(nearest, GetVectorLength(w.gameState.arena.Delta(from, rl.Vector2{X: p.X, Y: p.Y})))
+		}
+	}
+	return nearest, !math.IsInf(float64(nearest), 1)
+}
+
+func (e *Env) Shape() (width, height, channels int) {
+	arena := e.world.gameState.arena
+	if e.Config.Observation == GYM_OBS_PIXELS {
+		return int(arena.Width) / e.Config.PixelScale, int(arena.Height) / e.Config.PixelScale, 3
+	}
+	return int(arena.Width / RECTSIZE), int(arena.Height / RECTSIZE), 1
+}
+
+func (e *Env) Observe() Observation {
+	width, height, channels := e.Shape()
+	obs := Observation{Width: width, Height: height, Channels: channels, Data: make([]byte, width*height*channels)}
+	if e.Config.Observation == GYM_OBS_PIXELS {
+		e.drawPixels(obs)
+	} else {
+		e.fillGrid(obs)
+	}
+	return obs
+}
+
+func (e *Env) fillGrid(obs Observation) {
+	w := e.world
+	grid := newBotGrid(w.gameState.arena)
+	mark := func(box AABB, value byte) {
+		grid.cells(box, func(i int) { obs.Data[i] = max(obs.Data[i], value) })
+	}
+
+	for _, archetype := range w.Query(positionID, collidesID) {
+		position := archetype.Components[positionID].([]Position)
+		collider := archetype.Components[collidesID].([]Collides)
+		_, isPlayer := archetype.Components[playerControlledID].([]PlayerControlled)
+		bunker, isBunker := archetype.Components[bunkerID].([]Bunker)
+		for idx := range archetype.Entities {
+			box := collider[idx].AABB(position[idx])
+			switch {
+			case isPlayer:
+			case isBunker:
+				bunker[idx].EachCell(position[idx], func(box AABB) { mark(box, GYM_WALL) })
+			case archetype.Mask&candyID != 0:
+				mark(box, GYM_CANDY)
+			case archetype.Mask&projectileID != 0:
+				mark(box, GYM_PROJECTILE)
+			case archetype.Mask&enemyID != 0:
+				mark(box, GYM_ENEMY)
+			case !collider[idx].Trigger:
+				mark(box, GYM_WALL)
+			}
+		}
+	}
+	for _, archetype := range w.Query(playerControlledID) {
+		for _, p := range archetype.Components[playerControlledID].([]PlayerControlled) {
+			head, body := GYM_OTHER_HEAD, GYM_OTHER_BODY
+			if p.Index == 0 {
+				head, body = GYM_HEAD, GYM_BODY
+			}
+			for i := len(p.Body) - 1; i >= 0; i-- {
+				value := body
+				if i == 0 {
+					value = head
+				}
+				// Segments are off the grid more often than not, the cell
+				// holding most of one stands for it.
+				if cell, ok := grid.cellAt(Position{X: p.Body[i].X, Y: p.Body[i].Y}); ok {
+					obs.Data[cell] = max(obs.Data[cell], value)
+				}
+			}
+		}
+	}
+}
+
+// drawPixels draws the world into obs the way DrawSystem does, as RGB.
+func (e *Env) drawPixels(obs Observation) {
+	w := e.world
+	arena := w.gameState.arena
+	scale := float32(e.Config.PixelScale)
+	fill := func(x, y, width, height float32, color rl.Color) {
+		for _, img := range arena.Images(x, y, width, height) {
+			x0, y0 := max(int(img.X/scale), 0), max(int(img.Y/scale), 0)
+			x1, y1 := min(int((img.X+width)/scale), obs.Width), min(int((img.Y+height)/scale), obs.Height)
+			alpha := uint32(color.A)
+			for py := y0; py < y1; py++ {
+				for px := x0; px < x1; px++ {
+					p := obs.Data[(py*obs.Width+px)*3:]
+					p[0] = byte((uint32(color.R)*alpha + uint32(p[0])*(255-alpha)) / 255)
+					p[1] = byte((uint32(color.G)*alpha + uint32(p[1])*(255-alpha)) / 255)
+					p[2] = byte((uint32(color.B)*alpha + uint32(p[2])*(255-alpha)) / 255)
+				}
+			}
+		}
+	}
+
+	fill(0, 0, arena.Width, arena.Height, VICOLOR)
+	for _, archetype := range w.Query(positionID, animationID) {
+		position := archetype.Components[positionID].([]Position)
+		animation := archetype.Components[animationID].([]Animation)
+		for idx := range archetype.Entities {
+			look := animation[idx].Sprite
+			fill(position[idx].X, position[idx].Y, look.Width, look.Height, look.Color)
+		}
+	}
+	for _, archetype := range w.Query(positionID, spriteID) {
+		position := archetype.Components[positionID].([]Position)
+		sprite := archetype.Components[spriteID].([]Sprite)
+		bunker, isBunker := archetype.Components[bunkerID].([]Bunker)
+		for idx := range archetype.Entities {
+			if isBunker {
+				bunker[idx].EachCell(position[idx], func(box AABB) {
+					size := box.Size()
+					fill(box.Min.X, box.Min.Y, size.X, size.Y, sprite[idx].Color)
+				})
+				continue
+			}
+			fill(position[idx].X, position[idx].Y, sprite[idx].Width, sprite[idx].Height, sprite[idx].Color)
+		}
+	}
+	for _, archetype := range w.Query(playerControlledID) {
+		player := archetype.Components[playerControlledID].([]PlayerControlled)
+		sprite, hasSprite := archetype.Components[spriteID].([]Sprite)
+		for idx := range archetype.Entities {
+			color := rl.DarkGreen
+			if hasSprite {
+				color = rl.Fade(sprite[idx].Color, 0.7)
+			}
+			for i := len(player[idx].Body) - 1; i > 0; i-- {
+				fill(player[idx].Body[i].X, player[idx].Body[i].Y, RECTSIZE, RECTSIZE, color)
+			}
+		}
+	}
+}
+
+// +++++++++++
+
+type GymRequest struct {
+	Cmd    string
+	Seed   uint64
+	Action int
+	Config *EnvConfig
+}
+
+type GymResponse struct {
+	Spec        *GymSpec     `json:",omitempty"`
+	Observation *Observation `json:",omitempty"`
+	Reward      float32
+	Done        bool
+	Score       int
+	Tick        uint64
+	Error       string `json:",omitempty"`
+}
+
+type GymSpec struct {
+	Actions  int
+	Width    int
+	Height   int
+	Channels int
+	Config   EnvConfig
+}
+
+func (e *Env) Spec() *GymSpec {
+	width, height, channels := e.Shape()
+	return &GymSpec{Actions: len(GYM_ACTIONS), Width: width, Height: height, Channels: channels, Config: e.Config}
+}
+
+func (e *Env) handle(req GymRequest) GymResponse {
+	switch req.Cmd {
+	case "spec":
+		return GymResponse{Spec: e.Spec()}
+	case "configure":
+		if req.Config == nil {
+			return GymResponse{Error: "configure needs a Config"}
+		}
+		if err := e.Configure(*req.Config); err != nil {
+			return GymResponse{Error: err.Error()}
+		}
+		return GymResponse{Spec: e.Spec()}
+	case "reset":
+		obs := e.Reset(req.Seed)
+		return GymResponse{Observation: &obs, Tick: e.Tick()}
+	case "step":
+		if req.Action < 0 || req.Action >= len(GYM_ACTIONS) {
+			return GymResponse{Error: fmt.Sprintf("action %d out of range", req.Action)}
+		}
+		obs, reward, done := e.Step(GYM_ACTIONS[req.Action])
+		return GymResponse{Observation: &obs, Reward: reward, Done: done, Score: e.Score(), Tick: e.Tick()}
+	default:
+		return GymResponse{Error: fmt.Sprintf("unknown command %q", req.Cmd)}
+	}
+}
+
+// ServeGym runs one environment for the requests read from r until it ends.
+func ServeGym(r io.Reader, w io.Writer, level *Level, prefabs Prefabs) error {
+	env, err := NewEnv(level, prefabs, DEFAULT_ENV_CONFIG)
+	if err != nil {
+		return err
+	}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, GYM_MAX_LINE)
+	out := bufio.NewWriter(w)
+	encoder := json.NewEncoder(out)
+	for scanner.Scan() {
+		var req GymRequest
+		res := GymResponse{}
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+			res.Error = err.Error()
+		} else {
+			res = env.handle(req)
+		}
+		if err := encoder.Encode(res); err != nil {
+			return err
+		}
+		if err := out.Flush(); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// RunGym serves environments on level: one on stdin and stdout when addr is
+// "-", else one per connection to addr, a unix socket when it is a path.
+func RunGym(addr string, level *Level, prefabs Prefabs) error {
+	if addr == "-" {
+		return ServeGym(os.Stdin, os.Stdout, level, prefabs)
+	}
+	network := "tcp"
+	if strings.Contains(addr, "/") {
+		network = "unix"
+	}
+	listener, err := net.Listen(network, addr)
+	if err != nil {
+		return err
+	}
+	defer listener.Close()
+	log.Printf("gym on %s %s\n", network, listener.Addr())
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+		go func() {
+			defer conn.Close()
+			if err := ServeGym(conn, conn, level, prefabs); err != nil {
+				log.Println(err)
+			}
+		}()
+	}
+}
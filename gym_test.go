@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"testing"
+)
+
+// gymPeer talks to ServeGym over a pipe, as a trainer would.
+type gymPeer struct {
+	t   *testing.T
+	in  *json.Encoder
+	out *bufio.Scanner
+}
+
+func (p *gymPeer) call(req GymRequest) GymResponse {
+	p.t.Helper()
+	if err := p.in.Encode(req); err != nil {
+		p.t.Fatal(err)
+	}
+	if !p.out.Scan() {
+		p.t.Fatalf("no answer to %+v: %v", req, p.out.Err())
+	}
+	var res GymResponse
+	if err := json.Unmarshal(p.out.Bytes(), &res); err != nil {
+		p.t.Fatal(err)
+	}
+	return res
+}
+
+func TestGymProtocol(t *testing.T) {
+	prefabs, err := LoadPrefabs(PREFABS_PATH)
+	if err != nil {
+		t.Fatal(err)
+	}
+	level, err := LoadLevel("levels/01_classic.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	requests, toServer := io.Pipe()
+	fromServer, responses := io.Pipe()
+	served := make(chan error, 1)
+	go func() {
+		served <- ServeGym(requests, responses, level, prefabs)
+		responses.Close()
+	}()
+	gym := &gymPeer{t: t, in: json.NewEncoder(toServer), out: bufio.NewScanner(fromServer)}
+	gym.out.Buffer(nil, GYM_MAX_LINE)
+
+	spec := gym.call(GymRequest{Cmd: "spec"}).Spec
+	if spec == nil || spec.Actions != len(GYM_ACTIONS) || spec.Width != 30 || spec.Height != 30 || spec.Channels != 1 {
+		t.Fatalf("spec %+v", spec)
+	}
+
+	// Errors leave the environment as it was.
+	for _, req := range []GymRequest{
+		{Cmd: "dance"},
+		{Cmd: "configure"},
+		{Cmd: "configure", Config: &EnvConfig{Observation: "smell", PixelScale: 1}},
+		{Cmd: "step", Action: len(GYM_ACTIONS)},
+	} {
+		if res := gym.call(req); res.Error == "" {
+			t.Errorf("%+v: no error", req)
+		}
+	}
+
+	config := DEFAULT_ENV_CONFIG
+	config.Rewards = Rewards{Point: 1, Death: -10, Step: 0.5}
+	if res := gym.call(GymRequest{Cmd: "configure", Config: &config}); res.Error != "" || res.Spec.Config != config {
+		t.Fatalf("configure: %+v", res)
+	}
+	// Until the first reset an episode is over.
+	if res := gym.call(GymRequest{Cmd: "step"}); !res.Done {
+		t.Errorf("stepped before a reset")
+	}
+
+	reset := gym.call(GymRequest{Cmd: "reset", Seed: 7})
+	obs := reset.Observation
+	if reset.Error != "" || obs == nil || reset.Tick != 0 || len(obs.Data) != obs.Width*obs.Height*obs.Channels {
+		t.Fatalf("reset: %+v", reset)
+	}
+	heads := 0
+	for _, cell := range obs.Data {
+		if cell == GYM_HEAD {
+			heads++
+		}
+	}
+	if heads != 1 {
+		t.Errorf("%d heads in the first observation", heads)
+	}
+
+	// Going up runs into the top wall: every step is worth Step, the last one
+	// Death as well, and from then on the episode stays done.
+	up := 1
+	var res GymResponse
+	for steps := 1; !res.Done; steps++ {
+		if steps > 20*TICK_RATE {
+			t.Fatalf("still alive after %d steps", steps)
+		}
+		res = gym.call(GymRequest{Cmd: "step", Action: up})
+		if res.Error != "" || res.Tick != uint64(steps) {
+			t.Fatalf("step %d: %+v", steps, res)
+		}
+		want := config.Rewards.Step
+		if res.Done {
+			want += config.Rewards.Death
+		}
+		if res.Reward != want {
+			t.Fatalf("step %d: reward %v, want %v", steps, res.Reward, want)
+		}
+	}
+	tick := res.Tick
+	if res = gym.call(GymRequest{Cmd: "step", Action: up}); !res.Done || res.Reward != 0 || res.Tick != tick {
+		t.Errorf("step after the end: %+v", res)
+	}
+
+	// The same seed plays the same episode.
+	if again := gym.call(GymRequest{Cmd: "reset", Seed: 7}); string(again.Observation.Data) != string(obs.Data) {
+		t.Errorf("reset with the same seed observes another world")
+	}
+
+	toServer.Close()
+	if err := <-served; err != nil {
+		t.Error(err)
+	}
+}
@@ -3,7 +3,8 @@ package main
 import (
 	rl "github.com/gen2brain/raylib-go/raylib"
 	"golang.org/x/exp/constraints"
-	"math/rand"
+	"reflect"
+	"slices"
 )
 
 var VICOLOR = rl.Color{252, 163, 17, 255}
@@ -12,16 +13,32 @@ type Number interface {
 	constraints.Integer | constraints.Float
 }
 
-func CandyGenerator() map[ComponentID]any {
-	c := make(map[ComponentID]any)
-	c[candyID] = Candy{}
-	x := float32(rand.Intn(500) + 40)
-	y := float32(rand.Intn(500) + 40)
-	c[positionID] = Position{X: x, Y: y}
-	c[spriteID] = Sprite{Width: 20, Height: 20, Color: rl.Blue}
-	c[collidesID] = Collides{X: x, Y: y, Width: 20, Height: 20}
+func SpawnProjectile(w *World, owner Entity, x, y float32, direction rl.Vector2, speed float32) (Entity, error) {
+	projectile, _ := w.PrefabComponent("projectile", projectileID).(Projectile)
+	projectile.Owner = owner
+	if _, ok := w.Effect(owner, EffectPiercing); ok {
+		projectile.Pierce = true
+	}
+	return w.Spawn("projectile", map[ComponentID]any{
+		positionID:   Position{X: x, Y: y},
+		movementID:   ProjectileMotion(direction, speed),
+		projectileID: projectile,
+	})
+}
 
-	return c
+// SpawnBlock spawns a wall, or a piece of scenery when the block is not solid.
+func SpawnBlock(w *World, block Block) (Entity, error) {
+	size := block.Box.Size()
+	overrides := map[ComponentID]any{
+		positionID: Position{X: block.Box.Min.X, Y: block.Box.Min.Y},
+		spriteID:   Sprite{Width: size.X, Height: size.Y, Color: block.Color},
+		collidesID: Collides{Width: size.X, Height: size.Y},
+	}
+	if !block.Solid {
+		delete(overrides, collidesID)
+		return w.Spawn("scenery", overrides)
+	}
+	return w.Spawn("wall", overrides)
 }
 
 func GetMaskFromComponents(componentsID ...ComponentID) ComponentID {
@@ -32,6 +49,85 @@ func GetMaskFromComponents(componentsID ...ComponentID) ComponentID {
 	return mask
 }
 
+// HACK: Add components here as needed.
+var componentNames = map[string]ComponentID{
+	"position":         positionID,
+	"sprite":           spriteID,
+	"movement":         movementID,
+	"health":           healthID,
+	"alive":            aliveID,
+	"animation":        animationID,
+	"playerControlled": playerControlledID,
+	"IAControlled":     IAControlledID,
+	"collides":         collidesID,
+	"enemy":            enemyID,
+	"candy":            candyID,
+	"projectile":       projectileID,
+	"bot":              botID,
+	"statusEffects":    statusEffectsID,
+	"bunker":           bunkerID,
+	"boss":             bossID,
+	"bossPart":         bossPartID,
+}
+
+// cloneComponent copies v so the copy shares no slices with it.
+// HACK: Add components holding slices here as needed.
+func cloneComponent(id ComponentID, v any) any {
+	switch id {
+	case playerControlledID:
+		c := v.(PlayerControlled)
+		c.Body = slices.Clone(c.Body)
+		return c
+	case statusEffectsID:
+		c := v.(StatusEffects)
+		c.Effects = slices.Clone(c.Effects)
+		return c
+	case bunkerID:
+		c := v.(Bunker)
+		c.Cells = slices.Clone(c.Cells)
+		return c
+	case bossID:
+		c := v.(Boss)
+		c.Parts = slices.Clone(c.Parts)
+		c.Patterns = slices.Clone(c.Patterns)
+		c.Summons = slices.Clone(c.Summons)
+		c.Minions = slices.Clone(c.Minions)
+		return c
+	default:
+		return v
+	}
+}
+
+// cloneColumn copies a whole column of components, see cloneComponent.
+// HACK: Add components holding slices here as needed.
+func cloneColumn(column any) any {
+	v := reflect.ValueOf(column)
+	c := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+	reflect.Copy(c, v)
+	switch components := c.Interface().(type) {
+	case []PlayerControlled:
+		for i := range components {
+			components[i].Body = slices.Clone(components[i].Body)
+		}
+	case []StatusEffects:
+		for i := range components {
+			components[i].Effects = slices.Clone(components[i].Effects)
+		}
+	case []Bunker:
+		for i := range components {
+			components[i].Cells = slices.Clone(components[i].Cells)
+		}
+	case []Boss:
+		for i := range components {
+			components[i].Parts = slices.Clone(components[i].Parts)
+			components[i].Patterns = slices.Clone(components[i].Patterns)
+			components[i].Summons = slices.Clone(components[i].Summons)
+			components[i].Minions = slices.Clone(components[i].Minions)
+		}
+	}
+	return c.Interface()
+}
+
 // HACK: Add components here as needed.
 func GetArrayComponentsFromID(id ComponentID) any {
 	switch id {
@@ -58,6 +154,18 @@ func GetArrayComponentsFromID(id ComponentID) any {
 	case candyID:
 		return make([]Candy, 0)
 
+	case projectileID:
+		return make([]Projectile, 0)
+	case botID:
+		return make([]Bot, 0)
+	case statusEffectsID:
+		return make([]StatusEffects, 0)
+	case bunkerID:
+		return make([]Bunker, 0)
+	case bossID:
+		return make([]Boss, 0)
+	case bossPartID:
+		return make([]BossPart, 0)
 	default:
 		return nil
 	}
@@ -79,22 +187,22 @@ func GetComponentsFromMask(mask ComponentID) []ComponentID {
 	return components[:count]
 }
 
-func hasComponent(mask, componentsMask ComponentID) bool {
-	newMask := (uint32(mask) & uint32(componentsMask))
-	result := newMask == uint32(mask)
-	return result
+// hasComponent tells whether every component of wanted is in mask. Mind the
+// order, the entity or archetype mask goes second.
+func hasComponent(wanted, mask ComponentID) bool {
+	return wanted&mask == wanted
 }
 
-func GetInput(c Movement, dt float32) Movement {
+func GetInput(c Movement, input InputFrame) Movement {
 	CurrentDirection := c.Direction
 
-	if rl.IsKeyDown(rl.KeyUp) {
+	if input&InputUp != 0 {
 		CurrentDirection = DIRECTIONS[0]
-	} else if rl.IsKeyDown(rl.KeyRight) {
+	} else if input&InputRight != 0 {
 		CurrentDirection = DIRECTIONS[1]
-	} else if rl.IsKeyDown(rl.KeyDown) {
+	} else if input&InputDown != 0 {
 		CurrentDirection = DIRECTIONS[2]
-	} else if rl.IsKeyDown(rl.KeyLeft) {
+	} else if input&InputLeft != 0 {
 		CurrentDirection = DIRECTIONS[3]
 	}
 
@@ -103,86 +211,6 @@ func GetInput(c Movement, dt float32) Movement {
 	return c
 }
 
-type collisionType uint8
-
-const (
-	noC collisionType = iota
-	topC
-	bottomC
-	rightC
-	leftC
-	overlapC
-)
-
-func CheckRectCollision(aPos Position, aSize Collides, bPos Position, bSize Collides) collisionType {
-	aTop := aPos.Y
-	aBottom := aPos.Y + aSize.Height
-	aRight := aPos.X + aSize.Width
-	aLeft := aPos.X
-
-	bTop := bPos.Y
-	bBottom := bPos.Y + bSize.Height
-	bRight := bPos.X + bSize.Width
-	bLeft := bPos.X
-
-	centerA := rl.Vector2{X: aPos.X + aSize.Width/2, Y: aPos.Y + aSize.Height/2}
-	centerB := rl.Vector2{X: bPos.X + bSize.Width/2, Y: bPos.Y + bSize.Height/2}
-
-	// No collision
-	if aRight < bLeft || aLeft > bRight ||
-		aBottom < bTop || aTop > bBottom {
-		return noC
-	}
-
-	relativePosition := rl.Vector2{X: centerA.X - centerB.X, Y: centerA.Y - centerB.Y}
-	if aBottom >= bTop && aTop <= bTop &&
-		aRight > bLeft && aLeft < bRight {
-		if abs(relativePosition.X)/bSize.Width > abs(relativePosition.Y)/bSize.Height {
-			if relativePosition.X > 0 {
-				return rightC
-			}
-			return leftC
-		}
-		return topC
-	}
-
-	if aTop <= bBottom && aBottom >= bBottom &&
-		aRight > bLeft && aLeft < bRight {
-		if abs(relativePosition.X)/bSize.Width > abs(relativePosition.Y)/bSize.Height {
-			if relativePosition.X > 0 {
-				return rightC
-			}
-			return leftC
-		}
-		return bottomC
-	}
-
-	if aRight >= bLeft && aLeft <= bLeft &&
-		aBottom > bTop && aTop < bBottom {
-		if abs(relativePosition.X)/bSize.Width > abs(relativePosition.Y)/bSize.Height {
-			if relativePosition.X > 0 {
-				return rightC
-			}
-			return leftC
-		}
-		return bottomC
-	}
-
-	if aLeft <= bRight && aRight >= bRight &&
-		aBottom > bTop && aTop < bBottom {
-
-		if abs(relativePosition.X)/bSize.Width > abs(relativePosition.Y)/bSize.Height {
-			if relativePosition.X > 0 {
-				return rightC
-			}
-			return leftC
-		}
-		return bottomC
-	}
-	// If we get here, we got full overlap
-	return overlapC
-}
-
 func convertToRectangle(v Collides) rl.Rectangle {
 	return rl.Rectangle{
 		X:      v.X,
@@ -206,3 +234,12 @@ func min[T Number](a, b T) T {
 	}
 	return b
 }
+func sign(a float32) float32 {
+	if a < 0 {
+		return -1
+	}
+	if a > 0 {
+		return 1
+	}
+	return 0
+}
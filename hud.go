@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"math"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+// ===HUD===
+
+// EFFECT_ICONS is the letter and colour showing each status effect.
+var EFFECT_ICONS = map[EffectKind]struct {
+	Letter string
+	Color  rl.Color
+}{
+	EffectSpeed:      {"S", rl.Green},
+	EffectSlow:       {"W", rl.SkyBlue},
+	EffectInvincible: {"I", rl.Gold},
+	EffectPiercing:   {"P", rl.Pink},
+	EffectMagnet:     {"M", rl.Purple},
+	EffectGhost:      {"G", rl.Gray},
+}
+
+type HUDSystem struct {
+	BaseSystem
+}
+
+// Update draws the score and spare lives of every player along the top of the
+// screen, in the colour of their snake, greyed out once they are dead, with
+// the status effects on the snake and the seconds they have left below, and
+// the wave at the bottom in levels with waves and the health of a boss below
+// the scores while one is about.
+func (s *HUDSystem) Update(dt float32) {
+	const fontSize = 20
+	players := s.World.gameState.players
+	for i, p := range players {
+		if p.Left {
+			continue
+		}
+		text := fmt.Sprintf("P%d %d", i+1, p.Score)
+		if p.Lives > 0 {
+			text += fmt.Sprintf(" +%d", p.Lives)
+		}
+		color := rl.Black
+		if sprite, ok := s.World.PrefabComponent(PlayerPrefab(i), spriteID).(Sprite); ok {
+			color = sprite.Color
+		}
+		if !p.Alive {
+			color = rl.Gray
+		}
+		x := int32(10)
+		if len(players) > 1 {
+			// Spread the scores evenly, the last one ends at the right edge.
+			x += int32(i) * (SCREENWIDTH - 20 - rl.MeasureText(text, fontSize)) / int32(len(players)-1)
+		}
+		rl.DrawText(text, x, 10, fontSize, color)
+		s.drawEffects(i, x, 10+fontSize+4)
+	}
+	s.drawWave()
+	s.drawBoss()
+}
+
+// drawWave shows the wave being fought, and the next one big in the middle
+// of the screen during intermissions.
+func (s *HUDSystem) drawWave() {
+	const fontSize = 20
+	g := s.World.gameState
+	if g.waves == nil {
+		return
+	}
+	text := fmt.Sprintf("WAVE %d", g.wave)
+	rl.DrawText(text, SCREENWIDTH/2-rl.MeasureText(text, fontSize)/2, SCREENHEIGHT-30, fontSize, rl.Gray)
+	if g.intermission > 0 {
+		text = fmt.Sprintf("WAVE %d", g.wave+1)
+		if boss, ok := g.waves.Boss(g.wave + 1); ok {
+			text = g.waves.Bosses[boss].Name
+		}
+		rl.DrawText(text, SCREENWIDTH/2-rl.MeasureText(text, 2*fontSize)/2, SCREENHEIGHT/2-fontSize, 2*fontSize, rl.Black)
+	}
+}
+
+// drawBoss shows the name of the boss over a bar of what is left of its weak
+// points, marked where its machine changes phase.
+func (s *HUDSystem) drawBoss() {
+	const fontSize, width, height, y = 20, 400, 12, 60
+	waves := s.World.gameState.waves
+	if waves == nil {
+		return
+	}
+	for _, archetype := range s.World.Query(bossID) {
+		for _, boss := range archetype.Components[bossID].([]Boss) {
+			if boss.Def < 0 || boss.Def >= len(waves.Bosses) {
+				continue
+			}
+			d := waves.Bosses[boss.Def]
+			x := int32(SCREENWIDTH-width) / 2
+			rl.DrawText(d.Name, SCREENWIDTH/2-rl.MeasureText(d.Name, fontSize)/2, y-fontSize-4, fontSize, rl.Maroon)
+			rl.DrawRectangle(x, y, width, height, rl.LightGray)
+			left := float32(boss.Health) / float32(max(boss.MaxHealth, 1))
+			rl.DrawRectangle(x, y, int32(left*width), height, rl.Red)
+			if machine := s.World.bossMachine(d); machine != nil {
+				for _, below := range machine.hurtMarks() {
+					mark := x + int32(below*width)
+					rl.DrawLine(mark, y-2, mark, y+height+2, rl.Black)
+				}
+			}
+			rl.DrawRectangleLines(x, y, width, height, rl.Black)
+			return
+		}
+	}
+}
+
+func (s *HUDSystem) drawEffects(player int, x, y int32) {
+	const size, fontSize = 16, 10
+	entity, ok := s.World.PlayerEntity(player)
+	if !ok {
+		return
+	}
+	effects, ok := getComponent[StatusEffects](s.World, entity, statusEffectsID)
+	if !ok {
+		return
+	}
+	for _, e := range effects.Effects {
+		icon, ok := EFFECT_ICONS[e.Kind]
+		if !ok {
+			continue
+		}
+		rl.DrawRectangle(x, y, size, size, icon.Color)
+		rl.DrawText(icon.Letter, x+(size-rl.MeasureText(icon.Letter, fontSize))/2, y+3, fontSize, rl.White)
+		countdown := fmt.Sprintf("%d", int(math.Ceil(float64(e.Time))))
+		rl.DrawText(countdown, x+size+2, y+3, fontSize, icon.Color)
+		x += size + 4 + rl.MeasureText(countdown, fontSize) + 6
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+// ===INPUT===
+
+// InputFrame is what a player asked for during one tick, one bit per action.
+// The simulation only ever sees frames, never the keyboard, so a run can be
+// replayed from its recorded frames.
+type InputFrame uint8
+
+const (
+	InputUp InputFrame = 1 << iota
+	InputRight
+	InputDown
+	InputLeft
+	InputFire
+)
+
+// ActionMap binds the actions of one player to keys and to a gamepad.
+type ActionMap struct {
+	Up      int32
+	Right   int32
+	Down    int32
+	Left    int32
+	Fire    int32
+	Gamepad int32
+}
+
+// ACTION_MAPS holds the controls of each local player, by player index, one
+// for every one of PLAYER_PREFABS.
+var ACTION_MAPS = []ActionMap{
+	{Up: rl.KeyUp, Right: rl.KeyRight, Down: rl.KeyDown, Left: rl.KeyLeft, Fire: rl.KeyRightControl, Gamepad: 0},
+	{Up: rl.KeyW, Right: rl.KeyD, Down: rl.KeyS, Left: rl.KeyA, Fire: rl.KeySpace, Gamepad: 1},
+	{Up: rl.KeyI, Right: rl.KeyL, Down: rl.KeyK, Left: rl.KeyJ, Fire: rl.KeyU, Gamepad: 2},
+	{Up: rl.KeyKp8, Right: rl.KeyKp6, Down: rl.KeyKp5, Left: rl.KeyKp4, Fire: rl.KeyKp0, Gamepad: 3},
+}
+
+func (m ActionMap) Poll() InputFrame {
+	var input InputFrame
+	bindings := []struct {
+		key    int32
+		button int32
+		frame  InputFrame
+	}{
+		{m.Up, rl.GamepadButtonLeftFaceUp, InputUp},
+		{m.Right, rl.GamepadButtonLeftFaceRight, InputRight},
+		{m.Down, rl.GamepadButtonLeftFaceDown, InputDown},
+		{m.Left, rl.GamepadButtonLeftFaceLeft, InputLeft},
+		{m.Fire, rl.GamepadButtonRightFaceDown, InputFire},
+	}
+	gamepad := rl.IsGamepadAvailable(m.Gamepad)
+	for _, b := range bindings {
+		if rl.IsKeyDown(b.key) || (gamepad && rl.IsGamepadButtonDown(m.Gamepad, b.button)) {
+			input |= b.frame
+		}
+	}
+	return input
+}
+
+// PollLocalPlayers reads the controls of the first players local players. A
+// lone player may use any of the action maps.
+func PollLocalPlayers(players int) []InputFrame {
+	inputs := make([]InputFrame, players)
+	if players == 1 {
+		for _, m := range ACTION_MAPS {
+			inputs[0] |= m.Poll()
+		}
+		return inputs
+	}
+	for i := range inputs {
+		inputs[i] = ACTION_MAPS[i%len(ACTION_MAPS)].Poll()
+	}
+	return inputs
+}
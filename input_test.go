@@ -0,0 +1,23 @@
+package main
+
+import "testing"
+
+func TestActionMaps(t *testing.T) {
+	if len(ACTION_MAPS) < len(PLAYER_PREFABS) {
+		t.Fatalf("%d action maps for %d players", len(ACTION_MAPS), len(PLAYER_PREFABS))
+	}
+	keys := map[int32]int{}
+	gamepads := map[int32]int{}
+	for i, m := range ACTION_MAPS {
+		for _, key := range []int32{m.Up, m.Right, m.Down, m.Left, m.Fire} {
+			if other, ok := keys[key]; ok {
+				t.Errorf("key %d is bound for players %d and %d", key, other+1, i+1)
+			}
+			keys[key] = i
+		}
+		if other, ok := gamepads[m.Gamepad]; ok {
+			t.Errorf("gamepad %d is bound for players %d and %d", m.Gamepad, other+1, i+1)
+		}
+		gamepads[m.Gamepad] = i
+	}
+}
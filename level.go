@@ -0,0 +1,383 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+// ===LEVELS===
+//
+// A level file is a header of "key: value" lines, a "---" line and an ASCII
+// grid where every character is one cell:
+//
+//	#  wall          O  obstacle
+//	P  player spawn  C  candy spawn point
+//	I  invader       B  bunker, its top left corner
+//	.  empty (so is a space)
+//
+// The arena is as big as the grid. Header keys are name, wrap, candies,
+// candy_types (see ParseCandyTypes), cell (the cell size in pixels, RECTSIZE
+// by default), bunker (the mask of every bunker, see ParseBunkerMask) and
+// bunker_cell (the size of a bunker cell, BUNKER_CELL by default) and waves
+// (the waves file the invaders come from, see LoadWaves). Player
+// spawns are handed out in reading order, the first one to player 1.
+
+const LEVELS_DIR = "levels"
+
+type Level struct {
+	Name         string
+	Arena        Arena
+	Cell         float32
+	MaxCandies   int
+	CandyTypes   []CandyType
+	Blocks       []Block
+	PlayerSpawns []rl.Vector2
+	CandySpawns  []rl.Vector2
+	Invaders     []rl.Vector2
+	Bunkers      []LevelBunker
+	Entities     []LevelEntity
+	Waves        *WaveSet
+
+	// The bunker header, read before the grid that places the bunkers.
+	bunkerMask string
+	bunkerCell float32
+}
+
+// LevelEntity is an entity put at At, from Prefab if it has one, with the
+// fields of Components, by component name, laid on top of the prefab's.
+type LevelEntity struct {
+	Prefab     string
+	At         rl.Vector2
+	Components map[string]json.RawMessage
+}
+
+// Block is a static box of the level, solid ones collide.
+type Block struct {
+	Box   AABB
+	Color rl.Color
+	Solid bool
+}
+
+// LoadLevel reads an ASCII level, or a Tiled map when path ends in .json or
+// .tmj.
+func LoadLevel(path string) (*Level, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	parse := ParseLevel
+	if ext := filepath.Ext(path); ext == ".json" || ext == ".tmj" {
+		parse = ParseTiledMap
+	}
+	level, err := parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if level.Name == "" {
+		level.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	return level, nil
+}
+
+// ListLevels returns the level files in dir sorted by name.
+func ListLevels(dir string) ([]string, error) {
+	var paths []string
+	for _, pattern := range []string{"*.txt", "*.json", "*.tmj"} {
+		matches, err := filepath.Glob(filepath.Join(dir, pattern))
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, matches...)
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+func ParseLevel(r io.Reader) (*Level, error) {
+	level := &Level{Cell: RECTSIZE, MaxCandies: 5, bunkerMask: DEFAULT_BUNKER_MASK, bunkerCell: BUNKER_CELL}
+	scanner := bufio.NewScanner(r)
+	line := 0
+
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "---" {
+			break
+		}
+		if text == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(text, ":")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected \"key: value\", got %q", line, text)
+		}
+		if err := level.setOption(strings.TrimSpace(key), strings.TrimSpace(value)); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+	}
+
+	var rows []string
+	for scanner.Scan() {
+		rows = append(rows, strings.TrimRight(scanner.Text(), " \r"))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("level has no grid")
+	}
+	bunker, err := ParseBunkerMask(level.bunkerMask, level.bunkerCell)
+	if err != nil {
+		return nil, err
+	}
+
+	cols := 0
+	for _, row := range rows {
+		cols = max(cols, len(row))
+	}
+	walls := newCellGrid(cols, len(rows))
+	obstacles := newCellGrid(cols, len(rows))
+	for y, row := range rows {
+		for x, char := range row {
+			cell := rl.Vector2{X: float32(x) * level.Cell, Y: float32(y) * level.Cell}
+			switch char {
+			case '#':
+				walls[y][x] = true
+			case 'O':
+				obstacles[y][x] = true
+			case 'P':
+				level.PlayerSpawns = append(level.PlayerSpawns, cell)
+			case 'C':
+				level.CandySpawns = append(level.CandySpawns, cell)
+			case 'I':
+				level.Invaders = append(level.Invaders, cell)
+			case 'B':
+				level.Bunkers = append(level.Bunkers, LevelBunker{At: cell, Mask: bunker})
+			case '.', ' ':
+			default:
+				return nil, fmt.Errorf("line %d: unknown cell %q", line+y+1, char)
+			}
+		}
+	}
+	if len(level.PlayerSpawns) == 0 {
+		return nil, fmt.Errorf("level has no player spawn")
+	}
+
+	level.Arena.Width = float32(cols) * level.Cell
+	level.Arena.Height = float32(len(rows)) * level.Cell
+	for _, box := range mergeCells(walls, level.Cell) {
+		level.Blocks = append(level.Blocks, Block{Box: box, Color: rl.Red, Solid: true})
+	}
+	for _, box := range mergeCells(obstacles, level.Cell) {
+		level.Blocks = append(level.Blocks, Block{Box: box, Color: rl.Maroon, Solid: true})
+	}
+	return level, nil
+}
+
+func (l *Level) setOption(key, value string) error {
+	var err error
+	switch key {
+	case "name":
+		l.Name = value
+	case "wrap":
+		l.Arena.Wrap, err = strconv.ParseBool(value)
+	case "candies":
+		l.MaxCandies, err = strconv.Atoi(value)
+	case "candy_types":
+		l.CandyTypes, err = ParseCandyTypes(value)
+	case "bunker":
+		l.bunkerMask = value
+	case "bunker_cell":
+		var cell float64
+		cell, err = strconv.ParseFloat(value, 32)
+		l.bunkerCell = float32(cell)
+	case "waves":
+		l.Waves, err = LoadWaves(value)
+	case "cell":
+		var cell float64
+		cell, err = strconv.ParseFloat(value, 32)
+		l.Cell = float32(cell)
+	default:
+		return fmt.Errorf("unknown option %q", key)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", key, err)
+	}
+	return nil
+}
+
+// Build resets w and fills it with the entities of the level, with one snake
+// for each player of mode.
+func (l *Level) Build(w *World, mode GameMode) error {
+	w.Reset()
+	if err := checkCandyTypes(w, l.CandyTypes); err != nil {
+		return err
+	}
+	if err := checkWaves(w, l.Waves); err != nil {
+		return err
+	}
+	w.gameState.arena = l.Arena
+	w.gameState.maxCandies = l.MaxCandies
+	w.gameState.candySpawns = l.CandySpawns
+	w.gameState.candyTypes = l.CandyTypes
+	w.gameState.waves = l.Waves
+	w.gameState.mode = mode
+	w.gameState.players = make([]PlayerStatus, mode.Players())
+	w.gameState.playerSpawns = nil
+	for i := range max(len(l.PlayerSpawns), 2) {
+		w.gameState.playerSpawns = append(w.gameState.playerSpawns, l.PlayerSpawn(i))
+	}
+
+	for _, block := range l.Blocks {
+		if _, err := SpawnBlock(w, block); err != nil {
+			return err
+		}
+	}
+	for _, bunker := range l.Bunkers {
+		if _, err := SpawnBunker(w, bunker.At.X, bunker.At.Y, bunker.Mask); err != nil {
+			return err
+		}
+	}
+	for _, e := range l.Entities {
+		if _, err := SpawnLevelEntity(w, e); err != nil {
+			return err
+		}
+	}
+	for _, invader := range l.Invaders {
+		if _, err := w.Spawn("invader", map[ComponentID]any{positionID: Position{X: invader.X, Y: invader.Y}}); err != nil {
+			return err
+		}
+	}
+	if l.Waves != nil {
+		if err := w.NextWave(); err != nil {
+			return err
+		}
+	}
+	for i := range w.gameState.players {
+		spawn := l.PlayerSpawn(i)
+		if _, err := SpawnPlayer(w, i, spawn.X, spawn.Y); err != nil {
+			return err
+		}
+		w.gameState.players[i].Alive = true
+	}
+	w.state = PLAY
+	return nil
+}
+
+// SpawnLevelEntity puts e in w, its components merged field by field over
+// those of its prefab the way a prefab's are over its base's.
+func SpawnLevelEntity(w *World, e LevelEntity) (Entity, error) {
+	var prefab *Prefab
+	if e.Prefab != "" {
+		var ok bool
+		if prefab, ok = w.prefabs[e.Prefab]; !ok {
+			return 0, fmt.Errorf("unknown prefab %q", e.Prefab)
+		}
+	}
+
+	overrides := make(map[ComponentID]any, len(e.Components)+1)
+	for name, fields := range e.Components {
+		id := componentNames[name]
+		if prefab != nil {
+			if base, ok := prefab.Components[id]; ok {
+				baseFields, err := json.Marshal(base)
+				if err != nil {
+					return 0, err
+				}
+				if fields, err = mergeJSON(baseFields, fields); err != nil {
+					return 0, err
+				}
+			}
+		}
+		component, err := decodeComponent(id, fields)
+		if err != nil {
+			return 0, fmt.Errorf("%s: component %q: %w", e.Prefab, name, err)
+		}
+		overrides[id] = component
+	}
+	at := Position{X: e.At.X, Y: e.At.Y}
+	overrides[positionID] = at
+	if prefab != nil {
+		return w.Spawn(e.Prefab, overrides)
+	}
+	if collider, ok := overrides[collidesID].(Collides); ok {
+		collider.X, collider.Y = at.X, at.Y
+		overrides[collidesID] = collider
+	}
+	return w.CreateEntity(overrides), nil
+}
+
+// PlayerSpawn returns where player spawns. Levels with fewer spawns than
+// players mirror the first one across the arena.
+func (l *Level) PlayerSpawn(player int) rl.Vector2 {
+	if player < len(l.PlayerSpawns) {
+		return l.PlayerSpawns[player]
+	}
+	spawn := l.PlayerSpawns[0]
+	return rl.Vector2{X: l.Arena.Width - spawn.X - RECTSIZE, Y: spawn.Y}
+}
+
+func newCellGrid(cols, rows int) [][]bool {
+	grid := make([][]bool, rows)
+	for y := range grid {
+		grid[y] = make([]bool, cols)
+	}
+	return grid
+}
+
+// mergeCells covers the set cells of grid with as few boxes as it greedily
+// can: runs along each row first, then runs of the same width stacked below.
+func mergeCells(grid [][]bool, cell float32) []AABB {
+	var boxes []AABB
+	used := newCellGrid(0, len(grid))
+	for y := range grid {
+		used[y] = make([]bool, len(grid[y]))
+	}
+
+	for y := range grid {
+		for x := 0; x < len(grid[y]); x++ {
+			if !grid[y][x] || used[y][x] {
+				continue
+			}
+			width := 1
+			for x+width < len(grid[y]) && grid[y][x+width] && !used[y][x+width] {
+				width++
+			}
+			height := 1
+			for y+height < len(grid) && rowFree(grid[y+height], used[y+height], x, width) {
+				height++
+			}
+			for dy := range height {
+				for dx := range width {
+					used[y+dy][x+dx] = true
+				}
+			}
+			boxes = append(boxes, NewAABB(float32(x)*cell, float32(y)*cell, float32(width)*cell, float32(height)*cell))
+			x += width - 1
+		}
+	}
+	return boxes
+}
+
+func rowFree(row, used []bool, x, width int) bool {
+	if x+width > len(row) {
+		return false
+	}
+	for dx := range width {
+		if !row[x+dx] || used[x+dx] {
+			return false
+		}
+	}
+	return true
+}
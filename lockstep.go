@@ -0,0 +1,473 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"time"
+)
+
+// ===LOCKSTEP===
+//
+// Two peers run the same simulation and only exchange inputs. Local input is
+// scheduled INPUT_DELAY ticks ahead, which hides the round trip, and a tick is
+// simulated once the input of both players for it is known. Every packet
+// carries all the inputs the other peer hasn't acknowledged yet, so a lost
+// packet is made up for by the next one. Every CHECKSUM_INTERVAL ticks both
+// peers hash their world and compare, any difference is a desync.
+//
+// The host listens, the joiner says hello until the host welcomes it with the
+// seed, level and mode of the match. The host is player 1, the joiner player 2.
+
+const (
+	NET_ADDR          = ":7777"
+	NET_MAGIC         = 0x5A
+	NET_VERSION       = 1
+	NET_MAX_FRAMES    = 64
+	NET_PACKET_SIZE   = 512
+	NET_TIMEOUT       = 5 * time.Second
+	HELLO_INTERVAL    = 100 * time.Millisecond
+	INPUT_DELAY       = 3
+	CHECKSUM_INTERVAL = 30
+)
+
+var (
+	ErrDesync      = errors.New("peers desynchronised")
+	ErrPeerTimeout = errors.New("peer stopped answering")
+)
+
+type packetKind uint8
+
+const (
+	packetHello packetKind = iota + 1
+	packetWelcome
+	packetInput
+)
+
+// Packet is what peers send each other. Welcome packets fill the match
+// fields, input packets the rest.
+type Packet struct {
+	Kind   packetKind
+	Player uint8
+
+	Seed  uint64
+	Mode  GameMode
+	Level uint16
+	Name  string
+
+	// Frames[i] is the input of Player for tick Start+i.
+	Start  uint64
+	Frames []InputFrame
+	// Ack is the first tick the sender still lacks the receiver's input for.
+	Ack          uint64
+	ChecksumTick uint64
+	Checksum     uint64
+}
+
+func (p *Packet) MarshalBinary() ([]byte, error) {
+	if len(p.Frames) > NET_MAX_FRAMES || len(p.Name) > 255 {
+		return nil, fmt.Errorf("packet too big")
+	}
+	buf := []byte{NET_MAGIC, NET_VERSION, byte(p.Kind), p.Player, byte(p.Mode)}
+	buf = binary.BigEndian.AppendUint64(buf, p.Seed)
+	buf = binary.BigEndian.AppendUint16(buf, p.Level)
+	buf = append(buf, byte(len(p.Name)))
+	buf = append(buf, p.Name...)
+	buf = binary.BigEndian.AppendUint64(buf, p.Start)
+	buf = binary.BigEndian.AppendUint64(buf, p.Ack)
+	buf = binary.BigEndian.AppendUint64(buf, p.ChecksumTick)
+	buf = binary.BigEndian.AppendUint64(buf, p.Checksum)
+	buf = append(buf, byte(len(p.Frames)))
+	for _, frame := range p.Frames {
+		buf = append(buf, byte(frame))
+	}
+	return buf, nil
+}
+
+func (p *Packet) UnmarshalBinary(data []byte) error {
+	r := packetReader{data: data}
+	if r.byte() != NET_MAGIC {
+		return fmt.Errorf("not a snake packet")
+	}
+	if version := r.byte(); version != NET_VERSION {
+		return fmt.Errorf("packet version %d, want %d", version, NET_VERSION)
+	}
+	p.Kind = packetKind(r.byte())
+	p.Player = r.byte()
+	p.Mode = GameMode(r.byte())
+	p.Seed = r.uint64()
+	p.Level = r.uint16()
+	p.Name = string(r.bytes(int(r.byte())))
+	p.Start = r.uint64()
+	p.Ack = r.uint64()
+	p.ChecksumTick = r.uint64()
+	p.Checksum = r.uint64()
+	frames := r.bytes(int(r.byte()))
+	p.Frames = make([]InputFrame, len(frames))
+	for i, frame := range frames {
+		p.Frames[i] = InputFrame(frame)
+	}
+	if r.short {
+		return fmt.Errorf("packet truncated")
+	}
+	return nil
+}
+
+// packetReader reads big endian fields, remembering if data ran out.
+type packetReader struct {
+	data  []byte
+	short bool
+}
+
+func (r *packetReader) bytes(n int) []byte {
+	if n > len(r.data) {
+		r.short = true
+		r.data = nil
+		return make([]byte, n)
+	}
+	b := r.data[:n]
+	r.data = r.data[n:]
+	return b
+}
+
+func (r *packetReader) byte() byte     { return r.bytes(1)[0] }
+func (r *packetReader) uint16() uint16 { return binary.BigEndian.Uint16(r.bytes(2)) }
+func (r *packetReader) uint64() uint64 { return binary.BigEndian.Uint64(r.bytes(8)) }
+
+// +++++++++++
+
+type received struct {
+	packet Packet
+	from   net.Addr
+}
+
+// Lockstep runs a Simulation in step with a remote peer.
+type Lockstep struct {
+	Sim    *Simulation
+	Player int
+
+	levels  []*Level
+	conn    net.PacketConn
+	remote  net.Addr
+	packets chan received
+	ready   bool
+	welcome Packet
+
+	// inputs[player][tick], local ones are kept until the peer acknowledges them.
+	inputs    [2]map[uint64]InputFrame
+	next      uint64
+	queued    uint64
+	peerNeeds uint64
+
+	checksums     map[uint64]uint64
+	peerChecksums map[uint64]uint64
+	lastChecksum  uint64
+
+	lastHeard time.Time
+	lastHello time.Time
+}
+
+func newLockstep(sim *Simulation, levels []*Level, conn net.PacketConn, player int) *Lockstep {
+	l := &Lockstep{
+		Sim:           sim,
+		Player:        player,
+		levels:        levels,
+		conn:          conn,
+		packets:       make(chan received, 256),
+		checksums:     make(map[uint64]uint64),
+		peerChecksums: make(map[uint64]uint64),
+		lastHeard:     time.Now(),
+	}
+	for p := range l.inputs {
+		l.inputs[p] = make(map[uint64]InputFrame)
+		// Nobody presses anything during the first ticks, they're the delay.
+		for tick := range uint64(INPUT_DELAY) {
+			l.inputs[p][tick] = 0
+		}
+	}
+	l.queued = INPUT_DELAY
+	go l.read()
+	return l
+}
+
+// HostLockstep listens on addr for a peer to play level levels[level] against
+// in mode, once it joins.
+func HostLockstep(sim *Simulation, levels []*Level, addr string, level int, mode GameMode, seed uint64) (*Lockstep, error) {
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	l := newLockstep(sim, levels, conn, 0)
+	l.welcome = Packet{Kind: packetWelcome, Player: 1, Seed: seed, Mode: mode, Level: uint16(level), Name: levels[level].Name}
+	return l, nil
+}
+
+// JoinLockstep joins the match hosted at addr.
+func JoinLockstep(sim *Simulation, levels []*Level, addr string) (*Lockstep, error) {
+	remote, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.ListenPacket("udp", ":0")
+	if err != nil {
+		return nil, err
+	}
+	l := newLockstep(sim, levels, conn, 1)
+	l.remote = remote
+	return l, nil
+}
+
+func (l *Lockstep) read() {
+	buf := make([]byte, NET_PACKET_SIZE)
+	for {
+		n, from, err := l.conn.ReadFrom(buf)
+		if err != nil {
+			close(l.packets)
+			return
+		}
+		var p Packet
+		if err := p.UnmarshalBinary(buf[:n]); err != nil {
+			log.Println(err)
+			continue
+		}
+		select {
+		case l.packets <- received{p, from}:
+		default:
+			// Dropped like any other datagram, the next one resends it.
+		}
+	}
+}
+
+func (l *Lockstep) Close() error {
+	return l.conn.Close()
+}
+
+// Ready tells whether both peers know the match and the world is built.
+func (l *Lockstep) Ready() bool {
+	return l.ready
+}
+
+func (l *Lockstep) LocalAddr() net.Addr {
+	return l.conn.LocalAddr()
+}
+
+// start builds the match both peers agreed on.
+func (l *Lockstep) start(welcome Packet) error {
+	if int(welcome.Level) >= len(l.levels) || l.levels[welcome.Level].Name != welcome.Name {
+		return fmt.Errorf("host plays level %q, which we don't have", welcome.Name)
+	}
+	w := l.Sim.World
+	w.Seed(welcome.Seed)
+	if err := l.levels[welcome.Level].Build(w, welcome.Mode); err != nil {
+		return err
+	}
+	l.ready = true
+	l.lastHeard = time.Now()
+	return nil
+}
+
+// Update takes the local input of this tick, talks with the peer and
+// simulates every tick whose inputs are all known, up to the end of the game.
+// It returns how many ticks were simulated, which is 0 while waiting for the
+// peer.
+func (l *Lockstep) Update(local InputFrame) (int, error) {
+	if err := l.receive(); err != nil {
+		return 0, err
+	}
+	if !l.ready {
+		if l.Player != 0 && time.Since(l.lastHello) >= HELLO_INTERVAL {
+			l.lastHello = time.Now()
+			return 0, l.send(Packet{Kind: packetHello})
+		}
+		return 0, nil
+	}
+	if time.Since(l.lastHeard) > NET_TIMEOUT {
+		return 0, ErrPeerTimeout
+	}
+
+	if l.queued < l.next+INPUT_DELAY {
+		l.inputs[l.Player][l.queued] = local
+		l.queued++
+	}
+	if err := l.sendInputs(); err != nil {
+		return 0, err
+	}
+
+	stepped := 0
+	peer := 1 - l.Player
+	// Both peers stop on the tick the game ends, Flush takes over from there.
+	for l.Sim.World.state == PLAY {
+		mine, ok := l.inputs[l.Player][l.next]
+		theirs, ok2 := l.inputs[peer][l.next]
+		if !ok || !ok2 {
+			break
+		}
+		inputs := make([]InputFrame, 2)
+		inputs[l.Player], inputs[peer] = mine, theirs
+		l.Sim.Step(inputs)
+		delete(l.inputs[peer], l.next)
+		l.next++
+		stepped++
+		// Our own input goes once we used it and the peer has it too.
+		for tick := range l.inputs[l.Player] {
+			if tick < l.next && tick < l.peerNeeds {
+				delete(l.inputs[l.Player], tick)
+			}
+		}
+
+		if l.next%CHECKSUM_INTERVAL == 0 {
+			sum, err := l.Sim.World.Checksum()
+			if err != nil {
+				return stepped, err
+			}
+			l.checksums[l.next] = sum
+			l.lastChecksum = l.next
+		}
+	}
+	return stepped, l.compareChecksums()
+}
+
+// Flush keeps talking with the peer once the game is over. Until the peer
+// has acknowledged our input for the last tick it can't get there, so we
+// resend it, and after that we only answer the peer so it learns we have all
+// of its own.
+func (l *Lockstep) Flush() error {
+	heard := l.lastHeard
+	if err := l.receive(); err != nil {
+		return err
+	}
+	if !l.Flushed() {
+		if time.Since(l.lastHeard) > NET_TIMEOUT {
+			return ErrPeerTimeout
+		}
+		return l.sendInputs()
+	}
+	if l.lastHeard != heard {
+		return l.sendInputs()
+	}
+	return nil
+}
+
+// Flushed tells whether the peer has all our input up to the last simulated
+// tick.
+func (l *Lockstep) Flushed() bool {
+	return l.peerNeeds >= l.next
+}
+
+func (l *Lockstep) receive() error {
+	for {
+		var r received
+		var open bool
+		select {
+		case r, open = <-l.packets:
+			if !open {
+				return fmt.Errorf("connection closed")
+			}
+		default:
+			return nil
+		}
+		if err := l.handle(r); err != nil {
+			return err
+		}
+	}
+}
+
+func (l *Lockstep) handle(r received) error {
+	p := r.packet
+	switch p.Kind {
+	case packetHello:
+		if l.Player != 0 {
+			return nil
+		}
+		if l.remote != nil && l.remote.String() != r.from.String() {
+			// Somebody else already joined.
+			return nil
+		}
+		l.remote = r.from
+		// The welcome may get lost, so every hello gets one.
+		if err := l.send(l.welcome); err != nil {
+			return err
+		}
+		if !l.ready {
+			return l.start(l.welcome)
+		}
+	case packetWelcome:
+		if l.ready || l.remote == nil || l.remote.String() != r.from.String() {
+			return nil
+		}
+		return l.start(p)
+	case packetInput:
+		if !l.ready || l.remote.String() != r.from.String() || int(p.Player) != 1-l.Player {
+			return nil
+		}
+		l.lastHeard = time.Now()
+		for i, frame := range p.Frames {
+			if tick := p.Start + uint64(i); tick >= l.next {
+				l.inputs[p.Player][tick] = frame
+			}
+		}
+		l.peerNeeds = max(l.peerNeeds, p.Ack)
+		if p.ChecksumTick != 0 {
+			l.peerChecksums[p.ChecksumTick] = p.Checksum
+		}
+	}
+	return nil
+}
+
+// sendInputs sends every local input the peer hasn't acknowledged.
+func (l *Lockstep) sendInputs() error {
+	peer := 1 - l.Player
+	ack := l.next
+	for {
+		if _, ok := l.inputs[peer][ack]; !ok {
+			break
+		}
+		ack++
+	}
+	p := Packet{
+		Kind:         packetInput,
+		Player:       uint8(l.Player),
+		Start:        l.peerNeeds,
+		Ack:          ack,
+		ChecksumTick: l.lastChecksum,
+		Checksum:     l.checksums[l.lastChecksum],
+	}
+	for tick := l.peerNeeds; tick < l.queued && len(p.Frames) < NET_MAX_FRAMES; tick++ {
+		p.Frames = append(p.Frames, l.inputs[l.Player][tick])
+	}
+	return l.send(p)
+}
+
+func (l *Lockstep) send(p Packet) error {
+	data, err := p.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	_, err = l.conn.WriteTo(data, l.remote)
+	return err
+}
+
+// compareChecksums checks the ticks both peers hashed, and forgets them.
+func (l *Lockstep) compareChecksums() error {
+	for tick, theirs := range l.peerChecksums {
+		mine, ok := l.checksums[tick]
+		if !ok {
+			if tick+10*CHECKSUM_INTERVAL < l.next {
+				delete(l.peerChecksums, tick)
+			}
+			continue
+		}
+		if mine != theirs {
+			return fmt.Errorf("%w at tick %d: checksum %x, peer has %x", ErrDesync, tick, mine, theirs)
+		}
+		delete(l.peerChecksums, tick)
+	}
+	for tick := range l.checksums {
+		if tick+10*CHECKSUM_INTERVAL < l.next {
+			delete(l.checksums, tick)
+		}
+	}
+	return nil
+}
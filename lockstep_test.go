@@ -0,0 +1,118 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// checksumSystem hashes the world at the end of every tick.
+type checksumSystem struct {
+	BaseSystem
+	t    *testing.T
+	sums []uint64
+}
+
+func (s *checksumSystem) Update(dt float32) {
+	sum, err := s.World.Checksum()
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	s.sums = append(s.sums, sum)
+}
+
+// scriptedInput is what player presses on tick, the same on every run. The
+// first player goes round in squares firing, the second wanders a while and
+// then runs into a wall.
+func scriptedInput(player int, tick uint64) InputFrame {
+	turns := []InputFrame{InputUp, InputRight, InputDown, InputLeft}
+	if player == 0 {
+		input := turns[tick/13%4]
+		if tick%9 == 0 {
+			input |= InputFire
+		}
+		return input
+	}
+	if tick < 200 {
+		return turns[(tick/19+1)%4]
+	}
+	return InputUp
+}
+
+func TestLockstepPeersAgree(t *testing.T) {
+	prefabs, err := LoadPrefabs(PREFABS_PATH)
+	if err != nil {
+		t.Fatal(err)
+	}
+	level, err := LoadLevel("levels/01_classic.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	levels := []*Level{level}
+
+	var recorders []*checksumSystem
+	newSim := func() *Simulation {
+		w := NewWorld()
+		w.prefabs = prefabs
+		sim := NewSimulation(w)
+		recorder := NewSystem(w, &checksumSystem{t: t})
+		sim.systems = append(sim.systems, *recorder)
+		recorders = append(recorders, *recorder)
+		return sim
+	}
+
+	host, err := HostLockstep(newSim(), levels, "127.0.0.1:0", 0, VERSUS, 42)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer host.Close()
+	joiner, err := JoinLockstep(newSim(), levels, host.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer joiner.Close()
+
+	peers := []*Lockstep{host, joiner}
+	over := func() bool {
+		for _, l := range peers {
+			if !l.Ready() || l.Sim.World.state != DEAD || !l.Flushed() {
+				return false
+			}
+		}
+		return true
+	}
+	deadline := time.Now().Add(30 * time.Second)
+	for !over() {
+		if time.Now().After(deadline) {
+			t.Fatalf("no game over, host at tick %d, joiner at tick %d", host.next, joiner.next)
+		}
+		for _, l := range peers {
+			var err error
+			if l.Ready() && l.Sim.World.state != PLAY {
+				err = l.Flush()
+			} else {
+				_, err = l.Update(scriptedInput(l.Player, l.queued))
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	hostSums, joinerSums := recorders[0].sums, recorders[1].sums
+	if len(hostSums) != len(joinerSums) {
+		t.Fatalf("host played %d ticks, joiner %d", len(hostSums), len(joinerSums))
+	}
+	for tick := range hostSums {
+		if hostSums[tick] != joinerSums[tick] {
+			t.Fatalf("checksums differ on tick %d", tick)
+		}
+	}
+	want, err := host.Sim.World.Checksum()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := joiner.Sim.World.Checksum(); err != nil || got != want {
+		t.Errorf("checksums differ at game over after %d ticks (%v)", len(hostSums), err)
+	}
+}
@@ -1,8 +1,14 @@
 package main
 
 import (
-	rl "github.com/gen2brain/raylib-go/raylib"
+	"flag"
+	"fmt"
 	"log"
+	"os"
+	"runtime"
+	"time"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
 )
 
 const (
@@ -10,73 +16,422 @@ const (
 	SCREENHEIGHT
 )
 const (
-	PLAYER_MOVEMENT_SPEED = 90
+	PRACTICE_HISTORY = 5 * TICK_RATE
+	PRACTICE_REWIND  = 2 * TICK_RATE
 )
 
 func main() {
+	practice := flag.Bool("practice", false, "keep the last seconds of play so that a death can be undone")
+	addr := flag.String("addr", NET_ADDR, "address to host network games on")
+	peer := flag.String("peer", "127.0.0.1"+NET_ADDR, "address of the host to join")
+	serve := flag.String("serve", "", "run a headless arena server on this address, like "+SERVER_ADDR)
+	serveLevel := flag.String("level", "", "level file the server and the gym play, the first one of "+LEVELS_DIR+" by default, the batch plays all of them")
+	connect := flag.String("connect", "", "play on the arena server at this address")
+	httpAddr := flag.String("http", "", "serve a spectator web view on this address, like localhost:8080")
+	bots := flag.Int("bots", 0, "how many local players bots play, counting back from the last one")
+	gym := flag.String("gym", "", "serve a training environment as JSON lines, on stdin and stdout with - or on this address")
+	prefabsPath := flag.String("prefabs", PREFABS_PATH, "prefab file to spawn entities from")
+	aiDebug := flag.Bool("ai-debug", false, "show the state of every AI and whether it sees a snake, F3 toggles it")
+	batch := flag.Int("batch", 0, "play this many headless games with bots and report how they went")
+	batchConfig := BatchConfig{Workers: runtime.NumCPU()}
+	flag.IntVar(&batchConfig.Workers, "workers", batchConfig.Workers, "games of the batch played at once")
+	flag.Uint64Var(&batchConfig.Seed, "seed", 1, "seed of the first game of the batch, the next ones count up from it")
+	batchMode := flag.Int("mode", 0, "game mode of the batch: 0 for 1 player, 1 for versus, 2 for co-op")
+	flag.Uint64Var(&batchConfig.MaxTicks, "ticks", 60*TICK_RATE, "ticks a game of the batch lasts at most, 0 for no limit")
+	flag.IntVar(&batchConfig.MaxCandies, "candies", 0, "candies at once in the games of the batch, the level's count when 0")
+	flag.Func("candy-types", `candy types of the games of the batch, like "candy 3, candy_magnet 1", the level's when not set`, func(value string) (err error) {
+		batchConfig.CandyTypes, err = ParseCandyTypes(value)
+		return err
+	})
+	marchSpeed := flag.Float64("march", 0, "multiplies how fast every wave of the batch marches, left alone when 0")
+	fireRate := flag.Float64("fire-rate", 0, "multiplies how often every wave of the batch fires, left alone when 0")
+	batchCSV := flag.String("csv", "", "write the batch games as CSV to this file")
+	batchJSON := flag.String("json", "", "write the batch summary and games as JSON to this file, stdout when neither -csv nor -json is set")
+	flag.Parse()
+
+	var web *WebView
+	if *httpAddr != "" {
+		web = NewWebView()
+		go func() { log.Println(web.ListenAndServe(*httpAddr)) }()
+	}
+
+	prefabs, err := LoadPrefabs(*prefabsPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *batch > 0 {
+		if *batchMode < 0 || *batchMode >= len(GAME_MODES) {
+			log.Fatalf("unknown mode %d", *batchMode)
+		}
+		batchConfig.Games, batchConfig.Mode = *batch, GAME_MODES[*batchMode]
+		batchConfig.MarchSpeed, batchConfig.FireRate = float32(*marchSpeed), float32(*fireRate)
+		if err := runBatch(batchConfig, prefabs, *serveLevel, *batchCSV, *batchJSON); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if *serve != "" || *gym != "" {
+		path := *serveLevel
+		if path == "" {
+			paths, err := ListLevels(LEVELS_DIR)
+			if err != nil || len(paths) == 0 {
+				log.Fatal("no levels to serve ", err)
+			}
+			path = paths[0]
+		}
+		level, err := LoadLevel(path)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if *gym != "" {
+			log.Fatal(RunGym(*gym, level, prefabs))
+		}
+		log.Fatal(RunServer(*serve, level, prefabs, web))
+	}
+
 	rl.InitWindow(SCREENWIDTH, SCREENHEIGHT, "Snake")
 
 	defer rl.CloseWindow()
+	audio := NewAudio()
+	defer audio.Close()
+	if *connect != "" {
+		client, err := DialClient(*connect, prefabs)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer client.Close()
+		if err := playOnline(client, web); err != nil {
+			log.Println(err)
+		}
+		return
+	}
 	world := NewWorld()
-	world.gameState.maxCandies = 5
-	world.gameState.currentCandies = 0
+	world.state = MENU
+	world.prefabs = prefabs
+	world.Seed(uint64(time.Now().UnixNano()))
+	sim := NewSimulation(world)
 	renderSys := *NewSystem(world, &DrawSystem{})
-	movementSys := *NewSystem(world, &MovementSystem{})
-	collisionSys := *NewSystem(world, &CollisionSystem{})
+	hudSys := *NewSystem(world, &HUDSystem{})
+	aiDebugSys := *NewSystem(world, &AIDebugSystem{})
+	history := NewSnapshotRing(PRACTICE_HISTORY)
 	// pjTexture := rl.LoadTexture("assets/player/fishy.png")
 	// defer rl.UnloadTexture(pjTexture)
 
-	player := make(map[ComponentID]any)
-	player[positionID] = Position{
-		X: 200,
-		Y: 200,
-	}
-
-	player[movementID] = Movement{Direction: rl.Vector2{0, 0}, Speed: 500}
-	player[collidesID] = Collides{X: player[positionID].(Position).X, Y: player[positionID].(Position).Y, Width: 20, Height: 20}
-	player[playerControlledID] = PlayerControlled{Body: []rl.Vector2{
-		{X: 200, Y: 200}},
-	}
-	player[spriteID] = Sprite{Width: 20, Height: 20, Color: rl.Lime}
-
-	border1 := make(map[ComponentID]any)
-	border2 := make(map[ComponentID]any)
-	border3 := make(map[ComponentID]any)
-	border4 := make(map[ComponentID]any)
-	border1[positionID] = Position{X: 0, Y: 0}
-	border1[spriteID] = Sprite{Width: SCREENWIDTH, Height: 20, Color: rl.Red}
-	border1[collidesID] = Collides{X: 0, Y: 0, Width: SCREENWIDTH, Height: 20}
-	border2[positionID] = Position{X: SCREENWIDTH - 20, Y: 0}
-	border2[spriteID] = Sprite{Width: 100, Height: SCREENHEIGHT, Color: rl.Red}
-	border2[collidesID] = Collides{X: SCREENWIDTH - 20, Y: 0, Width: 100, Height: SCREENHEIGHT}
-	border3[positionID] = Position{X: 0, Y: 0}
-	border3[spriteID] = Sprite{Width: 20, Height: SCREENHEIGHT, Color: rl.Red}
-	border3[collidesID] = Collides{X: 0, Y: 0, Width: 20, Height: SCREENHEIGHT}
-	border4[positionID] = Position{X: 0, Y: SCREENHEIGHT - 20}
-	border4[spriteID] = Sprite{Width: SCREENWIDTH, Height: 100, Color: rl.Red}
-	border4[collidesID] = Collides{X: 0, Y: SCREENHEIGHT - 20, Width: SCREENWIDTH, Height: 100}
-	world.CreateEntity(player)
-	world.CreateEntity(border1)
-	world.CreateEntity(border2)
-	world.CreateEntity(border3)
-	world.CreateEntity(border4)
+	levelPaths, err := ListLevels(LEVELS_DIR)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var levels []*Level
+	levelMenu := Menu{Title: "SNAKE INVADERS"}
+	for _, path := range levelPaths {
+		level, err := LoadLevel(path)
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+		levels = append(levels, level)
+		levelMenu.Items = append(levelMenu.Items, level.Name)
+	}
+	levelMenu.Items = append(levelMenu.Items, "Join game at "+*peer)
+	modeMenu := NewModeMenu()
+	pauseMenu := NewPauseMenu()
+	attract := newAttractMode(prefabs, levels)
+	chosenLevel := -1
+	var accumulator float32
+
+	// session is the network game being played, if any.
+	var session *Lockstep
+	var netStatus string
+	endSession := func(err error) {
+		if err != nil {
+			log.Println(err)
+			netStatus = "NETWORK ERROR, SEE LOG"
+		}
+		session.Close()
+		session = nil
+		world.Reset()
+		world.state = MENU
+	}
 	//
 	for !rl.WindowShouldClose() {
 		dt := rl.GetFrameTime()
 
-		movementSys.Update(dt)
-		collisionSys.Update(dt)
-		if world.gameState.currentCandies < world.gameState.maxCandies {
-			world.gameState.currentCandies += 1
-			log.Println("CANDY GENERATED")
-			c := CandyGenerator()
-			world.CreateEntity(c)
+		switch world.state {
+		case MENU:
+			if session != nil {
+				if rl.IsKeyPressed(rl.KeyBackspace) {
+					endSession(nil)
+					break
+				}
+				// The world gets built and played once the peers agree.
+				if _, err := session.Update(0); err != nil {
+					endSession(err)
+				}
+				break
+			}
+			if chosenLevel < 0 {
+				if i, ok := levelMenu.Update(); ok && i == len(levels) {
+					netStatus = ""
+					if session, err = JoinLockstep(sim, levels, *peer); err != nil {
+						log.Println(err)
+						netStatus = "NETWORK ERROR, SEE LOG"
+					}
+				} else if ok {
+					chosenLevel = i
+				}
+				break
+			}
+			if rl.IsKeyPressed(rl.KeyBackspace) {
+				chosenLevel = -1
+				break
+			}
+			if i, ok := modeMenu.Update(); ok && i >= len(GAME_MODES) {
+				netStatus = ""
+				mode := NET_GAME_MODES[i-len(GAME_MODES)]
+				if session, err = HostLockstep(sim, levels, *addr, chosenLevel, mode, uint64(time.Now().UnixNano())); err != nil {
+					log.Println(err)
+					netStatus = "NETWORK ERROR, SEE LOG"
+				}
+				chosenLevel = -1
+			} else if ok {
+				history = NewSnapshotRing(PRACTICE_HISTORY)
+				if err := levels[chosenLevel].Build(world, GAME_MODES[i]); err != nil {
+					log.Println(err)
+					world.Reset()
+					world.state = MENU
+				}
+				players := len(world.gameState.players)
+				for p := max(players-*bots, 0); p < players; p++ {
+					world.MakeBot(p)
+				}
+				chosenLevel = -1
+			}
+		case PLAY:
+			// The peer can't wait for us, network games don't pause.
+			if session == nil && rl.IsKeyPressed(rl.KeyP) {
+				world.state = PAUSE
+				break
+			}
+			if session == nil && *practice && rl.IsKeyPressed(rl.KeyF9) {
+				if err := history.VerifyReplay(sim, PRACTICE_HISTORY); err != nil {
+					log.Println(err)
+				} else {
+					log.Println("REPLAY OK")
+				}
+			}
+			accumulator = min(accumulator+dt, 0.25)
+			for accumulator >= TICK && world.state == PLAY && session != nil {
+				if _, err := session.Update(PollLocalPlayers(1)[0]); err != nil {
+					endSession(err)
+				}
+				accumulator -= TICK
+			}
+			for accumulator >= TICK && world.state == PLAY {
+				inputs := PollLocalPlayers(len(world.gameState.players))
+				if *practice {
+					history.Push(world.Snapshot(), inputs)
+				}
+				sim.Step(inputs)
+				accumulator -= TICK
+			}
+		case PAUSE:
+			if i, ok := pauseMenu.Update(); ok {
+				pauseMenu.ChoosePause(world, i)
+			}
+		case DEAD:
+			if session == nil && *practice && rl.IsKeyPressed(rl.KeyBackspace) && history.Rewind(sim, PRACTICE_REWIND) {
+				world.state = PLAY
+				break
+			}
+			if session != nil {
+				// The peer may still lack our last inputs to end the game too.
+				if err := session.Flush(); err != nil {
+					endSession(err)
+					break
+				}
+			}
+			if rl.IsKeyPressed(rl.KeyEnter) {
+				if session != nil {
+					if session.Flushed() {
+						endSession(nil)
+					}
+					break
+				}
+				world.Reset()
+				world.state = MENU
+			}
 		}
 
-		log.Println(world.nextEntityID)
+		audio.Play(world.DrainEvents())
+		web.Publish(world)
+
 		rl.BeginDrawing()
 		rl.ClearBackground(VICOLOR)
+		if world.state == MENU && session == nil {
+			attract.Update(dt)
+		}
 		renderSys.Update(dt)
+		if rl.IsKeyPressed(rl.KeyF3) {
+			*aiDebug = !*aiDebug
+		}
+		if *aiDebug {
+			aiDebugSys.Update(dt)
+		}
+		hudSys.Update(dt)
+		switch world.state {
+		case MENU:
+			switch {
+			case session != nil && session.Player == 0:
+				waitMenu := Menu{Title: "WAITING FOR PLAYER 2", Items: []string{"Hosting on " + session.LocalAddr().String(), "BACKSPACE TO CANCEL"}, Selected: -1}
+				waitMenu.Draw()
+			case session != nil:
+				waitMenu := Menu{Title: "JOINING", Items: []string{*peer, "BACKSPACE TO CANCEL"}, Selected: -1}
+				waitMenu.Draw()
+			case chosenLevel < 0:
+				levelMenu.Draw()
+			default:
+				modeMenu.Draw()
+			}
+			rl.DrawText(netStatus, 10, SCREENHEIGHT-30, 20, rl.RayWhite)
+		case PAUSE:
+			pauseMenu.Draw()
+		case DEAD:
+			rl.DrawText("GAME OVER", SCREENWIDTH/2-110, SCREENHEIGHT/2-20, 40, rl.Black)
+			if winner, ok := world.Winner(); ok {
+				rl.DrawText(fmt.Sprintf("PLAYER %d WINS", winner+1), SCREENWIDTH/2-90, SCREENHEIGHT/2-60, 30, rl.Black)
+			}
+			if *practice {
+				rl.DrawText("BACKSPACE TO REWIND", SCREENWIDTH/2-110, SCREENHEIGHT/2+30, 20, rl.Black)
+			}
+		}
 		rl.EndDrawing()
 	}
 }
+
+// playOnline draws the world of client, feeding it the local input every tick,
+// until the window closes or the connection is lost.
+func playOnline(client *Client, web *WebView) error {
+	renderSys := *NewSystem(client.World, &DrawSystem{})
+	hudSys := *NewSystem(client.World, &HUDSystem{})
+	var accumulator float32
+	for !rl.WindowShouldClose() {
+		dt := rl.GetFrameTime()
+		accumulator = min(accumulator+dt, 0.25)
+		for accumulator >= TICK {
+			if err := client.Update(PollLocalPlayers(1)[0]); err != nil {
+				return err
+			}
+			accumulator -= TICK
+		}
+		web.Publish(client.World)
+
+		rl.BeginDrawing()
+		rl.ClearBackground(VICOLOR)
+		renderSys.Update(dt)
+		hudSys.Update(dt)
+		if p := client.Player; p < len(client.World.gameState.players) && !client.World.gameState.players[p].Alive {
+			rl.DrawText("RESPAWNING", SCREENWIDTH/2-90, SCREENHEIGHT/2-20, 30, rl.Black)
+		}
+		rl.EndDrawing()
+	}
+	return nil
+}
+
+// attractMode plays the levels one after the other with a bot, behind the
+// title menu.
+type attractMode struct {
+	world       *World
+	sim         *Simulation
+	renderSys   System
+	hudSys      System
+	levels      []*Level
+	next        int
+	accumulator float32
+}
+
+func newAttractMode(prefabs Prefabs, levels []*Level) *attractMode {
+	w := NewWorld()
+	w.prefabs = prefabs
+	w.Seed(uint64(time.Now().UnixNano()))
+	return &attractMode{
+		world:     w,
+		sim:       NewSimulation(w),
+		renderSys: *NewSystem(w, &DrawSystem{}),
+		hudSys:    *NewSystem(w, &HUDSystem{}),
+		levels:    levels,
+	}
+}
+
+// Update steps the demo, starting the next level once the bot dies, and draws it.
+func (a *attractMode) Update(dt float32) {
+	if len(a.levels) == 0 {
+		return
+	}
+	if a.world.state != PLAY {
+		level := a.levels[a.next%len(a.levels)]
+		a.next++
+		if err := level.Build(a.world, SOLO); err != nil {
+			log.Println(err)
+			a.levels = nil
+			return
+		}
+		a.world.MakeBot(0)
+	}
+	a.accumulator = min(a.accumulator+dt, 0.25)
+	for a.accumulator >= TICK && a.world.state == PLAY {
+		a.sim.Step(nil)
+		a.accumulator -= TICK
+	}
+	a.renderSys.Update(dt)
+	a.hudSys.Update(dt)
+}
+
+// runBatch plays the batch on the level at path, or on every level, and
+// writes the reports asked for.
+func runBatch(config BatchConfig, prefabs Prefabs, path, csvPath, jsonPath string) error {
+	paths := []string{path}
+	if path == "" {
+		var err error
+		if paths, err = ListLevels(LEVELS_DIR); err != nil {
+			return err
+		}
+	}
+	var levels []*Level
+	for _, path := range paths {
+		level, err := LoadLevel(path)
+		if err != nil {
+			return err
+		}
+		levels = append(levels, level)
+	}
+
+	start := time.Now()
+	games, err := RunBatch(levels, prefabs, config)
+	if err != nil {
+		return err
+	}
+	log.Printf("%d games in %s\n", len(games), time.Since(start))
+
+	if csvPath != "" {
+		f, err := os.Create(csvPath)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		if err := WriteBatchCSV(f, games); err != nil {
+			return err
+		}
+	}
+	if jsonPath == "" {
+		if csvPath != "" {
+			return nil
+		}
+		return WriteBatchJSON(os.Stdout, config, games)
+	}
+	f, err := os.Create(jsonPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return WriteBatchJSON(f, config, games)
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+// ===MENU===
+type Menu struct {
+	Title    string
+	Items    []string
+	Selected int
+}
+
+// Update moves the selection with the arrow keys and returns the chosen item
+// once Enter is pressed.
+func (m *Menu) Update() (chosen int, ok bool) {
+	if len(m.Items) == 0 {
+		return 0, false
+	}
+	if rl.IsKeyPressed(rl.KeyDown) {
+		m.Selected = (m.Selected + 1) % len(m.Items)
+	}
+	if rl.IsKeyPressed(rl.KeyUp) {
+		m.Selected = (m.Selected + len(m.Items) - 1) % len(m.Items)
+	}
+	if rl.IsKeyPressed(rl.KeyEnter) {
+		return m.Selected, true
+	}
+	return 0, false
+}
+
+func (m *Menu) Draw() {
+	const fontSize = 20
+	rl.DrawRectangle(0, 0, SCREENWIDTH, SCREENHEIGHT, rl.Fade(rl.Black, 0.6))
+	rl.DrawText(m.Title, SCREENWIDTH/2-rl.MeasureText(m.Title, 2*fontSize)/2, 120, 2*fontSize, rl.RayWhite)
+	for i, item := range m.Items {
+		color := rl.LightGray
+		if i == m.Selected {
+			color = VICOLOR
+			item = "> " + item
+		}
+		rl.DrawText(item, SCREENWIDTH/2-rl.MeasureText(item, fontSize)/2, int32(200+i*(fontSize+10)), fontSize, color)
+	}
+}
+
+// +++++++++++
+// The mode menu comes after the level menu, its items are GAME_MODES and then
+// NET_GAME_MODES to host online.
+func NewModeMenu() *Menu {
+	m := &Menu{Title: "PLAYERS"}
+	for _, mode := range GAME_MODES {
+		m.Items = append(m.Items, mode.String())
+	}
+	for _, mode := range NET_GAME_MODES {
+		m.Items = append(m.Items, "Host "+mode.String()+" online")
+	}
+	return m
+}
+
+// +++++++++++
+// The pause menu lists Resume, one save and one load entry per slot, a JSON
+// dump for debugging and a way back to the title.
+func NewPauseMenu() *Menu {
+	m := &Menu{Title: "PAUSED", Items: []string{"Resume"}}
+	for slot := 1; slot <= SAVE_SLOTS; slot++ {
+		m.Items = append(m.Items, fmt.Sprintf("Save to slot %d", slot))
+	}
+	for slot := 1; slot <= SAVE_SLOTS; slot++ {
+		m.Items = append(m.Items, fmt.Sprintf("Load slot %d", slot))
+	}
+	m.Items = append(m.Items, "Dump JSON", "Quit to title")
+	return m
+}
+
+// ChoosePause runs the pause menu entry chosen and retitles the menu with
+// how it went.
+func (m *Menu) ChoosePause(w *World, chosen int) {
+	var err error
+	switch {
+	case chosen == 0:
+		w.state = PLAY
+		m.Title = "PAUSED"
+		return
+	case chosen <= SAVE_SLOTS:
+		err = SaveToFile(w, SlotPath(chosen), SaveBinary)
+		m.Title = fmt.Sprintf("SAVED SLOT %d", chosen)
+	case chosen <= 2*SAVE_SLOTS:
+		slot := chosen - SAVE_SLOTS
+		if err = LoadFromFile(w, SlotPath(slot)); err == nil {
+			w.state = PAUSE
+			m.Title = fmt.Sprintf("LOADED SLOT %d", slot)
+		}
+	case chosen == 2*SAVE_SLOTS+1:
+		path := filepath.Join(SAVES_DIR, "debug.json")
+		err = SaveToFile(w, path, SaveJSON)
+		m.Title = "DUMPED " + path
+	default:
+		w.Reset()
+		w.state = MENU
+		m.Title = "PAUSED"
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		m.Title = "FAILED, SEE LOG"
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+// Step integrates c over dt and returns the displacement to apply.
+//
+// Speed is the speed the mover wants to reach along Direction. With no
+// Acceleration it gets there instantly, which is how the snake moves. With
+// Acceleration it eases towards it, so a zero Direction brakes to a stop.
+// Movers with neither keep whatever Velocity they have, so impulses, Drag and
+// gravity take over.
+func (c *Movement) Step(dt float32) rl.Vector2 {
+	target := rl.Vector2Scale(c.Direction, c.Speed)
+	if c.Acceleration > 0 {
+		c.Velocity = rl.Vector2MoveTowards(c.Velocity, target, c.Acceleration*dt)
+	} else if c.Speed != 0 {
+		c.Velocity = target
+	}
+
+	c.Velocity.Y += GRAVITY * c.GravityScale * dt
+	if c.Drag > 0 {
+		c.Velocity = rl.Vector2Scale(c.Velocity, 1/(1+c.Drag*dt))
+	}
+	if c.MaxSpeed > 0 {
+		if length := GetVectorLength(c.Velocity); length > c.MaxSpeed {
+			c.Velocity = rl.Vector2Scale(c.Velocity, c.MaxSpeed/length)
+		}
+	}
+
+	return rl.Vector2Scale(c.Velocity, dt)
+}
+
+func (c *Movement) Impulse(v rl.Vector2) {
+	c.Velocity = rl.Vector2Add(c.Velocity, v)
+}
+
+// ===MOTION PROFILES===
+
+func SnakeMotion(speed float32) Movement {
+	return Movement{Speed: speed}
+}
+
+func ProjectileMotion(direction rl.Vector2, speed float32) Movement {
+	return Movement{Direction: direction, Speed: speed}
+}
+
+// EnemyMotion accelerates towards speed and brakes when it has no direction.
+func EnemyMotion(speed, acceleration float32) Movement {
+	return Movement{Speed: speed, Acceleration: acceleration, MaxSpeed: speed}
+}
+
+// ParticleMotion is thrown along direction at speed and left to gravity and
+// drag.
+func ParticleMotion(direction rl.Vector2, speed float32) Movement {
+	m := Movement{Drag: 1, GravityScale: 1}
+	m.Impulse(rl.Vector2Scale(direction, speed))
+	return m
+}
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"log"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+// ===PLAYERS===
+
+type GameMode int
+
+const (
+	SOLO GameMode = iota
+	VERSUS
+	COOP
+	// ARENA never ends, players come and go and respawn when they die.
+	ARENA
+)
+
+const (
+	FIRE_COOLDOWN = 0.4
+	RESPAWN_DELAY = 2
+	// SPAWN_CLEARANCE is how far from anything solid a snake respawns.
+	SPAWN_CLEARANCE = 2 * RECTSIZE
+)
+
+// PLAYER_PREFABS is the prefab each player index spawns from, in turns.
+var PLAYER_PREFABS = []string{"player", "player2", "player3", "player4"}
+
+var GAME_MODES = []GameMode{SOLO, VERSUS, COOP}
+
+// NET_GAME_MODES can be played over the network, one player on each side.
+var NET_GAME_MODES = []GameMode{VERSUS, COOP}
+
+func (m GameMode) String() string {
+	switch m {
+	case VERSUS:
+		return "2 Players Versus"
+	case COOP:
+		return "2 Players Co-op"
+	case ARENA:
+		return "Arena"
+	default:
+		return "1 Player"
+	}
+}
+
+// Players is how many players the mode starts with, arena players join later.
+func (m GameMode) Players() int {
+	switch m {
+	case SOLO:
+		return 1
+	case ARENA:
+		return 0
+	default:
+		return 2
+	}
+}
+
+// What a snake died of.
+const (
+	DEATH_WALL    = "wall"
+	DEATH_INVADER = "invader"
+	DEATH_SELF    = "self"
+	DEATH_SNAKE   = "snake"
+	DEATH_HEAD_ON = "head-on"
+	DEATH_SHOT    = "shot"
+)
+
+// PlayerStatus is what is left of a player once their snake is gone.
+type PlayerStatus struct {
+	Score int
+	Alive bool
+	// Respawn counts down to the next snake in arena games.
+	Respawn float32
+	Left    bool
+
+	Candies int
+	Kills   int
+	Deaths  int
+	// Cause is what the last snake of the player died of.
+	Cause string
+	// Lives are the snakes the player gets back after dying, arenas don't
+	// count them.
+	Lives int
+	// Bot has a bot drive every snake of the player.
+	Bot bool
+}
+
+// InGame tells whether the player has a snake, or one to come back with.
+func (p PlayerStatus) InGame() bool {
+	return p.Alive || p.Lives > 0
+}
+
+func PlayerPrefab(index int) string {
+	return PLAYER_PREFABS[index%len(PLAYER_PREFABS)]
+}
+
+func SpawnPlayer(w *World, index int, x, y float32) (Entity, error) {
+	overrides := map[ComponentID]any{
+		positionID:         Position{X: x, Y: y},
+		playerControlledID: PlayerControlled{Index: index},
+	}
+	if index < len(w.gameState.players) && w.gameState.players[index].Bot {
+		overrides[botID] = Bot{Fire: true}
+	}
+	return w.Spawn(PlayerPrefab(index), overrides)
+}
+
+// Input returns the input of player for the current tick.
+func (w *World) Input(player int) InputFrame {
+	if player < 0 || player >= len(w.inputs) {
+		return 0
+	}
+	return w.inputs[player]
+}
+
+// PlayerStatusOf returns the status of the player controlling entity, if any.
+func (w *World) PlayerStatusOf(entity Entity) (*PlayerStatus, bool) {
+	player, ok := getComponent[PlayerControlled](w, entity, playerControlledID)
+	if !ok || player.Index < 0 || player.Index >= len(w.gameState.players) {
+		return nil, false
+	}
+	return &w.gameState.players[player.Index], true
+}
+
+// AddScore credits points to the player controlling entity, if any.
+func (w *World) AddScore(entity Entity, points int) {
+	if status, ok := w.PlayerStatusOf(entity); ok {
+		status.Score += points
+	}
+}
+
+// KillPlayer removes the snake of entity, which died of cause, unless it is
+// invincible, and ends the round once the mode says so: when nobody is
+// left, or in versus when a single player is left. Arena rounds never end,
+// the player respawns instead, as do players with lives left.
+func (w *World) KillPlayer(entity Entity, cause string) {
+	if !w.HasComponent(entity, playerControlledID) {
+		return
+	}
+	if _, invincible := w.Effect(entity, EffectInvincible); invincible {
+		return
+	}
+	if status, ok := w.PlayerStatusOf(entity); ok {
+		status.Alive = false
+		status.Respawn = RESPAWN_DELAY
+		status.Deaths++
+		status.Cause = cause
+	}
+	w.RemoveEntity(entity)
+	if w.gameState.mode == ARENA {
+		return
+	}
+
+	alive := 0
+	for _, p := range w.gameState.players {
+		if p.InGame() {
+			alive++
+		}
+	}
+	if alive == 0 || (w.gameState.mode == VERSUS && alive == 1) {
+		w.state = DEAD
+	}
+}
+
+// PlayerEntity finds the snake of player.
+func (w *World) PlayerEntity(player int) (Entity, bool) {
+	for _, archetype := range w.Query(playerControlledID) {
+		for idx, p := range archetype.Components[playerControlledID].([]PlayerControlled) {
+			if p.Index == player {
+				return archetype.Entities[idx], true
+			}
+		}
+	}
+	return 0, false
+}
+
+// JoinPlayer adds a player to an arena game, reusing the slot of one that
+// left. Their snake shows up on the next tick.
+func (w *World) JoinPlayer() int {
+	status := PlayerStatus{}
+	for i, p := range w.gameState.players {
+		if p.Left {
+			w.gameState.players[i] = status
+			return i
+		}
+	}
+	w.gameState.players = append(w.gameState.players, status)
+	return len(w.gameState.players) - 1
+}
+
+// LeavePlayer takes player and their snake out of the game.
+func (w *World) LeavePlayer(player int) {
+	if entity, ok := w.PlayerEntity(player); ok {
+		w.RemoveEntity(entity)
+	}
+	if player < len(w.gameState.players) {
+		w.gameState.players[player] = PlayerStatus{Left: true}
+	}
+}
+
+// FreePlayerSpawn returns the first spawn point, starting from the one of
+// player, with nothing solid nor any snake within SPAWN_CLEARANCE.
+func (w *World) FreePlayerSpawn(player int) (rl.Vector2, bool) {
+	spawns := w.gameState.playerSpawns
+	var points []rl.Vector2
+	for i := range spawns {
+		points = append(points, spawns[(player+i)%len(spawns)])
+	}
+	if len(points) == 0 {
+		return rl.Vector2{}, false
+	}
+	at, err := w.FindSpawn(SpawnRules{Points: points, Clearance: SPAWN_CLEARANCE, SolidOnly: true, First: true})
+	if err != nil {
+		return rl.Vector2{}, false
+	}
+	return rl.Vector2{X: at.X, Y: at.Y}, true
+}
+
+// Winner returns the index of the last snake standing in versus.
+func (w *World) Winner() (int, bool) {
+	winner := -1
+	for i, p := range w.gameState.players {
+		if p.InGame() {
+			if winner >= 0 {
+				return 0, false
+			}
+			winner = i
+		}
+	}
+	return winner, winner >= 0 && w.gameState.mode == VERSUS
+}
+
+// +++++++++++
+// FireSystem shoots a projectile ahead of each snake whose player holds fire,
+// at most once every FIRE_COOLDOWN seconds.
+type FireSystem struct {
+	BaseSystem
+}
+
+func (s *FireSystem) Update(dt float32) {
+	type shot struct {
+		owner     Entity
+		x, y      float32
+		direction rl.Vector2
+	}
+	var shots []shot
+
+	archetypes := s.World.Query(positionID, movementID, playerControlledID)
+	for archIdx := range archetypes {
+		entities := archetypes[archIdx].Entities
+		position := archetypes[archIdx].Components[positionID].([]Position)
+		mover := archetypes[archIdx].Components[movementID].([]Movement)
+		player := archetypes[archIdx].Components[playerControlledID].([]PlayerControlled)
+		for idx := range entities {
+			player[idx].Cooldown = max(player[idx].Cooldown-dt, 0)
+			direction := mover[idx].Direction
+			if s.World.Input(player[idx].Index)&InputFire == 0 || player[idx].Cooldown > 0 || direction == (rl.Vector2{}) {
+				continue
+			}
+			player[idx].Cooldown = FIRE_COOLDOWN
+			shots = append(shots, shot{
+				owner:     entities[idx],
+				x:         position[idx].X + RECTSIZE/2 + direction.X*RECTSIZE/2,
+				y:         position[idx].Y + RECTSIZE/2 + direction.Y*RECTSIZE/2,
+				direction: direction,
+			})
+		}
+	}
+
+	// Spawning moves archetypes around, so it waits until the query is done.
+	movement, _ := s.World.PrefabComponent("projectile", movementID).(Movement)
+	size, _ := s.World.PrefabComponent("projectile", collidesID).(Collides)
+	for _, sh := range shots {
+		x, y := sh.x-size.Width/2, sh.y-size.Height/2
+		if _, err := SpawnProjectile(s.World, sh.owner, x, y, sh.direction, movement.Speed); err != nil {
+			log.Println(err)
+		}
+	}
+}
+
+// +++++++++++
+// RespawnSystem brings dead arena players, and players with a life left, back
+// once their delay is over and a spawn point is free.
+type RespawnSystem struct {
+	BaseSystem
+}
+
+func (s *RespawnSystem) Update(dt float32) {
+	arena := s.World.gameState.mode == ARENA
+	players := s.World.gameState.players
+	for i := range players {
+		if players[i].Alive || players[i].Left || (!arena && players[i].Lives == 0) {
+			continue
+		}
+		players[i].Respawn -= dt
+		if players[i].Respawn > 0 {
+			continue
+		}
+		spawn, ok := s.World.FreePlayerSpawn(i)
+		if !ok {
+			continue
+		}
+		if _, err := SpawnPlayer(s.World, i, spawn.X, spawn.Y); err != nil {
+			log.Println(err)
+			continue
+		}
+		players[i].Alive, players[i].Respawn = true, 0
+		if !arena {
+			players[i].Lives--
+		}
+	}
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+// ===PREFABS===
+//
+// Prefabs are named entity templates read from a JSON object of the form
+//
+//	"candy_red": {
+//		"base": "candy",
+//		"components": {"sprite": {"Color": {"R": 230, "G": 41, "B": 55, "A": 255}}}
+//	}
+//
+// A prefab with a base starts from the base's components and merges its own
+// fields on top, field by field; a component set to null is dropped. Component
+// names and fields are checked against the registry when the file is loaded.
+// A prefab may also have the "machine" its AI runs, see AISystem, else it has
+// the one of its base.
+
+const PREFABS_PATH = "data/prefabs.json"
+
+type Prefab struct {
+	Name       string
+	Components map[ComponentID]any
+	Machine    *Machine
+}
+
+type Prefabs map[string]*Prefab
+
+type prefabDef struct {
+	Base       string                     `json:"base"`
+	Components map[string]json.RawMessage `json:"components"`
+	Machine    *Machine                   `json:"machine"`
+}
+
+func LoadPrefabs(path string) (Prefabs, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	prefabs, err := ParsePrefabs(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return prefabs, nil
+}
+
+func ParsePrefabs(data []byte) (Prefabs, error) {
+	var defs map[string]prefabDef
+	if err := json.Unmarshal(data, &defs); err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(defs))
+	for name := range defs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	prefabs := make(Prefabs, len(defs))
+	for _, name := range names {
+		raw, err := resolvePrefab(defs, name, nil)
+		if err != nil {
+			return nil, err
+		}
+		prefab := &Prefab{Name: name, Components: make(map[ComponentID]any, len(raw))}
+		for compName, fields := range raw {
+			id, ok := componentNames[compName]
+			if !ok {
+				return nil, fmt.Errorf("prefab %q: unknown component %q", name, compName)
+			}
+			component, err := decodeComponent(id, fields)
+			if err != nil {
+				return nil, fmt.Errorf("prefab %q: component %q: %w", name, compName, err)
+			}
+			prefab.Components[id] = component
+		}
+		for def := defs[name]; prefab.Machine == nil; def = defs[def.Base] {
+			prefab.Machine = def.Machine
+			if def.Base == "" {
+				break
+			}
+		}
+		if prefab.Machine != nil {
+			if err := prefab.Machine.check(); err != nil {
+				return nil, fmt.Errorf("prefab %q: machine: %w", name, err)
+			}
+		}
+		prefabs[name] = prefab
+	}
+	for _, name := range names {
+		ai, ok := prefabs[name].Components[IAControlledID].(IAControlled)
+		if !ok {
+			continue
+		}
+		if machine, ok := prefabs[ai.Machine]; !ok || machine.Machine == nil {
+			return nil, fmt.Errorf("prefab %q: no machine %q", name, ai.Machine)
+		}
+	}
+	return prefabs, nil
+}
+
+// resolvePrefab returns the components of name with its bases merged in.
+func resolvePrefab(defs map[string]prefabDef, name string, seen []string) (map[string]json.RawMessage, error) {
+	for _, s := range seen {
+		if s == name {
+			return nil, fmt.Errorf("prefab %q inherits from itself through %v", name, seen)
+		}
+	}
+	def, ok := defs[name]
+	if !ok {
+		return nil, fmt.Errorf("prefab %q: unknown base %q", seen[len(seen)-1], name)
+	}
+
+	components := make(map[string]json.RawMessage)
+	if def.Base != "" {
+		base, err := resolvePrefab(defs, def.Base, append(seen, name))
+		if err != nil {
+			return nil, err
+		}
+		components = base
+	}
+	for compName, fields := range def.Components {
+		if bytes.Equal(bytes.TrimSpace(fields), []byte("null")) {
+			delete(components, compName)
+			continue
+		}
+		merged, err := mergeJSON(components[compName], fields)
+		if err != nil {
+			return nil, fmt.Errorf("prefab %q: component %q: %w", name, compName, err)
+		}
+		components[compName] = merged
+	}
+	return components, nil
+}
+
+// mergeJSON lays the fields of over on top of those of base. Nested objects
+// are merged as well, anything else is replaced.
+func mergeJSON(base, over json.RawMessage) (json.RawMessage, error) {
+	if base == nil {
+		return over, nil
+	}
+	var baseFields, overFields map[string]json.RawMessage
+	if json.Unmarshal(base, &baseFields) != nil || json.Unmarshal(over, &overFields) != nil {
+		return over, nil
+	}
+	for k, v := range overFields {
+		merged, err := mergeJSON(baseFields[k], v)
+		if err != nil {
+			return nil, err
+		}
+		baseFields[k] = merged
+	}
+	return json.Marshal(baseFields)
+}
+
+// decodeComponent decodes data into the component type registered for id.
+func decodeComponent(id ComponentID, data json.RawMessage) (any, error) {
+	column := GetArrayComponentsFromID(id)
+	if column == nil {
+		return nil, fmt.Errorf("component %d is not registered", id)
+	}
+	component := reflect.New(reflect.TypeOf(column).Elem())
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(component.Interface()); err != nil {
+		return nil, err
+	}
+	return component.Elem().Interface(), nil
+}
+
+// PrefabComponent returns a copy of one of the components of a prefab, nil if
+// the prefab does not exist or has no such component.
+func (w *World) PrefabComponent(name string, id ComponentID) any {
+	prefab, ok := w.prefabs[name]
+	if !ok {
+		return nil
+	}
+	component, ok := prefab.Components[id]
+	if !ok {
+		return nil
+	}
+	return cloneComponent(id, component)
+}
+
+// Spawn creates an entity from the prefab called name. Components in
+// overrides replace the prefab's own, and colliders and snake bodies are moved
+// to wherever the entity ends up.
+func (w *World) Spawn(name string, overrides map[ComponentID]any) (Entity, error) {
+	prefab, ok := w.prefabs[name]
+	if !ok {
+		return 0, fmt.Errorf("unknown prefab %q", name)
+	}
+
+	components := make(map[ComponentID]any, len(prefab.Components)+len(overrides))
+	for id, component := range prefab.Components {
+		components[id] = cloneComponent(id, component)
+	}
+	for id, component := range overrides {
+		components[id] = component
+	}
+
+	if pos, ok := components[positionID].(Position); ok {
+		if collider, ok := components[collidesID].(Collides); ok {
+			collider.X, collider.Y = pos.X, pos.Y
+			components[collidesID] = collider
+		}
+		if player, ok := components[playerControlledID].(PlayerControlled); ok && len(player.Body) == 0 {
+			player.Body = []rl.Vector2{{X: pos.X, Y: pos.Y}}
+			components[playerControlledID] = player
+		}
+	}
+	return w.CreateEntity(components), nil
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParsePrefabs(t *testing.T) {
+	tests := []struct {
+		name    string
+		json    string
+		prefab  string
+		want    map[ComponentID]any
+		wantErr string
+	}{
+		{
+			name: "base chain",
+			json: `{
+				"thing":  {"components": {"health": {"Max": 1, "Current": 1}, "sprite": {"Width": 20, "Height": 20}}},
+				"tough":  {"base": "thing", "components": {"health": {"Max": 3, "Current": 3}}},
+				"hurt":   {"base": "tough", "components": {"health": {"Current": 2}, "sprite": {"Height": 10}}}
+			}`,
+			prefab: "hurt",
+			want: map[ComponentID]any{
+				healthID: Health{Max: 3, Current: 2},
+				spriteID: Sprite{Width: 20, Height: 10},
+			},
+		},
+		{
+			name: "null drops a component",
+			json: `{
+				"thing": {"components": {"health": {"Max": 1}, "sprite": {"Width": 20}}},
+				"ghost": {"base": "thing", "components": {"health": null}}
+			}`,
+			prefab: "ghost",
+			want:   map[ComponentID]any{spriteID: Sprite{Width: 20}},
+		},
+		{
+			name: "cycle",
+			json: `{
+				"a": {"base": "b", "components": {}},
+				"b": {"base": "c", "components": {}},
+				"c": {"base": "a", "components": {}}
+			}`,
+			wantErr: "inherits from itself",
+		},
+		{
+			name:    "unknown base",
+			json:    `{"a": {"base": "nothing", "components": {}}}`,
+			wantErr: `prefab "a": unknown base "nothing"`,
+		},
+		{
+			name:    "unknown component",
+			json:    `{"a": {"components": {"wings": {}}}}`,
+			wantErr: `unknown component "wings"`,
+		},
+		{
+			name:    "unknown field",
+			json:    `{"a": {"components": {"health": {"Lives": 3}}}}`,
+			wantErr: `unknown field "Lives"`,
+		},
+		{
+			name: "unknown field in a base",
+			json: `{
+				"a": {"components": {"health": {"Lives": 3}}},
+				"b": {"base": "a", "components": {"health": {"Max": 1}}}
+			}`,
+			wantErr: `unknown field "Lives"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prefabs, err := ParsePrefabs([]byte(tt.json))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want one with %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := prefabs[tt.prefab].Components; !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMergeJSON(t *testing.T) {
+	tests := []struct {
+		name       string
+		base, over string
+		want       string
+	}{
+		{"no base", ``, `{"A": 1}`, `{"A": 1}`},
+		{"fields", `{"A": 1, "B": 2}`, `{"B": 3, "C": 4}`, `{"A": 1, "B": 3, "C": 4}`},
+		{"nested", `{"Color": {"R": 1, "G": 2}}`, `{"Color": {"G": 5}}`, `{"Color": {"R": 1, "G": 5}}`},
+		{"arrays are replaced", `{"Frames": [1, 2, 3]}`, `{"Frames": [4]}`, `{"Frames": [4]}`},
+		{"not an object", `{"A": 1}`, `7`, `7`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var base json.RawMessage
+			if tt.base != "" {
+				base = json.RawMessage(tt.base)
+			}
+			merged, err := mergeJSON(base, json.RawMessage(tt.over))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got, want any
+			if err := json.Unmarshal(merged, &got); err != nil {
+				t.Fatal(err)
+			}
+			if err := json.Unmarshal([]byte(tt.want), &want); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("got %s, want %s", merged, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeComponent(t *testing.T) {
+	tests := []struct {
+		name    string
+		id      ComponentID
+		data    string
+		want    any
+		wantErr string
+	}{
+		{"fields", healthID, `{"Max": 3, "Current": 2}`, Health{Max: 3, Current: 2}, ""},
+		{"empty", spriteID, `{}`, Sprite{}, ""},
+		{"unknown field", healthID, `{"Max": 3, "Lives": 1}`, nil, `unknown field "Lives"`},
+		{"wrong type", healthID, `{"Max": "three"}`, nil, "cannot unmarshal"},
+		{"unregistered", 0, `{}`, nil, "not registered"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeComponent(tt.id, json.RawMessage(tt.data))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want one with %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
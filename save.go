@@ -0,0 +1,348 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+// ===SAVES===
+//
+// A save holds the whole world: every archetype with its entities and one
+// column of component data per component, the game state and the state of the
+// random generator. Entity IDs are kept as they are. JSON saves are there to
+// be read by people, binary ones (gob behind a magic header) are what the
+// game writes to its slots.
+//
+// Archetypes and columns are written in a fixed order, so two equal worlds
+// always encode to the same bytes.
+//
+// SAVE_VERSION goes up whenever what a save holds changes shape, so that older
+// saves are refused instead of loading with the new fields left zero:
+//
+//	2  player indexes, fire cooldowns, modes and scores
+//	3  respawns, players leaving and player spawns
+//	4  bots
+//	5  kills, deaths and death causes per player
+//	6  candy types and lifetimes, snake speed, shields and lives
+//	7  status effects and piercing shots
+//	8  bunkers
+//	9  waves, formations and enemy shots
+//	10 enemy kinds, scores, dives and animations
+//	11 AI machine states
+//	12 bosses
+
+const (
+	SAVE_VERSION = 12
+	SAVES_DIR    = "saves"
+	SAVE_SLOTS   = 3
+)
+
+var saveMagic = []byte("SNKSAVE\x00")
+
+type SaveFormat int
+
+const (
+	SaveJSON SaveFormat = iota
+	SaveBinary
+)
+
+type SaveFile struct {
+	Version      int
+	Tick         uint64
+	NextEntityID Entity
+	State        State
+	GameState    SavedGameState
+	RNG          []byte
+	Archetypes   []SavedArchetype
+}
+
+type SavedArchetype struct {
+	Entities []Entity
+	Columns  []SavedColumn
+}
+
+// SavedColumn is the data of one component for every entity of an archetype,
+// encoded in the format of the save it belongs to.
+type SavedColumn struct {
+	Component string
+	Data      json.RawMessage
+}
+
+type SavedGameState struct {
+	MaxCandies     int
+	CurrentCandies int
+	Arena          Arena
+	CandySpawns    []rl.Vector2
+	CandyTypes     []CandyType
+	PlayerSpawns   []rl.Vector2
+	Mode           GameMode
+	Players        []PlayerStatus
+	Waves          *WaveSet
+	Wave           int
+	WaveSize       int
+	Intermission   float32
+	March          float32
+}
+
+func (g *GameState) save() SavedGameState {
+	return SavedGameState{
+		MaxCandies:     g.maxCandies,
+		CurrentCandies: g.currentCandies,
+		Arena:          g.arena,
+		CandySpawns:    g.candySpawns,
+		CandyTypes:     g.candyTypes,
+		PlayerSpawns:   g.playerSpawns,
+		Mode:           g.mode,
+		Players:        g.players,
+		Waves:          g.waves,
+		Wave:           g.wave,
+		WaveSize:       g.waveSize,
+		Intermission:   g.intermission,
+		March:          g.march,
+	}
+}
+
+func (g *GameState) load(s SavedGameState) {
+	g.maxCandies = s.MaxCandies
+	g.currentCandies = s.CurrentCandies
+	g.arena = s.Arena
+	g.candySpawns = s.CandySpawns
+	g.candyTypes = s.CandyTypes
+	g.playerSpawns = s.PlayerSpawns
+	g.mode = s.Mode
+	g.players = s.Players
+	g.waves = s.Waves
+	g.wave = s.Wave
+	g.waveSize = s.WaveSize
+	g.intermission = s.Intermission
+	g.march = s.March
+}
+
+type saveCodec interface {
+	marshal(v any) ([]byte, error)
+	unmarshal(data []byte, v any) error
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) marshal(v any) ([]byte, error)      { return json.Marshal(v) }
+func (jsonCodec) unmarshal(data []byte, v any) error { return json.Unmarshal(data, v) }
+
+type gobCodec struct{}
+
+func (gobCodec) marshal(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(v)
+	return buf.Bytes(), err
+}
+func (gobCodec) unmarshal(data []byte, v any) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+func componentName(id ComponentID) string {
+	for name, cid := range componentNames {
+		if cid == id {
+			return name
+		}
+	}
+	return ""
+}
+
+// Save writes w to out in the given format.
+func (w *World) Save(out io.Writer, format SaveFormat) error {
+	var codec saveCodec = jsonCodec{}
+	if format == SaveBinary {
+		codec = gobCodec{}
+	}
+	save, err := w.saveFile(codec)
+	if err != nil {
+		return err
+	}
+
+	if format == SaveJSON {
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(save)
+	}
+	data, err := codec.marshal(save)
+	if err != nil {
+		return err
+	}
+	if _, err := out.Write(saveMagic); err != nil {
+		return err
+	}
+	_, err = out.Write(data)
+	return err
+}
+
+func (w *World) saveFile(codec saveCodec) (*SaveFile, error) {
+	rng, err := w.pcg.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	save := &SaveFile{
+		Version:      SAVE_VERSION,
+		Tick:         w.tick,
+		NextEntityID: w.nextEntityID,
+		State:        w.state,
+		GameState:    w.gameState.save(),
+		RNG:          rng,
+	}
+
+	masks := make([]ComponentID, 0, len(w.archetypes))
+	for mask, archetype := range w.archetypes {
+		if len(archetype.Entities) > 0 {
+			masks = append(masks, mask)
+		}
+	}
+	sort.Slice(masks, func(i, j int) bool { return masks[i] < masks[j] })
+
+	for _, mask := range masks {
+		archetype := w.archetypes[mask]
+		saved := SavedArchetype{Entities: archetype.Entities}
+		for _, id := range GetComponentsFromMask(mask) {
+			name := componentName(id)
+			if name == "" {
+				return nil, fmt.Errorf("component %d has no name to be saved under", id)
+			}
+			column := archetype.Components[id]
+			if isTagColumn(column) {
+				// gob refuses structs with no fields, tags only need a count.
+				column = len(archetype.Entities)
+			}
+			data, err := codec.marshal(column)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+			saved.Columns = append(saved.Columns, SavedColumn{Component: name, Data: data})
+		}
+		save.Archetypes = append(save.Archetypes, saved)
+	}
+	return save, nil
+}
+
+// Load replaces w with the world saved in r, in either format. On error w is
+// left untouched.
+func (w *World) Load(r io.Reader) error {
+	br := bufio.NewReader(r)
+	head, err := br.Peek(len(saveMagic))
+	if err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+
+	var save SaveFile
+	var codec saveCodec = jsonCodec{}
+	if bytes.Equal(head, saveMagic) {
+		codec = gobCodec{}
+		br.Discard(len(saveMagic))
+		err = gob.NewDecoder(br).Decode(&save)
+	} else {
+		err = json.NewDecoder(br).Decode(&save)
+	}
+	if err != nil {
+		return err
+	}
+	if save.Version != SAVE_VERSION {
+		return fmt.Errorf("unsupported save version %d, want %d", save.Version, SAVE_VERSION)
+	}
+
+	loaded := NewWorld()
+	if err := loaded.pcg.UnmarshalBinary(save.RNG); err != nil {
+		return fmt.Errorf("rng: %w", err)
+	}
+	loaded.tick = save.Tick
+	loaded.nextEntityID = save.NextEntityID
+	loaded.state = save.State
+	loaded.gameState.load(save.GameState)
+
+	for _, saved := range save.Archetypes {
+		archetype := &Archetype{
+			Entities:      saved.Entities,
+			Components:    make(map[ComponentID]any),
+			EntityToIndex: make(map[Entity]int, len(saved.Entities)),
+		}
+		for _, column := range saved.Columns {
+			id, ok := componentNames[column.Component]
+			if !ok {
+				return fmt.Errorf("unknown component %q", column.Component)
+			}
+			data := reflect.New(reflect.TypeOf(GetArrayComponentsFromID(id)))
+			if isTagColumn(data.Elem().Interface()) {
+				var count int
+				if err := codec.unmarshal(column.Data, &count); err != nil {
+					return fmt.Errorf("%s: %w", column.Component, err)
+				}
+				data.Elem().Set(reflect.MakeSlice(data.Elem().Type(), count, count))
+			} else if err := codec.unmarshal(column.Data, data.Interface()); err != nil {
+				return fmt.Errorf("%s: %w", column.Component, err)
+			}
+			if data.Elem().Len() != len(saved.Entities) {
+				return fmt.Errorf("%s: %d values for %d entities", column.Component, data.Elem().Len(), len(saved.Entities))
+			}
+			archetype.Mask |= id
+			archetype.Components[id] = data.Elem().Interface()
+		}
+		if _, exists := loaded.archetypes[archetype.Mask]; exists {
+			return fmt.Errorf("archetype %b saved twice", archetype.Mask)
+		}
+		for idx, entity := range saved.Entities {
+			if _, exists := loaded.entityMask[entity]; exists || entity >= save.NextEntityID {
+				return fmt.Errorf("bad entity %d", entity)
+			}
+			archetype.EntityToIndex[entity] = idx
+			loaded.entityMask[entity] = archetype.Mask
+		}
+		loaded.archetypes[archetype.Mask] = archetype
+	}
+
+	loaded.prefabs = w.prefabs
+	*w = *loaded
+	return nil
+}
+
+// isTagColumn tells whether column holds a component with no fields.
+func isTagColumn(column any) bool {
+	elem := reflect.TypeOf(column).Elem()
+	return elem.Kind() == reflect.Struct && elem.NumField() == 0
+}
+
+// ===SAVE SLOTS===
+
+func SlotPath(slot int) string {
+	return filepath.Join(SAVES_DIR, fmt.Sprintf("slot%d.sav", slot))
+}
+
+func SaveToFile(w *World, path string, format SaveFormat) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := w.Save(f, format); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func LoadFromFile(w *World, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return w.Load(f)
+}
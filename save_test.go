@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// playedWorld is a bot's game of the invaders level some seconds in, with
+// snakes, candies, waves and shots about.
+func playedWorld(t *testing.T, ticks int) *World {
+	t.Helper()
+	level, err := LoadLevel("levels/03_invaders.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := NewWorld()
+	if w.prefabs, err = LoadPrefabs(PREFABS_PATH); err != nil {
+		t.Fatal(err)
+	}
+	w.Seed(11)
+	if err := level.Build(w, SOLO); err != nil {
+		t.Fatal(err)
+	}
+	w.MakeBot(0)
+	sim := NewSimulation(w)
+	for range ticks {
+		sim.Step([]InputFrame{0})
+	}
+	return w
+}
+
+func TestSaveRoundTrip(t *testing.T) {
+	for _, format := range []SaveFormat{SaveJSON, SaveBinary} {
+		w := playedWorld(t, 600)
+		var buf bytes.Buffer
+		if err := w.Save(&buf, format); err != nil {
+			t.Fatal(err)
+		}
+		loaded := NewWorld()
+		loaded.prefabs = w.prefabs
+		if err := loaded.Load(&buf); err != nil {
+			t.Fatal(err)
+		}
+
+		// Both worlds must agree now and keep agreeing as they go on.
+		sims := []*Simulation{NewSimulation(w), NewSimulation(loaded)}
+		for tick := range 300 {
+			want, err := w.Checksum()
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := loaded.Checksum()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != want {
+				t.Fatalf("format %d: checksum %x, want %x, %d ticks after loading", format, got, want, tick)
+			}
+			for _, sim := range sims {
+				sim.Step([]InputFrame{0})
+			}
+		}
+	}
+}
+
+func TestLoadRefusesOtherVersions(t *testing.T) {
+	w := playedWorld(t, 10)
+	var buf bytes.Buffer
+	if err := w.Save(&buf, SaveJSON); err != nil {
+		t.Fatal(err)
+	}
+	var save map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &save); err != nil {
+		t.Fatal(err)
+	}
+	save["Version"] = SAVE_VERSION - 1
+	old, err := json.Marshal(save)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := NewWorld()
+	err = loaded.Load(bytes.NewReader(old))
+	if err == nil || !strings.Contains(err.Error(), "unsupported save version") {
+		t.Errorf("got error %v", err)
+	}
+}
@@ -0,0 +1,341 @@
+package main
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"slices"
+	"sync"
+	"time"
+)
+
+// ===SERVER===
+//
+// The server runs the only World that counts, in ARENA mode. Clients send
+// their input of every tick, numbered, and get back what changed in the world
+// since the last time: the components whose encoding changed, the entities
+// that went away and the game state. Each delta acknowledges the last input
+// used, so that a client knows which of its predictions still need replaying.
+
+const (
+	SERVER_ADDR         = ":7778"
+	SERVER_SEND_EVERY   = 2
+	SERVER_MAX_PLAYERS  = 8
+	SERVER_INPUT_BUFFER = 16
+	SERVER_OUT_BUFFER   = 64
+)
+
+type ClientMessage struct {
+	Seq   uint64
+	Input InputFrame
+}
+
+type ServerMessage struct {
+	Welcome *ServerWelcome
+	Delta   *StateDelta
+}
+
+type ServerWelcome struct {
+	Player int
+}
+
+type StateDelta struct {
+	Tick      uint64
+	Ack       uint64
+	State     State
+	GameState *SavedGameState
+	Entities  []EntityDelta
+	Removed   []Entity
+}
+
+// EntityDelta holds the changed components of an entity, Mask being all the
+// components it has now.
+type EntityDelta struct {
+	Entity     Entity
+	Mask       ComponentID
+	Components []ComponentDelta
+}
+
+type ComponentDelta struct {
+	ID   ComponentID
+	Data json.RawMessage
+}
+
+// encodedEntity is an entity with its components in JSON, to be compared
+// with what a client was sent last.
+type encodedEntity struct {
+	mask       ComponentID
+	components map[ComponentID]string
+}
+
+func encodeEntities(w *World) (map[Entity]encodedEntity, error) {
+	encoded := make(map[Entity]encodedEntity, len(w.entityMask))
+	for entity := range w.entityMask {
+		components := w.Components(entity)
+		e := encodedEntity{mask: w.entityMask[entity], components: make(map[ComponentID]string, len(components))}
+		for id, component := range components {
+			data, err := json.Marshal(component)
+			if err != nil {
+				return nil, fmt.Errorf("entity %d: %w", entity, err)
+			}
+			e.components[id] = string(data)
+		}
+		encoded[entity] = e
+	}
+	return encoded, nil
+}
+
+// +++++++++++
+
+type serverClient struct {
+	player int
+	conn   net.Conn
+	inputs chan ClientMessage
+	out    chan ServerMessage
+	gone   chan struct{}
+	once   sync.Once
+
+	input InputFrame
+	ack   uint64
+	sent  map[Entity]encodedEntity
+	state []byte
+}
+
+func (c *serverClient) drop() {
+	c.once.Do(func() {
+		close(c.gone)
+		c.conn.Close()
+	})
+}
+
+func (c *serverClient) read() {
+	decoder := gob.NewDecoder(c.conn)
+	for {
+		var msg ClientMessage
+		if err := decoder.Decode(&msg); err != nil {
+			c.drop()
+			return
+		}
+		select {
+		case c.inputs <- msg:
+		case <-c.gone:
+			return
+		}
+	}
+}
+
+func (c *serverClient) write() {
+	encoder := gob.NewEncoder(c.conn)
+	for {
+		select {
+		case msg := <-c.out:
+			if err := encoder.Encode(msg); err != nil {
+				c.drop()
+				return
+			}
+		case <-c.gone:
+			return
+		}
+	}
+}
+
+// delta works out what changed for c since its last delta, and takes it as sent.
+func (c *serverClient) delta(w *World, encoded map[Entity]encodedEntity) (*StateDelta, error) {
+	d := &StateDelta{Tick: w.tick, Ack: c.ack, State: w.state}
+	gameState := w.gameState.save()
+	state, err := json.Marshal(gameState)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(state, c.state) {
+		// The delta is encoded by the writer while the next ticks run.
+		gameState.Players = slices.Clone(gameState.Players)
+		d.GameState = &gameState
+		c.state = state
+	}
+
+	for entity, e := range encoded {
+		old, known := c.sent[entity]
+		ed := EntityDelta{Entity: entity, Mask: e.mask}
+		for id, data := range e.components {
+			if known && old.components[id] == data {
+				continue
+			}
+			ed.Components = append(ed.Components, ComponentDelta{ID: id, Data: json.RawMessage(data)})
+		}
+		if !known || old.mask != e.mask || len(ed.Components) > 0 {
+			d.Entities = append(d.Entities, ed)
+		}
+	}
+	for entity := range c.sent {
+		if _, ok := encoded[entity]; !ok {
+			d.Removed = append(d.Removed, entity)
+		}
+	}
+	c.sent = encoded
+	return d, nil
+}
+
+// +++++++++++
+
+// Server runs a Simulation for every client connected to it.
+type Server struct {
+	Sim *Simulation
+	// OnTick, if set, sees the world after every tick, while nothing else can
+	// touch it.
+	OnTick func(w *World)
+
+	mu      sync.Mutex
+	clients []*serverClient
+}
+
+func NewServer(sim *Simulation) *Server {
+	return &Server{Sim: sim}
+}
+
+// AddClient makes conn a player of the arena.
+func (s *Server) AddClient(conn net.Conn) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.clients) >= SERVER_MAX_PLAYERS {
+		conn.Close()
+		return fmt.Errorf("server full")
+	}
+	c := &serverClient{
+		player: s.Sim.World.JoinPlayer(),
+		conn:   conn,
+		inputs: make(chan ClientMessage, SERVER_INPUT_BUFFER),
+		out:    make(chan ServerMessage, SERVER_OUT_BUFFER),
+		gone:   make(chan struct{}),
+		sent:   make(map[Entity]encodedEntity),
+	}
+	c.out <- ServerMessage{Welcome: &ServerWelcome{Player: c.player}}
+	s.clients = append(s.clients, c)
+	go c.read()
+	go c.write()
+	log.Printf("player %d joined from %s\n", c.player+1, conn.RemoteAddr())
+	return nil
+}
+
+// Connect plugs an in-process client into the server.
+func (s *Server) Connect() (net.Conn, error) {
+	server, client := net.Pipe()
+	if err := s.AddClient(server); err != nil {
+		client.Close()
+		return nil, err
+	}
+	return client, nil
+}
+
+func (s *Server) Serve(listener net.Listener) error {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+		if err := s.AddClient(conn); err != nil {
+			log.Println(err)
+		}
+	}
+}
+
+// Step runs one tick with the oldest input each client hasn't used yet, or
+// its last one when it has sent nothing new, and sends out the changes.
+func (s *Server) Step() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	w := s.Sim.World
+
+	clients := s.clients[:0]
+	for _, c := range s.clients {
+		select {
+		case <-c.gone:
+			log.Printf("player %d left\n", c.player+1)
+			w.LeavePlayer(c.player)
+		default:
+			clients = append(clients, c)
+		}
+	}
+	s.clients = clients
+
+	inputs := make([]InputFrame, len(w.gameState.players))
+	for _, c := range s.clients {
+		select {
+		case msg := <-c.inputs:
+			c.input, c.ack = msg.Input, msg.Seq
+		default:
+		}
+		inputs[c.player] = c.input
+	}
+	s.Sim.Step(inputs)
+	if s.OnTick != nil {
+		s.OnTick(w)
+	}
+
+	if w.tick%SERVER_SEND_EVERY != 0 || len(s.clients) == 0 {
+		return
+	}
+	encoded, err := encodeEntities(w)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	for _, c := range s.clients {
+		d, err := c.delta(w, encoded)
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+		select {
+		case c.out <- ServerMessage{Delta: d}:
+		default:
+			// A client this far behind can't be sent deltas anymore.
+			log.Printf("player %d is too slow, dropping\n", c.player+1)
+			c.drop()
+		}
+	}
+}
+
+// Close drops every client.
+func (s *Server) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, c := range s.clients {
+		c.drop()
+	}
+}
+
+// RunServer hosts an arena on level at addr, without a window, until the
+// listener fails.
+func RunServer(addr string, level *Level, prefabs Prefabs, web *WebView) error {
+	w := NewWorld()
+	w.prefabs = prefabs
+	w.Seed(uint64(time.Now().UnixNano()))
+	if err := level.Build(w, ARENA); err != nil {
+		return err
+	}
+	server := NewServer(NewSimulation(w))
+	server.OnTick = web.Publish
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	log.Printf("serving %q on %s\n", level.Name, listener.Addr())
+
+	errs := make(chan error, 1)
+	go func() { errs <- server.Serve(listener) }()
+	ticker := time.NewTicker(time.Second / TICK_RATE)
+	defer ticker.Stop()
+	for {
+		select {
+		case err := <-errs:
+			server.Close()
+			return err
+		case <-ticker.C:
+			server.Step()
+		}
+	}
+}
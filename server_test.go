@@ -0,0 +1,183 @@
+package main
+
+import (
+	"maps"
+	"testing"
+	"time"
+)
+
+// waitFor polls ok until it holds, failing the test after a second.
+func waitFor(t *testing.T, what string, ok func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !ok() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// headAt returns where the snake of player is in w.
+func headAt(w *World, player int) (Position, bool) {
+	entity, ok := w.PlayerEntity(player)
+	if !ok {
+		return Position{}, false
+	}
+	at, ok := getComponent[Position](w, entity, positionID)
+	if !ok {
+		return Position{}, false
+	}
+	return *at, true
+}
+
+func TestServerClients(t *testing.T) {
+	prefabs, err := LoadPrefabs(PREFABS_PATH)
+	if err != nil {
+		t.Fatal(err)
+	}
+	level, err := LoadLevel("levels/01_classic.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := NewWorld()
+	w.prefabs = prefabs
+	w.Seed(5)
+	if err := level.Build(w, ARENA); err != nil {
+		t.Fatal(err)
+	}
+	server := NewServer(NewSimulation(w))
+	defer server.Close()
+
+	const players = 3
+	var clients []*Client
+	for range players {
+		conn, err := server.Connect()
+		if err != nil {
+			t.Fatal(err)
+		}
+		client, err := NewClient(conn, prefabs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer client.Close()
+		clients = append(clients, client)
+	}
+	for i, client := range clients {
+		if client.Player != i {
+			t.Fatalf("client %d plays player %d", i, client.Player)
+		}
+	}
+
+	// Every tick each client sends its input, the server uses it at once and
+	// the clients get the delta before their next tick, so that a run plays
+	// the same every time.
+	tick := func(inputs func(player int) InputFrame) {
+		t.Helper()
+		for _, client := range clients {
+			if err := client.Update(inputs(client.Player)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		waitFor(t, "inputs", func() bool {
+			server.mu.Lock()
+			defer server.mu.Unlock()
+			for _, c := range server.clients {
+				if len(c.inputs) == 0 {
+					return false
+				}
+			}
+			return true
+		})
+		server.Step()
+		if w.tick%SERVER_SEND_EVERY == 0 {
+			waitFor(t, "deltas", func() bool {
+				for _, client := range clients {
+					if len(client.messages) == 0 {
+						return false
+					}
+				}
+				return true
+			})
+		}
+	}
+
+	predicted := 0
+	for seq := range uint64(400) {
+		tick(func(player int) InputFrame { return scriptedInput(player%2, seq) })
+		// The server just used the input each client predicted last. Snakes
+		// only move, so the client should have guessed right.
+		for _, client := range clients {
+			want, ok := headAt(w, client.Player)
+			got, ok2 := headAt(client.World, client.Player)
+			if !ok || !ok2 {
+				continue
+			}
+			if got != want {
+				t.Fatalf("tick %d: player %d predicted at %+v, server has %+v", w.tick, client.Player+1, got, want)
+			}
+			predicted++
+		}
+	}
+	if predicted < players*100 {
+		t.Errorf("only %d predictions checked", predicted)
+	}
+
+	// The next update applies the last delta, the server's world as it is.
+	want, err := encodeEntities(w)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, client := range clients {
+		if err := client.Update(0); err != nil {
+			t.Fatal(err)
+		}
+		got, err := encodeEntities(client.server)
+		if err != nil {
+			t.Fatal(err)
+		}
+		same := maps.EqualFunc(got, want, func(a, b encodedEntity) bool {
+			return a.mask == b.mask && maps.Equal(a.components, b.components)
+		})
+		if !same || client.server.tick != w.tick {
+			t.Errorf("player %d sees another world than the server", client.Player+1)
+		}
+	}
+	server.Step()
+
+	// A client that goes away leaves the game.
+	dropped := clients[players-1]
+	dropped.Close()
+	waitFor(t, "the server to notice", func() bool {
+		server.mu.Lock()
+		defer server.mu.Unlock()
+		select {
+		case <-server.clients[players-1].gone:
+			return true
+		default:
+			return false
+		}
+	})
+	server.Step()
+	if !w.gameState.players[dropped.Player].Left {
+		t.Errorf("dropped player is %+v", w.gameState.players[dropped.Player])
+	}
+	if _, ok := w.PlayerEntity(dropped.Player); ok {
+		t.Errorf("dropped player still has a snake")
+	}
+	clients = clients[:players-1]
+	for range 2 * SERVER_SEND_EVERY {
+		tick(func(int) InputFrame { return 0 })
+	}
+	for _, client := range clients {
+		if err := client.Update(0); err != nil {
+			t.Fatal(err)
+		}
+		if !client.server.gameState.players[dropped.Player].Left {
+			t.Errorf("player %d wasn't told player %d left", client.Player+1, dropped.Player+1)
+		}
+		if _, ok := client.server.PlayerEntity(dropped.Player); ok {
+			t.Errorf("player %d still sees the snake of player %d", client.Player+1, dropped.Player+1)
+		}
+	}
+}
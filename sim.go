@@ -0,0 +1,63 @@
+package main
+
+// ===SIMULATION===
+
+const (
+	TICK_RATE = 60
+	TICK      = 1.0 / TICK_RATE
+)
+
+// Simulation advances a World in fixed ticks. Drawing is left to the caller,
+// so a Simulation runs just as well without a window.
+type Simulation struct {
+	World   *World
+	systems []System
+}
+
+func NewSimulation(w *World) *Simulation {
+	return &Simulation{
+		World: w,
+		systems: []System{
+			*NewSystem(w, &BotSystem{}),
+			*NewSystem(w, &StatusEffectSystem{}),
+			*NewSystem(w, &AISystem{}),
+			*NewSystem(w, &MovementSystem{}),
+			*NewSystem(w, &FireSystem{}),
+			*NewSystem(w, &CollisionSystem{}),
+			*NewSystem(w, &ContactSystem{}),
+			*NewSystem(w, &SnakeSystem{}),
+			*NewSystem(w, &RespawnSystem{}),
+			*NewSystem(w, &ArenaSystem{}),
+			*NewSystem(w, &CandySystem{}),
+			*NewSystem(w, &WaveSystem{}),
+			*NewSystem(w, &BossSystem{}),
+			*NewSystem(w, &AnimationSystem{}),
+		},
+	}
+}
+
+// NewPredictionSimulation only moves things around, for clients to guess
+// what the server will say. Whatever spawns, scores or kills is left to it.
+func NewPredictionSimulation(w *World) *Simulation {
+	return &Simulation{
+		World: w,
+		systems: []System{
+			*NewSystem(w, &MovementSystem{}),
+			*NewSystem(w, &CollisionSystem{}),
+			*NewSystem(w, &ArenaSystem{}),
+		},
+	}
+}
+
+// Step runs one tick with the input of each player, by player index, if the
+// world is being played.
+func (s *Simulation) Step(inputs []InputFrame) {
+	if s.World.state != PLAY {
+		return
+	}
+	s.World.inputs = inputs
+	for _, system := range s.systems {
+		system.Update(TICK)
+	}
+	s.World.tick++
+}
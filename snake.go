@@ -16,3 +16,93 @@ func (c *PlayerControlled) GrowBody(body []rl.Vector2) {
 
 	c.Body = append(c.Body, tail)
 }
+
+// Follow moves the first segment to head and drags the rest behind it, each
+// one kept RECTSIZE away from the one in front.
+func (c *PlayerControlled) Follow(head rl.Vector2, arena Arena) {
+	if len(c.Body) == 0 {
+		return
+	}
+	c.Body[0] = head
+	for i := 1; i < len(c.Body); i++ {
+		d := arena.Delta(c.Body[i], c.Body[i-1])
+		dist := GetVectorLength(d)
+		if dist <= RECTSIZE {
+			continue
+		}
+		c.Body[i] = rl.Vector2Subtract(c.Body[i-1], rl.Vector2Scale(d, RECTSIZE/dist))
+	}
+}
+
+// SELF_SAFE_SEGMENTS is how many segments behind its head a snake can't run
+// into, they are always right next to it.
+const SELF_SAFE_SEGMENTS = 3
+
+// +++++++++++
+// SnakeSystem kills the snakes whose head runs into a body, their own or
+// another's, ghosts going through their own. Two heads meeting kill both
+// snakes.
+type SnakeSystem struct {
+	BaseSystem
+}
+
+func (s *SnakeSystem) Update(dt float32) {
+	type snake struct {
+		entity Entity
+		head   Position
+		body   []rl.Vector2
+	}
+	var snakes []snake
+
+	arena := s.World.gameState.arena
+	archetypes := s.World.Query(positionID, playerControlledID)
+	for archIdx := range archetypes {
+		entities := archetypes[archIdx].Entities
+		position := archetypes[archIdx].Components[positionID].([]Position)
+		player := archetypes[archIdx].Components[playerControlledID].([]PlayerControlled)
+		for idx := range entities {
+			snakes = append(snakes, snake{entities[idx], position[idx], player[idx].Body})
+		}
+	}
+
+	type death struct {
+		entity Entity
+		cause  string
+	}
+	var dead []death
+	for _, a := range snakes {
+		head := NewAABB(a.head.X, a.head.Y, RECTSIZE, RECTSIZE)
+		for _, b := range snakes {
+			first := 0
+			if a.entity == b.entity {
+				if _, ghost := s.World.Effect(a.entity, EffectGhost); ghost {
+					continue
+				}
+				first = SELF_SAFE_SEGMENTS
+			}
+			hit, at := false, 0
+			for i := first; i < len(b.body) && !hit; i++ {
+				// Segments grown this far are still piled up on the one ahead.
+				if i > 0 && b.body[i] == b.body[i-1] {
+					continue
+				}
+				segment := arena.Nearest(a.head, Position{X: b.body[i].X, Y: b.body[i].Y})
+				_, hit = OverlapAABB(head, NewAABB(segment.X, segment.Y, RECTSIZE, RECTSIZE))
+				at = i
+			}
+			if hit {
+				cause := DEATH_SNAKE
+				if a.entity == b.entity {
+					cause = DEATH_SELF
+				} else if at == 0 {
+					cause = DEATH_HEAD_ON
+				}
+				dead = append(dead, death{a.entity, cause})
+				break
+			}
+		}
+	}
+	for _, d := range dead {
+		s.World.KillPlayer(d.entity, d.cause)
+	}
+}
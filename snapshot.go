@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"hash/fnv"
+	"maps"
+	"slices"
+)
+
+// ===SNAPSHOTS===
+
+// Snapshot is a copy of everything a tick can change: the archetype columns,
+// the entity bookkeeping, the game state and the random generator. Restoring
+// one and simulating the same inputs again gives back the same world.
+type Snapshot struct {
+	Tick         uint64
+	nextEntityID Entity
+	state        State
+	gameState    GameState
+	entityMask   map[Entity]ComponentID
+	archetypes   map[ComponentID]*Archetype
+	rng          []byte
+}
+
+func (w *World) Snapshot() *Snapshot {
+	rng, _ := w.pcg.MarshalBinary()
+	gameState := w.gameState
+	gameState.candySpawns = slices.Clone(w.gameState.candySpawns)
+	gameState.candyTypes = slices.Clone(w.gameState.candyTypes)
+	gameState.playerSpawns = slices.Clone(w.gameState.playerSpawns)
+	gameState.players = slices.Clone(w.gameState.players)
+	return &Snapshot{
+		Tick:         w.tick,
+		nextEntityID: w.nextEntityID,
+		state:        w.state,
+		gameState:    gameState,
+		entityMask:   maps.Clone(w.entityMask),
+		archetypes:   cloneArchetypes(w.archetypes),
+		rng:          rng,
+	}
+}
+
+// Restore puts w back as it was when snap was taken. snap can be restored
+// again later.
+func (w *World) Restore(snap *Snapshot) {
+	w.tick = snap.Tick
+	w.nextEntityID = snap.nextEntityID
+	w.state = snap.state
+	w.gameState = snap.gameState
+	w.gameState.candySpawns = slices.Clone(snap.gameState.candySpawns)
+	w.gameState.candyTypes = slices.Clone(snap.gameState.candyTypes)
+	w.gameState.playerSpawns = slices.Clone(snap.gameState.playerSpawns)
+	w.gameState.players = slices.Clone(snap.gameState.players)
+	w.entityMask = maps.Clone(snap.entityMask)
+	w.archetypes = cloneArchetypes(snap.archetypes)
+	w.contacts = w.contacts[:0]
+	w.pcg.UnmarshalBinary(snap.rng)
+}
+
+func cloneArchetypes(archetypes map[ComponentID]*Archetype) map[ComponentID]*Archetype {
+	clone := make(map[ComponentID]*Archetype, len(archetypes))
+	for mask, archetype := range archetypes {
+		components := make(map[ComponentID]any, len(archetype.Components))
+		for id, column := range archetype.Components {
+			components[id] = cloneColumn(column)
+		}
+		clone[mask] = &Archetype{
+			Mask:          archetype.Mask,
+			Entities:      slices.Clone(archetype.Entities),
+			Components:    components,
+			EntityToIndex: maps.Clone(archetype.EntityToIndex),
+		}
+	}
+	return clone
+}
+
+// Checksum hashes the binary save of w, so two worlds have the same checksum
+// only if they would save to the same bytes.
+func (w *World) Checksum() (uint64, error) {
+	var buf bytes.Buffer
+	if err := w.Save(&buf, SaveBinary); err != nil {
+		return 0, err
+	}
+	h := fnv.New64a()
+	h.Write(buf.Bytes())
+	return h.Sum64(), nil
+}
+
+// +++++++++++
+
+// SnapshotRing keeps the snapshots of the last ticks together with the inputs
+// each of those ticks was run with.
+type SnapshotRing struct {
+	snapshots []*Snapshot
+	inputs    [][]InputFrame
+	next      int
+	count     int
+}
+
+func NewSnapshotRing(size int) *SnapshotRing {
+	return &SnapshotRing{
+		snapshots: make([]*Snapshot, size),
+		inputs:    make([][]InputFrame, size),
+	}
+}
+
+func (r *SnapshotRing) Len() int {
+	return r.count
+}
+
+// Push records snap, taken right before a tick is run with inputs.
+func (r *SnapshotRing) Push(snap *Snapshot, inputs []InputFrame) {
+	r.snapshots[r.next] = snap
+	r.inputs[r.next] = slices.Clone(inputs)
+	r.next = (r.next + 1) % len(r.snapshots)
+	r.count = min(r.count+1, len(r.snapshots))
+}
+
+func (r *SnapshotRing) index(back int) int {
+	return (r.next - 1 - back + 2*len(r.snapshots)) % len(r.snapshots)
+}
+
+// Back returns the snapshot pushed back pushes ago, 0 being the latest.
+func (r *SnapshotRing) Back(back int) (*Snapshot, bool) {
+	if back < 0 || back >= r.count {
+		return nil, false
+	}
+	return r.snapshots[r.index(back)], true
+}
+
+// Inputs returns the inputs recorded from back pushes ago up to the latest,
+// oldest first.
+func (r *SnapshotRing) Inputs(back int) [][]InputFrame {
+	var inputs [][]InputFrame
+	for i := min(back, r.count-1); i >= 0; i-- {
+		inputs = append(inputs, r.inputs[r.index(i)])
+	}
+	return inputs
+}
+
+// Drop forgets the newest n snapshots, after rewinding past them.
+func (r *SnapshotRing) Drop(n int) {
+	n = min(n, r.count)
+	r.next = (r.next - n + len(r.snapshots)) % len(r.snapshots)
+	r.count -= n
+}
+
+// Rewind takes sim back ticks ticks, or as far as the ring goes, and forgets
+// the snapshots it went past.
+func (r *SnapshotRing) Rewind(sim *Simulation, ticks int) bool {
+	back := min(ticks, r.count) - 1
+	snap, ok := r.Back(back)
+	if !ok {
+		return false
+	}
+	sim.World.Restore(snap)
+	r.Drop(back + 1)
+	return true
+}
+
+// VerifyReplay rebuilds the world of ticks ticks ago in a scratch world,
+// simulates the recorded inputs again and checks that it ends up with the
+// same checksum as sim.
+func (r *SnapshotRing) VerifyReplay(sim *Simulation, ticks int) error {
+	back := min(ticks, r.count) - 1
+	snap, ok := r.Back(back)
+	if !ok {
+		return fmt.Errorf("nothing recorded")
+	}
+
+	replay := NewWorld()
+	replay.prefabs = sim.World.prefabs
+	replay.Restore(snap)
+	replaySim := NewSimulation(replay)
+	for _, inputs := range r.Inputs(back) {
+		replaySim.Step(inputs)
+	}
+
+	want, err := sim.World.Checksum()
+	if err != nil {
+		return err
+	}
+	got, err := replay.Checksum()
+	if err != nil {
+		return err
+	}
+	if got != want {
+		return fmt.Errorf("replay of %d ticks diverged: checksum %x, want %x", back+1, got, want)
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package main
+
+import "testing"
+
+func TestSnapshotRestoreReplays(t *testing.T) {
+	w := playedWorld(t, 300)
+	sim := NewSimulation(w)
+	snap := w.Snapshot()
+	start, err := w.Checksum()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	run := func() uint64 {
+		t.Helper()
+		for tick := range uint64(200) {
+			sim.Step([]InputFrame{scriptedInput(0, tick)})
+		}
+		sum, err := w.Checksum()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sum
+	}
+	want := run()
+	if want == start {
+		t.Fatalf("nothing changed in 200 ticks")
+	}
+	// A snapshot can be restored more than once.
+	for range 2 {
+		w.Restore(snap)
+		if sum, _ := w.Checksum(); sum != start {
+			t.Fatalf("restored checksum %x, want %x", sum, start)
+		}
+		if got := run(); got != want {
+			t.Fatalf("replay checksum %x, want %x", got, want)
+		}
+	}
+}
+
+func TestSnapshotRing(t *testing.T) {
+	w := playedWorld(t, 0)
+	sim := NewSimulation(w)
+	ring := NewSnapshotRing(5)
+	if ring.Rewind(sim, 1) {
+		t.Fatalf("rewound an empty ring")
+	}
+
+	// Eight ticks go into a ring of five, the first three are evicted.
+	var ticks []uint64
+	for tick := range uint64(8) {
+		input := []InputFrame{scriptedInput(0, tick)}
+		ticks = append(ticks, w.tick)
+		ring.Push(w.Snapshot(), input)
+		sim.Step(input)
+	}
+	if ring.Len() != 5 {
+		t.Fatalf("ring holds %d, want 5", ring.Len())
+	}
+	if snap, ok := ring.Back(4); !ok || snap.Tick != ticks[3] {
+		t.Errorf("oldest snapshot is of tick %d, want %d", snap.Tick, ticks[3])
+	}
+	if _, ok := ring.Back(5); ok {
+		t.Errorf("evicted snapshot still there")
+	}
+	if inputs := ring.Inputs(4); len(inputs) != 5 || inputs[0][0] != scriptedInput(0, 3) {
+		t.Errorf("inputs %v", inputs)
+	}
+	if err := ring.VerifyReplay(sim, 5); err != nil {
+		t.Error(err)
+	}
+
+	// Rewinding two ticks goes back to the one before the latest.
+	if !ring.Rewind(sim, 2) || w.tick != ticks[6] || ring.Len() != 3 {
+		t.Fatalf("rewound to tick %d with %d left, want tick %d with 3", w.tick, ring.Len(), ticks[6])
+	}
+	// New ticks go in where the dropped ones were.
+	ring.Push(w.Snapshot(), []InputFrame{0})
+	sim.Step([]InputFrame{0})
+	if snap, _ := ring.Back(0); ring.Len() != 4 || snap.Tick != ticks[6] {
+		t.Errorf("latest snapshot is of tick %d with %d held", snap.Tick, ring.Len())
+	}
+	// Rewinding further than the ring goes stops at its oldest.
+	if !ring.Rewind(sim, 100) || w.tick != ticks[3] || ring.Len() != 0 {
+		t.Errorf("rewound to tick %d with %d left, want tick %d with none", w.tick, ring.Len(), ticks[3])
+	}
+}
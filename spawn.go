@@ -0,0 +1,103 @@
+package main
+
+import (
+	"errors"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+// ===SPAWNING===
+//
+// Things that show up during a game are put in a free place of the arena, one
+// overlapping no collider nor snake body, never too close to a snake head.
+// Candies, UFOs, boss minions and respawning snakes all go through FindSpawn,
+// each with its own SpawnRules. The place is drawn from all the free ones with
+// the world's rng, so a replay puts everything in the same place again.
+
+const CANDY_HEAD_DISTANCE = 3 * RECTSIZE
+
+var ErrArenaFull = errors.New("no free cell to spawn on")
+
+// SpawnRules says where FindSpawn may put something.
+type SpawnRules struct {
+	// HeadDistance is how far from every snake head it must be.
+	HeadDistance float32
+	// Points, when there are any, are the only places it may go. Else it goes
+	// in a cell of the arena.
+	Points []rl.Vector2
+	// Size is how big it is, a cell when zero.
+	Size rl.Vector2
+	// Clearance is the room it needs around it on every side.
+	Clearance float32
+	// SolidOnly lets it overlap triggers, such as candies.
+	SolidOnly bool
+	// First takes the first free point rather than a random one.
+	First bool
+}
+
+// FindSpawn returns a free place following rules, or ErrArenaFull.
+func (w *World) FindSpawn(rules SpawnRules) (Position, error) {
+	arena := w.gameState.arena
+	size := rules.Size
+	if size == (rl.Vector2{}) {
+		size = rl.Vector2{X: RECTSIZE, Y: RECTSIZE}
+	}
+	var heads []Position
+	var taken []AABB
+	for _, archetype := range w.Query(positionID, collidesID) {
+		position := archetype.Components[positionID].([]Position)
+		collider := archetype.Components[collidesID].([]Collides)
+		for idx := range archetype.Entities {
+			if !rules.SolidOnly || !collider[idx].Trigger {
+				taken = append(taken, collider[idx].AABB(position[idx]))
+			}
+		}
+	}
+	for _, archetype := range w.Query(playerControlledID, positionID) {
+		heads = append(heads, archetype.Components[positionID].([]Position)...)
+		for _, p := range archetype.Components[playerControlledID].([]PlayerControlled) {
+			for _, segment := range p.Body {
+				taken = append(taken, NewAABB(segment.X, segment.Y, RECTSIZE, RECTSIZE))
+			}
+		}
+	}
+	free := func(at Position) bool {
+		for _, head := range heads {
+			d := arena.Delta(rl.Vector2{X: head.X, Y: head.Y}, rl.Vector2{X: at.X, Y: at.Y})
+			if GetVectorLength(d) < rules.HeadDistance {
+				return false
+			}
+		}
+		area := NewAABB(at.X-rules.Clearance, at.Y-rules.Clearance, size.X+2*rules.Clearance, size.Y+2*rules.Clearance)
+		for _, box := range taken {
+			near := arena.Nearest(at, Position{X: box.Min.X, Y: box.Min.Y})
+			if _, hit := OverlapAABB(area, box.Translate(rl.Vector2{X: near.X - box.Min.X, Y: near.Y - box.Min.Y})); hit {
+				return false
+			}
+		}
+		return true
+	}
+
+	var candidates []Position
+	if len(rules.Points) > 0 {
+		for _, p := range rules.Points {
+			if at := (Position{X: p.X, Y: p.Y}); free(at) {
+				candidates = append(candidates, at)
+			}
+		}
+	} else {
+		grid := newBotGrid(arena)
+		for i := range grid.blocked {
+			if at := (Position{X: float32(i%grid.cols) * RECTSIZE, Y: float32(i/grid.cols) * RECTSIZE}); free(at) {
+				candidates = append(candidates, at)
+			}
+		}
+	}
+	if len(candidates) == 0 {
+		return Position{}, ErrArenaFull
+	}
+	if rules.First {
+		return candidates[0], nil
+	}
+	return candidates[w.rng.IntN(len(candidates))], nil
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+func TestSpawnCandySmallArenas(t *testing.T) {
+	prefabs, err := LoadPrefabs(PREFABS_PATH)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name  string
+		arena Arena
+		cells int
+	}{
+		{"narrower than a cell", Arena{Width: 10, Height: 200}, 0},
+		{"narrower than a cell, wrapping", Arena{Width: 10, Height: 200, Wrap: true}, 0},
+		{"one column", Arena{Width: RECTSIZE, Height: 3 * RECTSIZE}, 2},
+		{"three by two", Arena{Width: 60, Height: 40}, 5},
+		{"three by two, wrapping", Arena{Width: 60, Height: 40, Wrap: true}, 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := NewWorld()
+			w.prefabs = prefabs
+			w.gameState.arena = tt.arena
+			// A wall on the first cell, so there is something to keep clear of.
+			w.CreateEntity(map[ComponentID]any{
+				positionID: Position{},
+				collidesID: Collides{Width: RECTSIZE, Height: RECTSIZE},
+			})
+			taken := map[Position]bool{}
+			for {
+				candy, err := SpawnCandy(w)
+				if errors.Is(err, ErrArenaFull) {
+					break
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				at, _ := getComponent[Position](w, candy, positionID)
+				if taken[*at] {
+					t.Fatalf("two candies at %v", *at)
+				}
+				taken[*at] = true
+			}
+			if len(taken) != tt.cells {
+				t.Errorf("spawned %d candies, want one in each of the %d free cells", len(taken), tt.cells)
+			}
+		})
+	}
+}
+
+// spawnWorld is an empty 600x600 arena with the game's prefabs.
+func spawnWorld(t *testing.T) *World {
+	t.Helper()
+	w := NewWorld()
+	var err error
+	if w.prefabs, err = LoadPrefabs(PREFABS_PATH); err != nil {
+		t.Fatal(err)
+	}
+	w.gameState.arena = Arena{Width: 600, Height: 600}
+	w.Seed(1)
+	return w
+}
+
+func wallAt(w *World, x, y, width, height float32) Entity {
+	return w.CreateEntity(map[ComponentID]any{
+		positionID: Position{X: x, Y: y},
+		collidesID: Collides{X: x, Y: y, Width: width, Height: height},
+	})
+}
+
+func TestFindSpawnRules(t *testing.T) {
+	w := spawnWorld(t)
+	if _, err := SpawnPlayer(w, 0, 300, 300); err != nil {
+		t.Fatal(err)
+	}
+	wallAt(w, 100, 100, 20, 20)
+	if _, err := w.Spawn("candy", map[ComponentID]any{positionID: Position{X: 200, Y: 100}}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		rules SpawnRules
+		want  []Position
+	}{
+		{"points", SpawnRules{Points: []rl.Vector2{{X: 100, Y: 100}, {X: 400, Y: 400}}}, []Position{{X: 400, Y: 400}}},
+		{"touching is free", SpawnRules{Points: []rl.Vector2{{X: 120, Y: 100}}}, []Position{{X: 120, Y: 100}}},
+		{"size", SpawnRules{Points: []rl.Vector2{{X: 70, Y: 100}, {X: 90, Y: 60}}, Size: rl.Vector2{X: 40, Y: 40}}, []Position{{X: 90, Y: 60}}},
+		{"clearance", SpawnRules{Points: []rl.Vector2{{X: 130, Y: 100}, {X: 160, Y: 100}}, Clearance: 20, SolidOnly: true}, []Position{{X: 160, Y: 100}}},
+		{"triggers", SpawnRules{Points: []rl.Vector2{{X: 200, Y: 100}}}, nil},
+		{"solid only", SpawnRules{Points: []rl.Vector2{{X: 200, Y: 100}}, SolidOnly: true}, []Position{{X: 200, Y: 100}}},
+		{"snake", SpawnRules{Points: []rl.Vector2{{X: 310, Y: 310}}, SolidOnly: true}, nil},
+		{"head distance", SpawnRules{Points: []rl.Vector2{{X: 340, Y: 300}, {X: 400, Y: 300}}, HeadDistance: CANDY_HEAD_DISTANCE}, []Position{{X: 400, Y: 300}}},
+		{"first", SpawnRules{Points: []rl.Vector2{{X: 100, Y: 100}, {X: 500, Y: 0}, {X: 0, Y: 500}}, First: true}, []Position{{X: 500, Y: 0}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for range 20 {
+				at, err := w.FindSpawn(tt.rules)
+				if len(tt.want) == 0 {
+					if !errors.Is(err, ErrArenaFull) {
+						t.Fatalf("spawned at %+v", at)
+					}
+					return
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				found := false
+				for _, want := range tt.want {
+					found = found || at == want
+				}
+				if !found {
+					t.Fatalf("spawned at %+v, want one of %+v", at, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestFreePlayerSpawn(t *testing.T) {
+	w := spawnWorld(t)
+	w.gameState.playerSpawns = []rl.Vector2{{X: 100, Y: 100}, {X: 300, Y: 100}, {X: 500, Y: 100}}
+	if at, ok := w.FreePlayerSpawn(1); !ok || at != w.gameState.playerSpawns[1] {
+		t.Errorf("player 2 spawns at %v, want its own point", at)
+	}
+	// A candy on the point is no reason to go elsewhere, a wall near it is.
+	if _, err := w.Spawn("candy", map[ComponentID]any{positionID: Position{X: 300, Y: 100}}); err != nil {
+		t.Fatal(err)
+	}
+	wallAt(w, 500, 100+RECTSIZE+SPAWN_CLEARANCE/2, 20, 20)
+	if at, ok := w.FreePlayerSpawn(1); !ok || at != w.gameState.playerSpawns[1] {
+		t.Errorf("player 2 spawns at %v beside a candy, want its own point", at)
+	}
+	if at, ok := w.FreePlayerSpawn(2); !ok || at != w.gameState.playerSpawns[0] {
+		t.Errorf("player 3 spawns at %v, want the next free point", at)
+	}
+	wallAt(w, 100, 100, 20, 20)
+	wallAt(w, 300, 100, 20, 20)
+	if at, ok := w.FreePlayerSpawn(0); ok {
+		t.Errorf("spawned at %v with every point blocked", at)
+	}
+}
+
+func TestSendUFO(t *testing.T) {
+	w := spawnWorld(t)
+	waves := *NewSystem(w, &WaveSystem{})
+	ufo := func() (Position, Movement, bool) {
+		for _, archetype := range w.Query(enemyID, positionID, movementID) {
+			for idx, entity := range archetype.Entities {
+				if archetype.Components[enemyID].([]Enemy)[idx].Kind == EnemyUFO {
+					at := archetype.Components[positionID].([]Position)[idx]
+					mover := archetype.Components[movementID].([]Movement)[idx]
+					w.RemoveEntity(entity)
+					return at, mover, true
+				}
+			}
+		}
+		return Position{}, Movement{}, false
+	}
+
+	// With the left end of the top row walled up, UFOs only come from the right.
+	wall := wallAt(w, 0, RECTSIZE, 2*RECTSIZE, RECTSIZE)
+	for range 10 {
+		waves.sendUFO()
+		at, mover, ok := ufo()
+		if !ok || at.Y != RECTSIZE || at.X < 500 || mover.Direction.X != -1 {
+			t.Fatalf("UFO at %+v going %v", at, mover.Direction)
+		}
+	}
+	w.RemoveEntity(wall)
+	sides := make(map[float32]bool)
+	for range 20 {
+		waves.sendUFO()
+		_, mover, _ := ufo()
+		sides[mover.Direction.X] = true
+	}
+	if !sides[1] || !sides[-1] {
+		t.Errorf("UFOs only came going %v", sides)
+	}
+
+	wallAt(w, 0, RECTSIZE, 600, RECTSIZE)
+	waves.sendUFO()
+	if at, _, ok := ufo(); ok {
+		t.Errorf("UFO sent into a wall at %+v", at)
+	}
+}
+
+func TestBossSummonFindsRoom(t *testing.T) {
+	w := spawnWorld(t)
+	collider := w.PrefabComponent("invader_diver", collidesID).(Collides)
+	at := Position{X: 300, Y: 200}
+	// The place right under the boss is taken, the minion goes beside it.
+	wallAt(w, at.X-collider.Width/2, at.Y, collider.Width, collider.Height)
+	bossSummon(w, 0, 0, "invader_diver", at)()
+	var minions []Position
+	for _, archetype := range w.Query(enemyID, positionID) {
+		minions = append(minions, archetype.Components[positionID].([]Position)...)
+	}
+	if len(minions) != 1 || minions[0].Y != at.Y || abs(minions[0].X+collider.Width/2-at.X) != collider.Width {
+		t.Fatalf("minions at %+v", minions)
+	}
+
+	wallAt(w, at.X-2*collider.Width, at.Y, 4*collider.Width, collider.Height)
+	bossSummon(w, 0, 0, "invader_diver", at)()
+	if got := len(w.Query(enemyID)[0].Entities); got != 1 {
+		t.Errorf("%d minions, the second had no room", got)
+	}
+}
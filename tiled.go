@@ -0,0 +1,413 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+// ===TILED===
+//
+// ParseTiledMap imports a map saved by Tiled as JSON.
+//
+// Tile layers become blocks. A tile is solid when its layer or its tileset
+// tile has a "solid" property set, and takes its colour from a "color"
+// property on the tile or layer. Neighbouring tiles that agree on both are
+// merged into a single block, so a wall made of fifty tiles is still one
+// collider.
+//
+// Layer offsets, group ones included, move whatever the layer holds. Tile
+// objects are placed by their bottom-left corner, the way Tiled draws them.
+//
+// Objects are read by their type (class since Tiled 1.9), or by bool custom
+// properties of the same names:
+//
+//	player_spawn       a spawn point for the next player, in object order
+//	candy_spawner      candy spawn points, one per cell it covers; "candies"
+//	                   sets how many candies can be out at once
+//	invader_formation  "rows" x "cols" invaders, "spacing" cells apart
+//	wall               a solid block, coloured by "color"
+//	bunker             a bunker drawn by "mask" (see ParseBunkerMask) with
+//	                   "cell" pixels wide cells
+//
+// Any other type or class is the prefab of an entity put at the object.
+// Custom properties named like a component (see componentNames) set fields of
+// that component on top of the prefab's, as a class property with the fields
+// as members or as a string holding them as JSON:
+//
+//	health  {"Max": 3, "Current": 3}
+//
+// An object with such properties and no type is an entity of just those.
+//
+// The map itself reads the name, wrap, candies, candy_types and waves
+// properties.
+
+const tiledFlipFlags = 0xE0000000
+
+var tiledObjectKinds = []string{"player_spawn", "candy_spawner", "invader_formation", "wall", "bunker"}
+
+type tiledMap struct {
+	Width       int             `json:"width"`
+	Height      int             `json:"height"`
+	TileWidth   int             `json:"tilewidth"`
+	TileHeight  int             `json:"tileheight"`
+	Infinite    bool            `json:"infinite"`
+	Orientation string          `json:"orientation"`
+	Properties  tiledProperties `json:"properties"`
+	Layers      []tiledLayer    `json:"layers"`
+	Tilesets    []tiledTileset  `json:"tilesets"`
+}
+
+type tiledLayer struct {
+	Name       string          `json:"name"`
+	Type       string          `json:"type"`
+	Visible    *bool           `json:"visible"`
+	Data       []uint32        `json:"data"`
+	Objects    []tiledObject   `json:"objects"`
+	Layers     []tiledLayer    `json:"layers"`
+	OffsetX    float32         `json:"offsetx"`
+	OffsetY    float32         `json:"offsety"`
+	Properties tiledProperties `json:"properties"`
+}
+
+type tiledObject struct {
+	Name       string          `json:"name"`
+	Type       string          `json:"type"`
+	Class      string          `json:"class"`
+	GID        uint32          `json:"gid"`
+	X          float32         `json:"x"`
+	Y          float32         `json:"y"`
+	Width      float32         `json:"width"`
+	Height     float32         `json:"height"`
+	Properties tiledProperties `json:"properties"`
+}
+
+type tiledTileset struct {
+	FirstGID uint32      `json:"firstgid"`
+	Source   string      `json:"source"`
+	Tiles    []tiledTile `json:"tiles"`
+}
+
+type tiledTile struct {
+	ID         uint32          `json:"id"`
+	Properties tiledProperties `json:"properties"`
+}
+
+type tiledProperties []struct {
+	Name  string `json:"name"`
+	Type  string `json:"type"`
+	Value any    `json:"value"`
+}
+
+func (p tiledProperties) get(name string) (any, bool) {
+	for _, prop := range p {
+		if prop.Name == name {
+			return prop.Value, true
+		}
+	}
+	return nil, false
+}
+
+func (p tiledProperties) Bool(name string) bool {
+	v, _ := p.get(name)
+	b, _ := v.(bool)
+	return b
+}
+
+func (p tiledProperties) Int(name string, fallback int) int {
+	if v, ok := p.get(name); ok {
+		if f, ok := v.(float64); ok {
+			return int(f)
+		}
+	}
+	return fallback
+}
+
+func (p tiledProperties) String(name string) string {
+	v, _ := p.get(name)
+	s, _ := v.(string)
+	return s
+}
+
+func (p tiledProperties) Color(name string) (rl.Color, bool) {
+	c, err := parseTiledColor(p.String(name))
+	return c, err == nil
+}
+
+// parseTiledColor reads the "#AARRGGBB" or "#RRGGBB" strings Tiled writes.
+func parseTiledColor(s string) (rl.Color, error) {
+	hex := strings.TrimPrefix(s, "#")
+	if len(hex) == 6 {
+		hex = "ff" + hex
+	}
+	if len(hex) != 8 {
+		return rl.Color{}, fmt.Errorf("bad color %q", s)
+	}
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return rl.Color{}, fmt.Errorf("bad color %q", s)
+	}
+	return rl.Color{R: uint8(v >> 16), G: uint8(v >> 8), B: uint8(v), A: uint8(v >> 24)}, nil
+}
+
+type tiledCell struct {
+	color rl.Color
+	solid bool
+}
+
+func ParseTiledMap(r io.Reader) (*Level, error) {
+	var m tiledMap
+	if err := json.NewDecoder(r).Decode(&m); err != nil {
+		return nil, err
+	}
+	if m.Infinite {
+		return nil, fmt.Errorf("infinite maps are not supported")
+	}
+	if m.Orientation != "" && m.Orientation != "orthogonal" {
+		return nil, fmt.Errorf("%s maps are not supported", m.Orientation)
+	}
+	if m.TileWidth != m.TileHeight || m.TileWidth <= 0 {
+		return nil, fmt.Errorf("tiles must be square, got %dx%d", m.TileWidth, m.TileHeight)
+	}
+	for _, tileset := range m.Tilesets {
+		if tileset.Source != "" {
+			return nil, fmt.Errorf("external tileset %q, embed it in the map", tileset.Source)
+		}
+	}
+
+	cell := float32(m.TileWidth)
+	level := &Level{
+		Name:       m.Properties.String("name"),
+		Cell:       cell,
+		MaxCandies: m.Properties.Int("candies", 5),
+		Arena: Arena{
+			Width:  float32(m.Width) * cell,
+			Height: float32(m.Height) * cell,
+			Wrap:   m.Properties.Bool("wrap"),
+		},
+	}
+
+	for _, layer := range flattenTiledLayers(m.Layers) {
+		if layer.Visible != nil && !*layer.Visible {
+			continue
+		}
+		switch layer.Type {
+		case "tilelayer":
+			if len(layer.Data) != m.Width*m.Height {
+				return nil, fmt.Errorf("layer %q: %d tiles for a %dx%d map", layer.Name, len(layer.Data), m.Width, m.Height)
+			}
+			level.Blocks = append(level.Blocks, m.tileBlocks(layer)...)
+		case "objectgroup":
+			for _, object := range layer.Objects {
+				if err := level.addTiledObject(object.placed(layer)); err != nil {
+					return nil, fmt.Errorf("layer %q: object %q: %w", layer.Name, object.Name, err)
+				}
+			}
+		}
+	}
+
+	if types := m.Properties.String("candy_types"); types != "" {
+		var err error
+		if level.CandyTypes, err = ParseCandyTypes(types); err != nil {
+			return nil, fmt.Errorf("candy_types: %w", err)
+		}
+	}
+	if waves := m.Properties.String("waves"); waves != "" {
+		var err error
+		if level.Waves, err = LoadWaves(waves); err != nil {
+			return nil, fmt.Errorf("waves: %w", err)
+		}
+	}
+	if len(level.PlayerSpawns) == 0 {
+		return nil, fmt.Errorf("map has no player_spawn object")
+	}
+	return level, nil
+}
+
+// flattenTiledLayers lists the layers inside groups in place of the groups,
+// each offset by the groups it was in.
+func flattenTiledLayers(layers []tiledLayer) []tiledLayer {
+	var flat []tiledLayer
+	for _, layer := range layers {
+		if layer.Type == "group" {
+			for _, inner := range flattenTiledLayers(layer.Layers) {
+				inner.OffsetX += layer.OffsetX
+				inner.OffsetY += layer.OffsetY
+				flat = append(flat, inner)
+			}
+			continue
+		}
+		flat = append(flat, layer)
+	}
+	return flat
+}
+
+// tileBlocks groups the tiles of layer by colour and solidity and merges each
+// group into as few blocks as it can.
+func (m *tiledMap) tileBlocks(layer tiledLayer) []Block {
+	layerColor, ok := layer.Properties.Color("color")
+	if !ok {
+		layerColor = rl.Gray
+	}
+
+	groups := make(map[tiledCell][][]bool)
+	var order []tiledCell
+	for i, gid := range layer.Data {
+		gid &^= tiledFlipFlags
+		if gid == 0 {
+			continue
+		}
+		key := tiledCell{color: layerColor, solid: layer.Properties.Bool("solid")}
+		if tile, ok := m.tile(gid); ok {
+			key.solid = key.solid || tile.Properties.Bool("solid")
+			if color, ok := tile.Properties.Color("color"); ok {
+				key.color = color
+			}
+		}
+		if _, ok := groups[key]; !ok {
+			groups[key] = newCellGrid(m.Width, m.Height)
+			order = append(order, key)
+		}
+		groups[key][i/m.Width][i%m.Width] = true
+	}
+
+	var blocks []Block
+	offset := rl.Vector2{X: layer.OffsetX, Y: layer.OffsetY}
+	for _, key := range order {
+		for _, box := range mergeCells(groups[key], float32(m.TileWidth)) {
+			blocks = append(blocks, Block{Box: box.Translate(offset), Color: key.color, Solid: key.solid})
+		}
+	}
+	return blocks
+}
+
+func (m *tiledMap) tile(gid uint32) (tiledTile, bool) {
+	var owner *tiledTileset
+	for i := range m.Tilesets {
+		if m.Tilesets[i].FirstGID <= gid && (owner == nil || m.Tilesets[i].FirstGID > owner.FirstGID) {
+			owner = &m.Tilesets[i]
+		}
+	}
+	if owner == nil {
+		return tiledTile{}, false
+	}
+	for _, tile := range owner.Tiles {
+		if tile.ID == gid-owner.FirstGID {
+			return tile, true
+		}
+	}
+	return tiledTile{}, false
+}
+
+// placed moves object by the offset of its layer. Tile objects (those with a
+// gid) hang from their bottom-left corner, so they are moved up by their
+// height to put them at their top-left like every other object.
+func (object tiledObject) placed(layer tiledLayer) tiledObject {
+	object.X += layer.OffsetX
+	object.Y += layer.OffsetY
+	if object.GID != 0 {
+		object.Y -= object.Height
+	}
+	return object
+}
+
+func (l *Level) addTiledObject(object tiledObject) error {
+	var kinds []string
+	for _, kind := range []string{object.Type, object.Class} {
+		if kind != "" && !slices.Contains(kinds, kind) {
+			kinds = append(kinds, kind)
+		}
+	}
+	for _, kind := range tiledObjectKinds {
+		if object.Properties.Bool(kind) && !slices.Contains(kinds, kind) {
+			kinds = append(kinds, kind)
+		}
+	}
+	components, err := object.Properties.components()
+	if err != nil {
+		return err
+	}
+
+	box := NewAABB(object.X, object.Y, max(object.Width, l.Cell), max(object.Height, l.Cell))
+	prefab := ""
+	for _, kind := range kinds {
+		switch kind {
+		case "player_spawn":
+			l.PlayerSpawns = append(l.PlayerSpawns, box.Min)
+		case "candy_spawner":
+			l.MaxCandies = object.Properties.Int("candies", l.MaxCandies)
+			for y := box.Min.Y; y+l.Cell <= box.Max.Y; y += l.Cell {
+				for x := box.Min.X; x+l.Cell <= box.Max.X; x += l.Cell {
+					l.CandySpawns = append(l.CandySpawns, rl.Vector2{X: x, Y: y})
+				}
+			}
+		case "invader_formation":
+			rows := object.Properties.Int("rows", 3)
+			cols := object.Properties.Int("cols", 8)
+			spacing := float32(object.Properties.Int("spacing", 2)) * l.Cell
+			for row := range rows {
+				for col := range cols {
+					l.Invaders = append(l.Invaders, rl.Vector2{X: box.Min.X + float32(col)*spacing, Y: box.Min.Y + float32(row)*spacing})
+				}
+			}
+		case "wall":
+			color, ok := object.Properties.Color("color")
+			if !ok {
+				color = rl.Red
+			}
+			l.Blocks = append(l.Blocks, Block{Box: NewAABB(object.X, object.Y, object.Width, object.Height), Color: color, Solid: true})
+		case "bunker":
+			mask := object.Properties.String("mask")
+			if mask == "" {
+				mask = DEFAULT_BUNKER_MASK
+			}
+			bunker, err := ParseBunkerMask(mask, float32(object.Properties.Int("cell", BUNKER_CELL)))
+			if err != nil {
+				return fmt.Errorf("bunker: %w", err)
+			}
+			l.Bunkers = append(l.Bunkers, LevelBunker{At: box.Min, Mask: bunker})
+		default:
+			if prefab != "" {
+				return fmt.Errorf("object is both prefab %q and %q", prefab, kind)
+			}
+			prefab = kind
+		}
+	}
+	if prefab != "" || (len(kinds) == 0 && len(components) > 0) {
+		l.Entities = append(l.Entities, LevelEntity{Prefab: prefab, At: box.Min, Components: components})
+	}
+	return nil
+}
+
+// components returns the fields of every property named like a component.
+func (p tiledProperties) components() (map[string]json.RawMessage, error) {
+	components := make(map[string]json.RawMessage)
+	for _, prop := range p {
+		id, ok := componentNames[prop.Name]
+		if !ok {
+			continue
+		}
+		var fields json.RawMessage
+		switch v := prop.Value.(type) {
+		case string:
+			fields = json.RawMessage(v)
+		case map[string]any:
+			var err error
+			if fields, err = json.Marshal(v); err != nil {
+				return nil, fmt.Errorf("component %q: %w", prop.Name, err)
+			}
+		default:
+			return nil, fmt.Errorf("component %q: want a class or a JSON string, got %s", prop.Name, prop.Type)
+		}
+		if _, err := decodeComponent(id, fields); err != nil {
+			return nil, fmt.Errorf("component %q: %w", prop.Name, err)
+		}
+		components[prop.Name] = fields
+	}
+	return components, nil
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+func TestTiledObjects(t *testing.T) {
+	level, err := LoadLevel("testdata/objects.tmj")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if level.Name != "Objects" || level.MaxCandies != 2 {
+		t.Errorf("name %q, candies %d", level.Name, level.MaxCandies)
+	}
+	// The spawn has player_spawn as both its type and its class.
+	if len(level.PlayerSpawns) != 1 || level.PlayerSpawns[0] != (rl.Vector2{X: 20, Y: 80}) {
+		t.Errorf("player spawns %v", level.PlayerSpawns)
+	}
+	if len(level.Blocks) != 4 {
+		t.Errorf("%d blocks, want the top row, the pillar, the ledge and the crate", len(level.Blocks))
+	}
+	// The ledge and the crate are in a group and layers that move them by
+	// (20, 30), and the crate is a tile object placed by its bottom-left.
+	for _, want := range []AABB{NewAABB(60, 90, 20, 20), NewAABB(140, 70, 20, 20)} {
+		if !slices.ContainsFunc(level.Blocks, func(b Block) bool { return b.Box == want }) {
+			t.Errorf("no block at %+v in %+v", want, level.Blocks)
+		}
+	}
+	if len(level.CandySpawns) != 2 {
+		t.Errorf("candy spawns %v", level.CandySpawns)
+	}
+	if len(level.Entities) != 2 {
+		t.Fatalf("entities %+v", level.Entities)
+	}
+
+	w := NewWorld()
+	w.prefabs, err = LoadPrefabs(PREFABS_PATH)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := level.Build(w, SOLO); err != nil {
+		t.Fatal(err)
+	}
+
+	var tanks, markers int
+	for _, archetype := range w.Query(enemyID, healthID, positionID) {
+		for idx := range archetype.Entities {
+			enemy := archetype.Components[enemyID].([]Enemy)[idx]
+			if enemy.Kind != EnemyTank {
+				continue
+			}
+			tanks++
+			// Only the fields set on the object change, the rest is the prefab's.
+			if enemy.Score != 999 {
+				t.Errorf("tank score %d, want 999", enemy.Score)
+			}
+			if health := archetype.Components[healthID].([]Health)[idx]; health != (Health{Max: 3, Current: 1}) {
+				t.Errorf("tank health %+v", health)
+			}
+			if at := archetype.Components[positionID].([]Position)[idx]; at != (Position{X: 60, Y: 40}) {
+				t.Errorf("tank at %+v", at)
+			}
+		}
+	}
+	for _, archetype := range w.Query(spriteID, collidesID) {
+		for idx := range archetype.Entities {
+			collider := archetype.Components[collidesID].([]Collides)[idx]
+			if !collider.Trigger {
+				continue
+			}
+			markers++
+			if collider.X != 140 || collider.Y != 40 || collider.Width != 20 {
+				t.Errorf("marker collider %+v", collider)
+			}
+			if archetype.Mask&(enemyID|healthID) != 0 {
+				t.Errorf("marker has more than its properties")
+			}
+		}
+	}
+	if tanks != 1 || markers != 1 {
+		t.Errorf("%d tanks and %d markers, want one of each", tanks, markers)
+	}
+}
+
+// tiledMapWith is a 4x4 map with a player spawn and objects.
+func tiledMapWith(objects ...string) string {
+	all := append([]string{`{"type": "player_spawn", "x": 0, "y": 0}`}, objects...)
+	return fmt.Sprintf(`{
+		"width": 4, "height": 4, "tilewidth": 20, "tileheight": 20,
+		"layers": [{"name": "objects", "type": "objectgroup", "objects": [%s]}]
+	}`, strings.Join(all, ","))
+}
+
+func TestTiledObjectErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		object string
+		err    string
+	}{
+		{"bad JSON", `{"type": "invader", "properties": [{"name": "health", "type": "string", "value": "{Max: 3"}]}`, `component "health"`},
+		{"unknown field", `{"type": "invader", "properties": [{"name": "health", "type": "string", "value": "{\"Lives\": 3}"}]}`, `unknown field "Lives"`},
+		{"not fields", `{"type": "invader", "properties": [{"name": "health", "type": "int", "value": 3}]}`, "want a class or a JSON string"},
+		{"two prefabs", `{"type": "invader", "class": "ufo"}`, `both prefab "invader" and "ufo"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseTiledMap(strings.NewReader(tiledMapWith(tt.object)))
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("got error %v, want one with %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestTiledUnknownPrefab(t *testing.T) {
+	level, err := ParseTiledMap(strings.NewReader(tiledMapWith(`{"type": "dragon", "x": 20, "y": 20}`)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := NewWorld()
+	if w.prefabs, err = LoadPrefabs(PREFABS_PATH); err != nil {
+		t.Fatal(err)
+	}
+	if err := level.Build(w, SOLO); err == nil || !strings.Contains(err.Error(), `unknown prefab "dragon"`) {
+		t.Errorf("got error %v", err)
+	}
+}
+
+func TestLevelsBuild(t *testing.T) {
+	prefabs, err := LoadPrefabs(PREFABS_PATH)
+	if err != nil {
+		t.Fatal(err)
+	}
+	paths, err := ListLevels(LEVELS_DIR)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range paths {
+		t.Run(path, func(t *testing.T) {
+			level, err := LoadLevel(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			w := NewWorld()
+			w.prefabs = prefabs
+			if err := level.Build(w, SOLO); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,413 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"slices"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+// ===WAVES===
+//
+// Levels with a waves file send invaders at the snakes one formation after
+// another. WaveSystem marches the formation sideways, a step down every time
+// it reaches a side, has the bottom invaders of its columns shoot down and
+// now and then sends a bonus UFO along the top. Once the formation is gone it
+// waits for the intermission and brings the next wave on. Past the last wave
+// the waves start over, faster and shooting more each time round:
+//
+//	{
+//		"Intermission": 3,
+//		"Scale": {"FireRate": 1.3, "MarchSpeed": 1.2, "UFOChance": 1},
+//		"Waves": [{
+//			"Formation": ["IIIIIII", "SSSSSSS"],
+//			"Enemies": [
+//				{"Char": "I", "Prefab": "invader"},
+//				{"Char": "S", "Prefab": "invader_squid"}
+//			],
+//			"Top": 60, "Spacing": {"X": 60, "Y": 40},
+//			"FireRate": 0.5, "MarchSpeed": 20, "UFOChance": 0.05
+//		}]
+//	}
+//
+// Formation rows are read like a level grid, '.' being no invader and any
+// other character the enemy of Enemies with that Char. FireRate is shots a
+// second for the whole formation and UFOChance the chance a second that a UFO
+// shows up when none is flying. Every BossEvery waves a boss comes instead of
+// a formation, see BossSystem.
+
+const (
+	// WAVE_DROP is how far the formation steps down at a side.
+	WAVE_DROP = RECTSIZE / 2
+	// WAVE_FLOOR is how close to the bottom of the arena the formation comes.
+	WAVE_FLOOR = 6 * RECTSIZE
+	// WAVE_SPEEDUP is how much faster the last invader of a wave marches than
+	// the whole formation did.
+	WAVE_SPEEDUP     = 2
+	ENEMY_SHOT_SPEED = 220
+	UFO_SPEED        = 120
+	UFO_PREFAB       = "ufo"
+)
+
+// WaveEnemy is the prefab spawned for Char in a formation.
+type WaveEnemy struct {
+	Char   string
+	Prefab string
+}
+
+type Wave struct {
+	Formation  []string
+	Enemies    []WaveEnemy
+	Top        float32
+	Spacing    rl.Vector2
+	FireRate   float32
+	MarchSpeed float32
+	UFOChance  float32
+}
+
+// WaveScale multiplies the figures of a wave every time the waves start over.
+type WaveScale struct {
+	FireRate   float32
+	MarchSpeed float32
+	UFOChance  float32
+}
+
+type WaveSet struct {
+	Intermission float32
+	Scale        WaveScale
+	Waves        []Wave
+	BossEvery    int
+	Bosses       []BossDef
+}
+
+func LoadWaves(path string) (*WaveSet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	waves, err := ParseWaves(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return waves, nil
+}
+
+func ParseWaves(data []byte) (*WaveSet, error) {
+	set := &WaveSet{Scale: WaveScale{FireRate: 1, MarchSpeed: 1, UFOChance: 1}}
+	if err := json.Unmarshal(data, set); err != nil {
+		return nil, err
+	}
+	if len(set.Waves) == 0 {
+		return nil, fmt.Errorf("no waves")
+	}
+	for i, wave := range set.Waves {
+		invaders := 0
+		for _, row := range wave.Formation {
+			for _, char := range row {
+				if char == '.' {
+					continue
+				}
+				if _, ok := wave.enemy(char); !ok {
+					return nil, fmt.Errorf("wave %d: no enemy for %q", i+1, char)
+				}
+				invaders++
+			}
+		}
+		if invaders == 0 {
+			return nil, fmt.Errorf("wave %d: formation has no invader", i+1)
+		}
+	}
+	if set.BossEvery > 0 && len(set.Bosses) == 0 {
+		return nil, fmt.Errorf("a boss every %d waves but no bosses", set.BossEvery)
+	}
+	if set.BossEvery == 1 {
+		return nil, fmt.Errorf("every wave is a boss")
+	}
+	for _, boss := range set.Bosses {
+		if err := boss.check(); err != nil {
+			return nil, err
+		}
+	}
+	return set, nil
+}
+
+func (w Wave) enemy(char rune) (string, bool) {
+	for _, e := range w.Enemies {
+		if e.Char == string(char) {
+			return e.Prefab, true
+		}
+	}
+	return "", false
+}
+
+// Boss returns the index in Bosses of the boss that is wave n, if it is one.
+func (s *WaveSet) Boss(n int) (int, bool) {
+	if s.BossEvery <= 0 || n%s.BossEvery != 0 {
+		return 0, false
+	}
+	return (n/s.BossEvery - 1) % len(s.Bosses), true
+}
+
+// Wave returns wave n, counted from 1, scaled for the times round it is.
+// Boss waves are not counted, the formation after one being the one that
+// would have come in its place.
+func (s *WaveSet) Wave(n int) Wave {
+	f := n - 1
+	if s.BossEvery > 0 {
+		f -= (n - 1) / s.BossEvery
+	}
+	wave := s.Waves[f%len(s.Waves)]
+	round := float64(f / len(s.Waves))
+	wave.FireRate *= float32(math.Pow(float64(s.Scale.FireRate), round))
+	wave.MarchSpeed *= float32(math.Pow(float64(s.Scale.MarchSpeed), round))
+	wave.UFOChance *= float32(math.Pow(float64(s.Scale.UFOChance), round))
+	return wave
+}
+
+// checkWaves makes sure every enemy and boss of waves spawns.
+func checkWaves(w *World, waves *WaveSet) error {
+	if waves == nil {
+		return nil
+	}
+	for i, wave := range waves.Waves {
+		for _, e := range wave.Enemies {
+			if _, ok := w.prefabs[e.Prefab]; !ok {
+				return fmt.Errorf("wave %d: unknown prefab %q", i+1, e.Prefab)
+			}
+		}
+	}
+	if _, ok := w.prefabs[UFO_PREFAB]; !ok {
+		return fmt.Errorf("waves need a %q prefab", UFO_PREFAB)
+	}
+	for _, boss := range waves.Bosses {
+		if err := checkBoss(w, boss); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// NextWave puts the formation of the next wave in the arena, centred, or its
+// boss.
+func (w *World) NextWave() error {
+	g := &w.gameState
+	g.wave++
+	g.intermission = 0
+	g.march = 1
+	g.waveSize = 0
+	if boss, ok := g.waves.Boss(g.wave); ok {
+		if err := w.SpawnBoss(boss); err != nil {
+			return err
+		}
+		w.Emit(Event{Kind: EventWaveStarted, Wave: g.wave})
+		return nil
+	}
+	wave := g.waves.Wave(g.wave)
+
+	cols := 0
+	for _, row := range wave.Formation {
+		cols = max(cols, len(row))
+	}
+	left := (g.arena.Width - float32(cols-1)*wave.Spacing.X - RECTSIZE) / 2
+	for y, row := range wave.Formation {
+		for x, char := range row {
+			if char == '.' {
+				continue
+			}
+			at := Position{X: left + float32(x)*wave.Spacing.X, Y: wave.Top + float32(y)*wave.Spacing.Y}
+			prefab, _ := wave.enemy(char)
+			enemy, _ := w.PrefabComponent(prefab, enemyID).(Enemy)
+			enemy.Formation = true
+			if _, err := w.Spawn(prefab, map[ComponentID]any{
+				positionID: at,
+				enemyID:    enemy,
+			}); err != nil {
+				return err
+			}
+			g.waveSize++
+		}
+	}
+	w.Emit(Event{Kind: EventWaveStarted, Wave: g.wave})
+	return nil
+}
+
+// +++++++++++
+// WaveSystem marches the formation, fires its shots, flies the UFO and moves
+// on to the next wave. It does nothing in levels without waves.
+type WaveSystem struct {
+	BaseSystem
+}
+
+type formationMember struct {
+	entity   Entity
+	enemy    *Enemy
+	position *Position
+	collider *Collides
+}
+
+// place is where m is in the formation, which for a diver away is where it
+// will go back to.
+func (m formationMember) place() *Position {
+	if m.enemy.Away {
+		return &m.enemy.Slot
+	}
+	return m.position
+}
+
+func (s *WaveSystem) Update(dt float32) {
+	g := &s.World.gameState
+	if g.waves == nil {
+		return
+	}
+	if g.intermission > 0 {
+		g.intermission -= dt
+		if g.intermission <= 0 {
+			if err := s.World.NextWave(); err != nil {
+				log.Println("wave:", err)
+			}
+		}
+		return
+	}
+
+	var formation []formationMember
+	var ufos []Entity
+	boss := false
+	for _, archetype := range s.World.Query(enemyID, positionID, collidesID) {
+		enemy := archetype.Components[enemyID].([]Enemy)
+		position := archetype.Components[positionID].([]Position)
+		collider := archetype.Components[collidesID].([]Collides)
+		for idx, entity := range archetype.Entities {
+			switch {
+			case enemy[idx].Kind == EnemyBoss:
+				boss = true
+			case enemy[idx].Formation:
+				formation = append(formation, formationMember{entity, &enemy[idx], &position[idx], &collider[idx]})
+			case enemy[idx].Kind == EnemyUFO && !s.inside(collider[idx].AABB(position[idx])):
+				ufos = append(ufos, entity)
+			}
+		}
+	}
+	for _, ufo := range ufos {
+		s.World.RemoveEntity(ufo)
+	}
+	if len(formation) == 0 && !boss {
+		s.World.Emit(Event{Kind: EventWaveCleared, Wave: g.wave})
+		g.intermission = max(g.waves.Intermission, dt)
+		return
+	}
+	if len(formation) == 0 {
+		return
+	}
+
+	wave := g.waves.Wave(g.wave)
+	s.march(formation, wave, dt)
+	if s.World.rng.Float32() < wave.FireRate*dt {
+		s.fire(formation)
+	}
+	if s.World.rng.Float32() < wave.UFOChance*dt && !s.ufoFlying() {
+		s.sendUFO()
+	}
+}
+
+// inside tells whether box is between the side walls of the arena, a cell in
+// from each edge.
+func (s *WaveSystem) inside(box AABB) bool {
+	return box.Min.X > RECTSIZE && box.Max.X < s.World.gameState.arena.Width-RECTSIZE
+}
+
+func (s *WaveSystem) march(formation []formationMember, wave Wave, dt float32) {
+	g := &s.World.gameState
+	left := float32(math.MaxFloat32)
+	right := -left
+	bottom := -left
+	for _, m := range formation {
+		box := m.collider.AABB(*m.place())
+		left, right, bottom = min(left, box.Min.X), max(right, box.Max.X), max(bottom, box.Max.Y)
+	}
+
+	// The fewer invaders are left, the faster they go.
+	killed := 1 - float32(len(formation))/float32(max(g.waveSize, len(formation)))
+	step := rl.Vector2{X: g.march * wave.MarchSpeed * (1 + (WAVE_SPEEDUP-1)*killed) * dt}
+	if left+step.X < RECTSIZE || right+step.X > g.arena.Width-RECTSIZE {
+		g.march = -g.march
+		step.X = 0
+		step.Y = min(WAVE_DROP, max(g.arena.Height-WAVE_FLOOR-bottom, 0))
+	}
+	for _, m := range formation {
+		place := m.place()
+		place.X += step.X
+		place.Y += step.Y
+		if !m.enemy.Away {
+			m.collider.X = m.position.X
+			m.collider.Y = m.position.Y
+		}
+	}
+}
+
+// fire has one of the invaders in place with nothing of the formation below
+// them shoot.
+func (s *WaveSystem) fire(formation []formationMember) {
+	var shooters []formationMember
+	for _, m := range formation {
+		if m.enemy.Away {
+			continue
+		}
+		box := m.collider.AABB(*m.position)
+		covered := slices.ContainsFunc(formation, func(o formationMember) bool {
+			other := o.collider.AABB(*o.position)
+			return other.Min.Y > box.Min.Y && other.Min.X < box.Max.X && other.Max.X > box.Min.X
+		})
+		if !covered {
+			shooters = append(shooters, m)
+		}
+	}
+	if len(shooters) == 0 {
+		return
+	}
+	shooter := shooters[s.World.rng.IntN(len(shooters))]
+	box := shooter.collider.AABB(*shooter.position)
+	if err := SpawnEnemyShot(s.World, shooter.entity, (box.Min.X+box.Max.X)/2-2, box.Max.Y, rl.Vector2{Y: 1}, ENEMY_SHOT_SPEED); err != nil {
+		log.Println("wave:", err)
+	}
+}
+
+func (s *WaveSystem) ufoFlying() bool {
+	for _, archetype := range s.World.Query(enemyID) {
+		for _, enemy := range archetype.Components[enemyID].([]Enemy) {
+			if enemy.Kind == EnemyUFO {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// sendUFO starts a UFO from a free side of the top row towards the other.
+func (s *WaveSystem) sendUFO() {
+	arena := s.World.gameState.arena
+	collider, _ := s.World.PrefabComponent(UFO_PREFAB, collidesID).(Collides)
+	left := rl.Vector2{X: RECTSIZE, Y: RECTSIZE}
+	right := rl.Vector2{X: arena.Width - RECTSIZE - collider.Width, Y: RECTSIZE}
+	at, err := s.World.FindSpawn(SpawnRules{
+		Points:    []rl.Vector2{left, right},
+		Size:      rl.Vector2{X: collider.Width, Y: collider.Height},
+		SolidOnly: true,
+	})
+	if err != nil {
+		return
+	}
+	direction := rl.Vector2{X: 1}
+	if at.X != left.X {
+		direction.X = -1
+	}
+	if _, err := s.World.Spawn(UFO_PREFAB, map[ComponentID]any{
+		positionID: at,
+		movementID: ProjectileMotion(direction, UFO_SPEED),
+	}); err != nil {
+		log.Println("wave:", err)
+	}
+}
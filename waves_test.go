@@ -0,0 +1,274 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+const testWaves = `{
+	"Intermission": 0.5,
+	"Waves": [{
+		"Formation": ["I.I"],
+		"Enemies": [{"Char": "I", "Prefab": "invader"}],
+		"Top": 60, "Spacing": {"X": 60, "Y": 40},
+		"MarchSpeed": 20
+	}]
+}`
+
+func TestParseWaves(t *testing.T) {
+	set, err := ParseWaves([]byte(testWaves))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if set.Scale != (WaveScale{FireRate: 1, MarchSpeed: 1, UFOChance: 1}) {
+		t.Errorf("default scale %+v", set.Scale)
+	}
+	if _, err := LoadWaves("data/waves/invaders.json"); err != nil {
+		t.Error(err)
+	}
+
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{"not json", `{"Waves": [`, "unexpected end"},
+		{"no waves", `{"Waves": []}`, "no waves"},
+		{"unknown char", `{"Waves": [{"Formation": ["IX"], "Enemies": [{"Char": "I", "Prefab": "invader"}]}]}`, `no enemy for 'X'`},
+		{"empty formation", `{"Waves": [{"Formation": ["..."]}]}`, "no invader"},
+		{"no bosses", `{"Waves": [{"Formation": ["I"], "Enemies": [{"Char": "I"}]}], "BossEvery": 3}`, "no bosses"},
+		{"boss every wave", `{"Waves": [{"Formation": ["I"], "Enemies": [{"Char": "I"}]}], "BossEvery": 1, "Bosses": [{"Name": "B"}]}`, "every wave"},
+		{"boss without parts", `{"Waves": [{"Formation": ["I"], "Enemies": [{"Char": "I"}]}], "BossEvery": 2, "Bosses": [{"Name": "B"}]}`, "no parts"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseWaves([]byte(tt.data))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestWaveSetWave(t *testing.T) {
+	set := &WaveSet{
+		Scale:     WaveScale{FireRate: 2, MarchSpeed: 3, UFOChance: 1},
+		Waves:     []Wave{{Top: 1, FireRate: 1, MarchSpeed: 10, UFOChance: 0.5}, {Top: 2, FireRate: 1, MarchSpeed: 10, UFOChance: 0.5}},
+		BossEvery: 3,
+		Bosses:    []BossDef{{Name: "A"}, {Name: "B"}},
+	}
+	tests := []struct {
+		n    int
+		boss int
+		// top tells the waves apart.
+		top    float32
+		fire   float32
+		march  float32
+		ufo    float32
+		isBoss bool
+	}{
+		{n: 1, top: 1, fire: 1, march: 10, ufo: 0.5},
+		{n: 2, top: 2, fire: 1, march: 10, ufo: 0.5},
+		{n: 3, boss: 0, isBoss: true},
+		{n: 4, top: 1, fire: 2, march: 30, ufo: 0.5},
+		{n: 5, top: 2, fire: 2, march: 30, ufo: 0.5},
+		{n: 6, boss: 1, isBoss: true},
+		{n: 7, top: 1, fire: 4, march: 90, ufo: 0.5},
+		{n: 9, boss: 0, isBoss: true},
+		{n: 12, boss: 1, isBoss: true},
+	}
+	for _, tt := range tests {
+		boss, ok := set.Boss(tt.n)
+		if ok != tt.isBoss || boss != tt.boss {
+			t.Errorf("wave %d: boss %d %v, want %d %v", tt.n, boss, ok, tt.boss, tt.isBoss)
+		}
+		if ok {
+			continue
+		}
+		wave := set.Wave(tt.n)
+		if wave.Top != tt.top || wave.FireRate != tt.fire || wave.MarchSpeed != tt.march || wave.UFOChance != tt.ufo {
+			t.Errorf("wave %d: %+v", tt.n, wave)
+		}
+	}
+
+	set.BossEvery = 0
+	if _, ok := set.Boss(3); ok {
+		t.Error("a boss with BossEvery 0")
+	}
+	if wave := set.Wave(3); wave.Top != 1 || wave.MarchSpeed != 30 {
+		t.Errorf("wave 3 without bosses: %+v", wave)
+	}
+}
+
+func formationOf(w *World) []formationMember {
+	var formation []formationMember
+	for _, archetype := range w.Query(enemyID, positionID, collidesID) {
+		enemy := archetype.Components[enemyID].([]Enemy)
+		position := archetype.Components[positionID].([]Position)
+		collider := archetype.Components[collidesID].([]Collides)
+		for idx, entity := range archetype.Entities {
+			if enemy[idx].Formation {
+				formation = append(formation, formationMember{entity, &enemy[idx], &position[idx], &collider[idx]})
+			}
+		}
+	}
+	return formation
+}
+
+func invaderAt(t *testing.T, w *World, x, y float32) Entity {
+	t.Helper()
+	enemy, _ := w.PrefabComponent("invader", enemyID).(Enemy)
+	enemy.Formation = true
+	invader, err := w.Spawn("invader", map[ComponentID]any{positionID: Position{X: x, Y: y}, enemyID: enemy})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return invader
+}
+
+func TestWaveMarch(t *testing.T) {
+	tests := []struct {
+		name     string
+		at       Position
+		waveSize int
+		away     bool
+		want     Position
+		march    float32
+	}{
+		{"marches", Position{X: 290, Y: 100}, 1, false, Position{X: 320, Y: 100}, 1},
+		{"speeds up", Position{X: 290, Y: 100}, 2, false, Position{X: 335, Y: 100}, 1},
+		{"turns at a side", Position{X: 540, Y: 100}, 1, false, Position{X: 540, Y: 100 + WAVE_DROP}, -1},
+		{"stops short of the floor", Position{X: 540, Y: 455}, 1, false, Position{X: 540, Y: 460}, -1},
+		{"stays above the floor", Position{X: 540, Y: 475}, 1, false, Position{X: 540, Y: 475}, -1},
+		{"moves the slot of a diver", Position{X: 290, Y: 100}, 1, true, Position{X: 320, Y: 100}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := spawnWorld(t)
+			w.gameState.march = 1
+			w.gameState.waveSize = tt.waveSize
+			invaderAt(t, w, tt.at.X, tt.at.Y)
+			formation := formationOf(w)
+			if tt.away {
+				formation[0].enemy.Away = true
+				formation[0].enemy.Slot = tt.at
+				*formation[0].position = Position{X: 50, Y: 50}
+			}
+			waves := *NewSystem(w, &WaveSystem{})
+			waves.march(formation, Wave{MarchSpeed: 60}, 0.5)
+
+			if got := *formation[0].place(); got != tt.want {
+				t.Errorf("at %+v, want %+v", got, tt.want)
+			}
+			if w.gameState.march != tt.march {
+				t.Errorf("march %v, want %v", w.gameState.march, tt.march)
+			}
+			m := formation[0]
+			if tt.away && *m.position != (Position{X: 50, Y: 50}) {
+				t.Errorf("the diver was moved to %+v", *m.position)
+			}
+			if !tt.away && (m.collider.X != m.position.X || m.collider.Y != m.position.Y) {
+				t.Errorf("collider at %v,%v", m.collider.X, m.collider.Y)
+			}
+		})
+	}
+}
+
+// Only the bottom invader of a column shoots, and never a diver that is away.
+func TestWaveFire(t *testing.T) {
+	w := spawnWorld(t)
+	invaderAt(t, w, 290, 100)
+	bottom := invaderAt(t, w, 290, 140)
+	side := invaderAt(t, w, 350, 100)
+	waves := *NewSystem(w, &WaveSystem{})
+
+	shooters := func() []Entity {
+		var owners, shots []Entity
+		for _, archetype := range w.Query(projectileID, positionID) {
+			for idx, entity := range archetype.Entities {
+				projectile := archetype.Components[projectileID].([]Projectile)[idx]
+				position := archetype.Components[positionID].([]Position)[idx]
+				if !projectile.Enemy {
+					t.Errorf("shot %d is not an enemy shot", entity)
+				}
+				if position.Y != 160 && position.Y != 120 {
+					t.Errorf("shot %d starts at %+v", entity, position)
+				}
+				if !slices.Contains(owners, projectile.Owner) {
+					owners = append(owners, projectile.Owner)
+				}
+				shots = append(shots, entity)
+			}
+		}
+		for _, shot := range shots {
+			w.RemoveEntity(shot)
+		}
+		return owners
+	}
+	for range 40 {
+		waves.fire(formationOf(w))
+	}
+	if got := shooters(); len(got) != 2 || !slices.Contains(got, bottom) || !slices.Contains(got, side) {
+		t.Errorf("shots by %v, want %d and %d", got, bottom, side)
+	}
+
+	for _, m := range formationOf(w) {
+		if m.entity == side {
+			m.enemy.Away = true
+		}
+	}
+	for range 40 {
+		waves.fire(formationOf(w))
+	}
+	if got := shooters(); !slices.Equal(got, []Entity{bottom}) {
+		t.Errorf("shots by %v, want %d", got, bottom)
+	}
+}
+
+func TestWaveCleared(t *testing.T) {
+	w := spawnWorld(t)
+	set, err := ParseWaves([]byte(testWaves))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.gameState.waves = set
+	if err := w.NextWave(); err != nil {
+		t.Fatal(err)
+	}
+	formation := formationOf(w)
+	if len(formation) != 2 || w.gameState.wave != 1 || w.gameState.waveSize != 2 {
+		t.Fatalf("wave %d of %d invaders", w.gameState.wave, len(formation))
+	}
+	left := (w.gameState.arena.Width - 2*60 - RECTSIZE) / 2
+	for _, m := range formation {
+		if m.position.Y != 60 || (m.position.X != left && m.position.X != left+2*60) {
+			t.Errorf("invader at %+v", *m.position)
+		}
+	}
+	w.DrainEvents()
+	for _, m := range formation {
+		w.RemoveEntity(m.entity)
+	}
+
+	waves := *NewSystem(w, &WaveSystem{})
+	waves.Update(TICK)
+	if !emitted(w.DrainEvents(), EventWaveCleared) || w.gameState.intermission != 0.5 {
+		t.Fatalf("intermission %v after clearing", w.gameState.intermission)
+	}
+	ticks := 0
+	for w.gameState.wave == 1 && ticks < TICK_RATE {
+		waves.Update(TICK)
+		ticks++
+	}
+	if ticks != TICK_RATE/2 {
+		t.Errorf("next wave after %d ticks", ticks)
+	}
+	events := w.DrainEvents()
+	if !slices.ContainsFunc(events, func(e Event) bool { return e.Kind == EventWaveStarted && e.Wave == 2 }) {
+		t.Errorf("no wave 2 started in %v", events)
+	}
+	if len(formationOf(w)) != 2 || w.gameState.intermission != 0 {
+		t.Errorf("wave 2 has %d invaders", len(formationOf(w)))
+	}
+}
@@ -0,0 +1,333 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+
+	rl "github.com/gen2brain/raylib-go/raylib"
+)
+
+// ===WEB VIEW===
+//
+// A read-only look at a World from a browser. The game publishes the world
+// every few ticks, from its own goroutine, and the HTTP side only ever hands
+// out what was published:
+//
+//	/                 a page drawing the arena as it changes
+//	/events           the state, as server-sent events
+//	/api/state        the state, once
+//	/api/entities     every entity with all its components
+//	/api/archetypes   every archetype with its components and entity count
+//
+// A nil *WebView publishes nothing, so callers don't have to check.
+
+const WEB_PUBLISH_EVERY = 6
+
+type WebView struct {
+	mu          sync.Mutex
+	state       []byte
+	entities    []byte
+	archetypes  []byte
+	subscribers map[chan []byte]struct{}
+
+	lastTick  uint64
+	lastState State
+	published bool
+}
+
+type webState struct {
+	Tick     uint64
+	State    string
+	Mode     string
+	Arena    Arena
+	Players  []PlayerStatus
+	Entities []webEntity
+}
+
+type webEntity struct {
+	ID     Entity
+	Kind   string
+	X      float32
+	Y      float32
+	Width  float32
+	Height float32
+	Color  rl.Color
+	Body   []rl.Vector2 `json:",omitempty"`
+	// Cells are the boxes left of a bunker, drawn in place of the entity.
+	Cells []rl.Rectangle `json:",omitempty"`
+}
+
+type webEntityComponents struct {
+	ID         Entity
+	Components map[string]any
+}
+
+type webArchetype struct {
+	Mask       ComponentID
+	Components []string
+	Entities   int
+}
+
+func NewWebView() *WebView {
+	return &WebView{subscribers: make(map[chan []byte]struct{})}
+}
+
+func (v *WebView) ListenAndServe(addr string) error {
+	log.Printf("web view on http://%s\n", addr)
+	return http.ListenAndServe(addr, v.Handler())
+}
+
+func (v *WebView) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(rw http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(rw, r)
+			return
+		}
+		rw.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(rw, webPage)
+	})
+	mux.HandleFunc("/api/state", v.serveJSON(func() []byte { return v.state }))
+	mux.HandleFunc("/api/entities", v.serveJSON(func() []byte { return v.entities }))
+	mux.HandleFunc("/api/archetypes", v.serveJSON(func() []byte { return v.archetypes }))
+	mux.HandleFunc("/events", v.serveEvents)
+	return mux
+}
+
+func (v *WebView) serveJSON(doc func() []byte) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		v.mu.Lock()
+		data := doc()
+		v.mu.Unlock()
+		if data == nil {
+			data = []byte("null")
+		}
+		rw.Header().Set("Content-Type", "application/json")
+		rw.Write(data)
+	}
+}
+
+func (v *WebView) serveEvents(rw http.ResponseWriter, r *http.Request) {
+	flusher, ok := rw.(http.Flusher)
+	if !ok {
+		http.Error(rw, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	rw.Header().Set("Content-Type", "text/event-stream")
+	rw.Header().Set("Cache-Control", "no-cache")
+
+	// Slow viewers skip states, they only ever need the latest one.
+	updates := make(chan []byte, 1)
+	v.mu.Lock()
+	v.subscribers[updates] = struct{}{}
+	if v.state != nil {
+		updates <- v.state
+	}
+	v.mu.Unlock()
+	defer func() {
+		v.mu.Lock()
+		delete(v.subscribers, updates)
+		v.mu.Unlock()
+	}()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case state := <-updates:
+			if _, err := fmt.Fprintf(rw, "data: %s\n\n", state); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// Publish makes w what viewers see, every WEB_PUBLISH_EVERY ticks or when its
+// state changes. It must run on the goroutine that owns w.
+func (v *WebView) Publish(w *World) {
+	if v == nil {
+		return
+	}
+	if v.published && w.state == v.lastState && (w.tick == v.lastTick || w.tick%WEB_PUBLISH_EVERY != 0) {
+		return
+	}
+	v.published, v.lastTick, v.lastState = true, w.tick, w.state
+
+	state, err := json.Marshal(newWebState(w))
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	entities, err := json.Marshal(webEntitiesOf(w))
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	archetypes, err := json.Marshal(webArchetypesOf(w))
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.state, v.entities, v.archetypes = state, entities, archetypes
+	for updates := range v.subscribers {
+		select {
+		case <-updates:
+		default:
+		}
+		updates <- state
+	}
+}
+
+func newWebState(w *World) webState {
+	s := webState{
+		Tick:    w.tick,
+		State:   w.state.String(),
+		Mode:    w.gameState.mode.String(),
+		Arena:   w.gameState.arena,
+		Players: w.gameState.players,
+	}
+	for _, archetype := range w.Query(positionID) {
+		position := archetype.Components[positionID].([]Position)
+		sprite, hasSprite := archetype.Components[spriteID].([]Sprite)
+		animation, isAnimated := archetype.Components[animationID].([]Animation)
+		collider, hasCollider := archetype.Components[collidesID].([]Collides)
+		player, isPlayer := archetype.Components[playerControlledID].([]PlayerControlled)
+		bunker, isBunker := archetype.Components[bunkerID].([]Bunker)
+		for idx, entity := range archetype.Entities {
+			e := webEntity{ID: entity, Kind: webKind(archetype.Mask), X: position[idx].X, Y: position[idx].Y, Color: rl.Gray}
+			if hasCollider {
+				e.Width, e.Height = collider[idx].Width, collider[idx].Height
+			}
+			if hasSprite {
+				e.Width, e.Height, e.Color = sprite[idx].Width, sprite[idx].Height, sprite[idx].Color
+			} else if isAnimated {
+				look := animation[idx].Sprite
+				e.Width, e.Height, e.Color = look.Width, look.Height, look.Color
+			}
+			if isPlayer {
+				e.Body = player[idx].Body
+			}
+			if isBunker {
+				e.Cells = []rl.Rectangle{}
+				bunker[idx].EachCell(position[idx], func(box AABB) {
+					size := box.Size()
+					e.Cells = append(e.Cells, rl.Rectangle{X: box.Min.X, Y: box.Min.Y, Width: size.X, Height: size.Y})
+				})
+			}
+			s.Entities = append(s.Entities, e)
+		}
+	}
+	return s
+}
+
+func webKind(mask ComponentID) string {
+	switch {
+	case mask&playerControlledID != 0:
+		return "player"
+	case mask&projectileID != 0:
+		return "projectile"
+	case mask&candyID != 0:
+		return "candy"
+	case mask&enemyID != 0:
+		return "enemy"
+	case mask&bunkerID != 0:
+		return "bunker"
+	case mask&collidesID != 0:
+		return "wall"
+	default:
+		return "scenery"
+	}
+}
+
+func webEntitiesOf(w *World) []webEntityComponents {
+	var entities []webEntityComponents
+	for _, archetype := range w.Query() {
+		for _, entity := range archetype.Entities {
+			e := webEntityComponents{ID: entity, Components: make(map[string]any)}
+			for id, component := range w.Components(entity) {
+				e.Components[componentName(id)] = component
+			}
+			entities = append(entities, e)
+		}
+	}
+	sort.Slice(entities, func(i, j int) bool { return entities[i].ID < entities[j].ID })
+	return entities
+}
+
+func webArchetypesOf(w *World) []webArchetype {
+	var archetypes []webArchetype
+	for _, archetype := range w.Query() {
+		if len(archetype.Entities) == 0 {
+			continue
+		}
+		a := webArchetype{Mask: archetype.Mask, Entities: len(archetype.Entities)}
+		for _, id := range GetComponentsFromMask(archetype.Mask) {
+			a.Components = append(a.Components, componentName(id))
+		}
+		archetypes = append(archetypes, a)
+	}
+	return archetypes
+}
+
+const webPage = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Snake Invaders</title>
+<style>
+body { background: #222; color: #eee; font-family: monospace; display: flex; gap: 16px; padding: 16px; }
+canvas { background: rgb(252, 163, 17); }
+li.dead { color: #888; }
+</style>
+</head>
+<body>
+<canvas id="arena" width="600" height="600"></canvas>
+<div>
+<h2 id="status">waiting for the game...</h2>
+<ol id="players"></ol>
+<p><a href="/api/entities">entities</a> &middot; <a href="/api/archetypes">archetypes</a> &middot; <a href="/api/state">state</a></p>
+</div>
+<script>
+var canvas = document.getElementById("arena");
+var ctx = canvas.getContext("2d");
+function rgb(c) { return "rgba(" + c.R + "," + c.G + "," + c.B + "," + (c.A / 255) + ")"; }
+function draw(s) {
+	canvas.width = s.Arena.Width;
+	canvas.height = s.Arena.Height;
+	document.getElementById("status").textContent = s.State + " - " + s.Mode + " - tick " + s.Tick;
+	(s.Entities || []).forEach(function (e) {
+		ctx.fillStyle = rgb(e.Color);
+		(e.Body || []).slice(1).forEach(function (b) {
+			ctx.globalAlpha = 0.7;
+			ctx.fillRect(b.X, b.Y, 20, 20);
+			ctx.globalAlpha = 1;
+		});
+		if (e.Cells) {
+			e.Cells.forEach(function (c) { ctx.fillRect(c.X, c.Y, c.Width, c.Height); });
+			return;
+		}
+		ctx.fillRect(e.X, e.Y, e.Width, e.Height);
+	});
+	var list = document.getElementById("players");
+	list.innerHTML = "";
+	(s.Players || []).forEach(function (p, i) {
+		if (p.Left) { return; }
+		var li = document.createElement("li");
+		li.textContent = "P" + (i + 1) + " " + p.Score;
+		if (!p.Alive) { li.className = "dead"; }
+		list.appendChild(li);
+	});
+}
+new EventSource("/events").onmessage = function (m) { draw(JSON.parse(m.data)); };
+</script>
+</body>
+</html>
+`
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func getJSON(t *testing.T, url string, v any) {
+	t.Helper()
+	res, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if ct := res.Header.Get("Content-Type"); ct != "application/json" {
+		t.Errorf("%s is %s", url, ct)
+	}
+	if err := json.NewDecoder(res.Body).Decode(v); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWebViewState(t *testing.T) {
+	w := playedWorld(t, 0)
+	view := NewWebView()
+	server := httptest.NewServer(view.Handler())
+	defer server.Close()
+
+	// Nothing is published yet.
+	var state *webState
+	getJSON(t, server.URL+"/api/state", &state)
+	if state != nil {
+		t.Fatalf("state before publishing: %+v", state)
+	}
+
+	view.Publish(w)
+	getJSON(t, server.URL+"/api/state", &state)
+	if state == nil || state.Tick != 0 || state.State != "PLAY" || state.Mode != SOLO.String() {
+		t.Fatalf("state %+v", state)
+	}
+	if state.Arena != w.gameState.arena || len(state.Players) != 1 {
+		t.Errorf("arena %+v, players %+v", state.Arena, state.Players)
+	}
+	kinds := make(map[string]int)
+	for _, e := range state.Entities {
+		kinds[e.Kind]++
+		if e.Kind == "player" && len(e.Body) == 0 {
+			t.Errorf("player without a body")
+		}
+	}
+	if kinds["player"] != 1 || kinds["wall"] == 0 {
+		t.Errorf("entities by kind %v", kinds)
+	}
+
+	var archetypes []webArchetype
+	getJSON(t, server.URL+"/api/archetypes", &archetypes)
+	var entities []webEntityComponents
+	getJSON(t, server.URL+"/api/entities", &entities)
+	total := 0
+	for _, a := range archetypes {
+		total += a.Entities
+	}
+	if total == 0 || total != len(entities) {
+		t.Errorf("archetypes hold %d entities, %d listed", total, len(entities))
+	}
+
+	// Only every WEB_PUBLISH_EVERY ticks is published.
+	sim := NewSimulation(w)
+	for tick := 1; tick <= WEB_PUBLISH_EVERY; tick++ {
+		sim.Step([]InputFrame{0})
+		view.Publish(w)
+		getJSON(t, server.URL+"/api/state", &state)
+		want := uint64(0)
+		if tick == WEB_PUBLISH_EVERY {
+			want = WEB_PUBLISH_EVERY
+		}
+		if state.Tick != want {
+			t.Fatalf("tick %d: published tick %d, want %d", tick, state.Tick, want)
+		}
+	}
+}
+
+func TestWebViewEvents(t *testing.T) {
+	w := playedWorld(t, 0)
+	view := NewWebView()
+	view.Publish(w)
+	server := httptest.NewServer(view.Handler())
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "GET", server.URL+"/events", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	// A new viewer gets the latest state at once, then every new one.
+	events := bufio.NewScanner(res.Body)
+	next := func() webState {
+		t.Helper()
+		for events.Scan() {
+			if data, ok := strings.CutPrefix(events.Text(), "data: "); ok {
+				var state webState
+				if err := json.Unmarshal([]byte(data), &state); err != nil {
+					t.Fatal(err)
+				}
+				return state
+			}
+		}
+		t.Fatalf("events ended: %v", events.Err())
+		return webState{}
+	}
+	if state := next(); state.Tick != 0 {
+		t.Errorf("first event of tick %d", state.Tick)
+	}
+	w.state = PAUSE
+	view.Publish(w)
+	if state := next(); state.State != "PAUSE" {
+		t.Errorf("second event in %s, want PAUSE", state.State)
+	}
+}